@@ -0,0 +1,285 @@
+package godbf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const fixedHeaderByteLength = 32
+
+// Reader reads a dbase table from an io.Reader one record at a time, so that tables of any size can be read from a
+// file, a gzip stream, a zip member or an HTTP body. Only the header and a single record are held in memory.
+// As many records are read as the header states, any content after them is ignored.
+//
+//	dr, err := godbf.NewReader(body, "GBK")
+//	for dr.Next() {
+//	  value, err := dr.Record().ValueByName("SOME_COLUMN")
+//	}
+//	err = dr.Err()
+type Reader struct {
+	table       *DbfTable // the schema of the table, without any records
+	fieldMap    map[string]int
+	source      io.Reader
+	record      Record
+	recordsRead int
+	err         error
+}
+
+// Record is the record a Reader is positioned at. Its content is only valid until the next call to Reader.Next().
+type Record struct {
+	dr           *Reader
+	number       int
+	data         []byte
+	fieldOffsets []int // offset of each field in the record, as encoded in the header
+	fieldLengths []int // length of each field in the record, as encoded in the header
+}
+
+// NewReader creates a Reader, reading the header of the table from r, expecting the supplied encoding.
+// Records are read from r as the Reader is advanced with Next().
+func NewReader(r io.Reader, fileEncoding string) (dr *Reader, newErr error) {
+	defer func() {
+		if e := recover(); e != nil {
+			newErr = fmt.Errorf("%v", e)
+		}
+	}()
+
+	source := bufio.NewReader(r)
+
+	fixedHeader := make([]byte, fixedHeaderByteLength)
+	if _, readErr := reader(source, fixedHeader); readErr != nil {
+		return nil, readErr
+	}
+
+	dt := new(DbfTable)
+	dt.UseEncoding(fileEncoding)
+	dt.SetNumberOfBytesInHeaderFromBytes(fixedHeader[8:10])
+	if dt.numberOfBytesInHeader <= fixedHeaderByteLength {
+		return nil, fmt.Errorf("encoded header is %d bytes, but must be more than %d", dt.numberOfBytesInHeader, fixedHeaderByteLength)
+	}
+
+	headerBytes := make([]byte, dt.numberOfBytesInHeader)
+	copy(headerBytes, fixedHeader)
+	if _, readErr := reader(source, headerBytes[fixedHeaderByteLength:]); readErr != nil {
+		return nil, readErr
+	}
+	if unpackErr := unpackHeader(headerBytes, dt); unpackErr != nil {
+		return nil, unpackErr
+	}
+	lockSchema(dt)
+
+	dr = &Reader{table: dt, fieldMap: make(map[string]int), source: source}
+	dr.record = Record{
+		dr:     dr,
+		number: -1,
+		data:   make([]byte, dt.lengthOfEachRecord),
+	}
+
+	// Fields of unsupported types are not part of the table's schema, but still take their encoded length in each
+	// record, after the deletion flag.
+	recordOffset := 1
+	for i := 0; i < dt.numberOfFields; i++ {
+		descriptor := headerBytes[fixedHeaderByteLength+i*32 : fixedHeaderByteLength+(i+1)*32]
+		fieldLength := int(descriptor[16])
+		if len(dr.record.fieldOffsets) < len(dt.fields) && descriptor[11] == dt.fields[len(dr.record.fieldOffsets)].fieldType.byte() {
+			dr.fieldMap[dt.fields[len(dr.record.fieldOffsets)].name] = len(dr.record.fieldOffsets)
+			dr.record.fieldOffsets = append(dr.record.fieldOffsets, recordOffset)
+			dr.record.fieldLengths = append(dr.record.fieldLengths, fieldLength)
+		}
+		recordOffset += fieldLength
+	}
+	if recordOffset != int(dt.lengthOfEachRecord) {
+		return nil, fmt.Errorf("encoded fields are %d bytes, but header expected records of %d bytes", recordOffset, dt.lengthOfEachRecord)
+	}
+
+	return dr, nil
+}
+
+// Next reads the next record, which is then available through Record(). It returns false once all records have been
+// read, or if reading fails, in which case Err() returns the error.
+func (dr *Reader) Next() (hasRecord bool) {
+	if dr.err != nil || dr.recordsRead >= dr.NumberOfRecords() {
+		return false
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			dr.err = fmt.Errorf("%v", e)
+			hasRecord = false
+		}
+	}()
+
+	if _, readErr := reader(dr.source, dr.record.data); readErr != nil {
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			readErr = fmt.Errorf("encoded content ends after %d records, but header expected %d", dr.recordsRead, dr.NumberOfRecords())
+		}
+		dr.err = readErr
+		return false
+	}
+
+	dr.record.number = dr.recordsRead
+	dr.recordsRead++
+	return true
+}
+
+// Record returns the record read by the last call to Next().
+func (dr *Reader) Record() *Record {
+	return &dr.record
+}
+
+// Err returns the error that stopped Next(), or nil if all records were read.
+func (dr *Reader) Err() error {
+	return dr.err
+}
+
+// Fields return the fields of the table as a slice
+func (dr *Reader) Fields() []FieldDescriptor {
+	return dr.table.Fields()
+}
+
+// FieldNames return the names of fields in the table as a slice
+func (dr *Reader) FieldNames() []string {
+	return dr.table.FieldNames()
+}
+
+// NumberOfRecords returns the number of records in the table, as stated by its header
+func (dr *Reader) NumberOfRecords() int {
+	return dr.table.NumberOfRecords()
+}
+
+// LastUpdated returns the date of last update of the table, as stated by its header
+func (dr *Reader) LastUpdated() time.Time {
+	return dr.table.LastUpdated()
+}
+
+// Number returns the 0-based row number of the record in the table
+func (rec *Record) Number() int {
+	return rec.number
+}
+
+// IsDeleted returns whether the record has been marked as deleted
+func (rec *Record) IsDeleted() bool {
+	return rec.data[recordDeletionFlagIndex] == recordIsDeleted
+}
+
+// FieldValue returns the content of the field with the given index as a string, as DbfTable.FieldValue() does
+func (rec *Record) FieldValue(fieldIndex int) (value string) {
+	offset := rec.fieldOffsets[fieldIndex]
+	temp := rec.data[offset : offset+rec.fieldLengths[fieldIndex]]
+
+	enforceBlankPadding(temp)
+
+	return strings.TrimSpace(rec.dr.table.decoder.ConvertString(string(temp)))
+}
+
+// FieldValueByName returns the content of the field with the given name as a string
+func (rec *Record) FieldValueByName(fieldName string) (value string, err error) {
+	fieldIndex, err := rec.fieldIndex(fieldName)
+	if err != nil {
+		return "", err
+	}
+	return rec.FieldValue(fieldIndex), nil
+}
+
+// Value returns the value of the field with the given index, typed by the field's type:
+// a string for Character fields, an int64 for Numeric fields without decimal places, a float64 for other Numeric and
+// Float fields, a bool for Logical fields and a time.Time for Date fields, assuming time.Local.
+// Blank Numeric, Float, Logical and Date values are returned as nil.
+func (rec *Record) Value(fieldIndex int) (value interface{}, err error) {
+	field := rec.dr.table.fields[fieldIndex]
+	valueAsString := rec.FieldValue(fieldIndex)
+
+	if field.fieldType == Character {
+		return valueAsString, nil
+	}
+	if valueAsString == "" {
+		return nil, nil
+	}
+
+	switch field.fieldType {
+	case Numeric:
+		if field.decimalPlaces == 0 {
+			if intValue, intErr := strconv.ParseInt(valueAsString, 10, 64); intErr == nil {
+				return intValue, nil
+			}
+		}
+		return strconv.ParseFloat(valueAsString, 64)
+	case Float:
+		return strconv.ParseFloat(valueAsString, 64)
+	case Logical:
+		switch valueAsString {
+		case "T", "t", "Y", "y":
+			return true, nil
+		case "F", "f", "N", "n":
+			return false, nil
+		case "?":
+			return nil, nil
+		}
+		return nil, errors.New("Logical value \"" + valueAsString + "\" of field \"" + field.name + "\" is invalid")
+	case Date:
+		return time.ParseInLocation("20060102", valueAsString, time.Local)
+	}
+	return valueAsString, nil
+}
+
+// ValueByName returns the value of the field with the given name, typed as per Value()
+func (rec *Record) ValueByName(fieldName string) (value interface{}, err error) {
+	fieldIndex, err := rec.fieldIndex(fieldName)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Value(fieldIndex)
+}
+
+// Values returns the values of all fields of the record, typed as per Value()
+func (rec *Record) Values() ([]interface{}, error) {
+	values := make([]interface{}, len(rec.fieldOffsets))
+	for i := range values {
+		value, err := rec.Value(i)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// Float64FieldValueByName returns the value of the field with the given name as a float64
+func (rec *Record) Float64FieldValueByName(fieldName string) (value float64, err error) {
+	valueAsString, err := rec.FieldValueByName(fieldName)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(valueAsString, 64)
+}
+
+// Int64FieldValueByName returns the value of the field with the given name as an int64
+func (rec *Record) Int64FieldValueByName(fieldName string) (value int64, err error) {
+	valueAsString, err := rec.FieldValueByName(fieldName)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(valueAsString, 0, 64)
+}
+
+// GetAsSlice return the values of the record as a string slice
+func (rec *Record) GetAsSlice() []string {
+	s := make([]string, len(rec.fieldOffsets))
+
+	for i := range s {
+		s[i] = rec.FieldValue(i)
+	}
+
+	return s
+}
+
+func (rec *Record) fieldIndex(fieldName string) (int, error) {
+	if fieldIndex, found := rec.dr.fieldMap[fieldName]; found {
+		return fieldIndex, nil
+	}
+	return -1, errors.New("Field name \"" + fieldName + "\" does not exist")
+}
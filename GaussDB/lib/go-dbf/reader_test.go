@@ -0,0 +1,185 @@
+package godbf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNewReader_ValidFile_RecordsAreCorrect(t *testing.T) {
+	g := NewGomegaWithT(t)
+	reader = io.ReadFull
+
+	f, openErr := os.Open(validTestFile)
+	g.Expect(openErr).To(BeNil())
+	defer f.Close()
+
+	readerUnderTest, readerErr := NewReader(f, testEncoding)
+	g.Expect(readerErr).To(BeNil())
+
+	verifyReaderIsCorrect(readerUnderTest, g)
+}
+
+func TestNewReader_GzipStream_RecordsAreCorrect(t *testing.T) {
+	g := NewGomegaWithT(t)
+	reader = io.ReadFull
+
+	rawFileBytes, loadErr := ioutil.ReadFile(validTestFile)
+	g.Expect(loadErr).To(BeNil())
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(rawFileBytes)
+	zw.Close()
+
+	zr, gzipErr := gzip.NewReader(&compressed)
+	g.Expect(gzipErr).To(BeNil())
+
+	readerUnderTest, readerErr := NewReader(zr, testEncoding)
+	g.Expect(readerErr).To(BeNil())
+
+	verifyReaderIsCorrect(readerUnderTest, g)
+}
+
+func verifyReaderIsCorrect(readerUnderTest *Reader, g *GomegaWithT) {
+	expectedFieldNames := []string{"TESTBOOL", "TESTTEXT", "TESTDATE", "TESTNUM", "TESTFLOAT"}
+	g.Expect(readerUnderTest.FieldNames()).To(Equal(expectedFieldNames))
+	g.Expect(readerUnderTest.NumberOfRecords()).To(BeNumerically("==", 3))
+
+	// The date field is encoded with 10 bytes, which the Reader takes into account for the float field that follows.
+	expectedRecordData := [][]string{
+		{"T", "test0", "20180101", "42", "42.010000"},
+		{"F", "test1", "20180102", "43", "43.020000"},
+		{"T", "test2", "20180103", "44", "44.030000"},
+	}
+
+	var actualRecordData [][]string
+	for readerUnderTest.Next() {
+		record := readerUnderTest.Record()
+		g.Expect(record.Number()).To(Equal(len(actualRecordData)))
+		g.Expect(record.IsDeleted()).To(BeFalse())
+		actualRecordData = append(actualRecordData, record.GetAsSlice())
+	}
+	g.Expect(readerUnderTest.Err()).To(BeNil())
+	g.Expect(actualRecordData).To(Equal(expectedRecordData))
+	g.Expect(readerUnderTest.Next()).To(BeFalse())
+}
+
+func TestReader_Values_AreTyped(t *testing.T) {
+	g := NewGomegaWithT(t)
+	reader = io.ReadFull
+
+	rawFileBytes, loadErr := ioutil.ReadFile(validTestFile)
+	g.Expect(loadErr).To(BeNil())
+
+	readerUnderTest, readerErr := NewReader(bytes.NewReader(rawFileBytes), testEncoding)
+	g.Expect(readerErr).To(BeNil())
+	g.Expect(readerUnderTest.Next()).To(BeTrue())
+
+	values, valuesErr := readerUnderTest.Record().Values()
+	g.Expect(valuesErr).To(BeNil())
+
+	expectedValues := []interface{}{true, "test0", time.Date(2018, 1, 1, 0, 0, 0, 0, time.Local), int64(42), 42.01}
+	g.Expect(values).To(Equal(expectedValues))
+
+	floatValue, floatErr := readerUnderTest.Record().Float64FieldValueByName("TESTFLOAT")
+	g.Expect(floatErr).To(BeNil())
+	g.Expect(floatValue).To(Equal(42.01))
+
+	_, missingErr := readerUnderTest.Record().ValueByName("MISSING")
+	g.Expect(missingErr).ToNot(BeNil())
+}
+
+func TestReader_BlankValues_AreNil(t *testing.T) {
+	g := NewGomegaWithT(t)
+	reader = io.ReadFull
+
+	table := New(testEncoding)
+	table.AddBooleanField("boolField")
+	table.AddDateField("dateField")
+	table.AddNumberField("numField", 3, 0)
+	table.AddTextField("textField", 10)
+	table.AddNewRecord()
+
+	readerUnderTest, readerErr := NewReader(bytes.NewReader(table.dataStore), testEncoding)
+	g.Expect(readerErr).To(BeNil())
+	g.Expect(readerUnderTest.Next()).To(BeTrue())
+
+	values, valuesErr := readerUnderTest.Record().Values()
+	g.Expect(valuesErr).To(BeNil())
+	g.Expect(values).To(Equal([]interface{}{nil, nil, nil, ""}))
+}
+
+func TestReader_LessThanActualRecords_ReadsHeaderRecords(t *testing.T) {
+	g := NewGomegaWithT(t)
+	reader = io.ReadFull
+
+	f, openErr := os.Open(lessThanActualRecordsFile)
+	g.Expect(openErr).To(BeNil())
+	defer f.Close()
+
+	readerUnderTest, readerErr := NewReader(f, testEncoding)
+	g.Expect(readerErr).To(BeNil())
+
+	recordsRead := 0
+	for readerUnderTest.Next() {
+		recordsRead++
+	}
+
+	g.Expect(readerUnderTest.Err()).To(BeNil())
+	g.Expect(recordsRead).To(Equal(readerUnderTest.NumberOfRecords()))
+}
+
+func TestReader_TruncatedContent_Errors(t *testing.T) {
+	g := NewGomegaWithT(t)
+	reader = io.ReadFull
+
+	rawFileBytes, loadErr := ioutil.ReadFile(validTestFile)
+	g.Expect(loadErr).To(BeNil())
+
+	readerUnderTest, readerErr := NewReader(bytes.NewReader(rawFileBytes[:len(rawFileBytes)-10]), testEncoding)
+	g.Expect(readerErr).To(BeNil())
+
+	recordsRead := 0
+	for readerUnderTest.Next() {
+		recordsRead++
+	}
+
+	g.Expect(recordsRead).To(Equal(2))
+	g.Expect(readerUnderTest.Err()).ToNot(BeNil())
+	t.Log(readerUnderTest.Err())
+}
+
+func TestNewReader_EndOfFieldMarkerMissing_Errors(t *testing.T) {
+	g := NewGomegaWithT(t)
+	reader = io.ReadFull
+
+	rawFileBytes, loadErr := ioutil.ReadFile(validTestFile)
+	g.Expect(loadErr).To(BeNil())
+
+	const startByteOfFirstFieldName = 32
+	for i := startByteOfFirstFieldName; i <= startByteOfFirstFieldName+fieldNameByteLength; i++ {
+		rawFileBytes[i] = 0x41 // UTF-8 'A'
+	}
+
+	_, readerErr := NewReader(bytes.NewReader(rawFileBytes), testEncoding)
+	g.Expect(readerErr).ToNot(BeNil())
+	g.Expect(readerErr.Error()).To(ContainSubstring("end-of-field marker missing"))
+}
+
+func TestNewReader_ReaderErrors_Errors(t *testing.T) {
+	g := NewGomegaWithT(t)
+	reader = errorReader
+	defer func() { reader = io.ReadFull }()
+
+	_, readerErr := NewReader(bytes.NewReader(make([]byte, 64)), testEncoding)
+
+	g.Expect(readerErr).ToNot(BeNil())
+	t.Log(readerErr)
+}
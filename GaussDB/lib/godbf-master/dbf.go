@@ -27,6 +27,9 @@ type DBF struct {
 	decoder mahonia.Decoder
 	append bool
 	filelock tryLockerSafe
+	memo *memoFile  //备注文件，没有备注字段的时候为nil
+	memoValues map[string][]byte  //还没有提交的备注数据
+	nullFlags *dbfField  //VFP的_NullFlags字段，没有的时候为nil
 }
 
 func LoadFrom(filename string, encoding string) (dbf *DBF, err error) {
@@ -53,6 +56,13 @@ func LoadFrom(filename string, encoding string) (dbf *DBF, err error) {
 	if err != nil {
 		return nil, err
 	}
+	if dbf.hasMemoFields() {
+		// 备注文件不存在的话，只是不能读写备注字段
+		dbf.memo, err = openMemoFile(filename, fileType(dbf.head.fileType))
+		if err != nil && err != memo_file_not_exists {
+			return nil, err
+		}
+	}
 	dbf.recordBuff = bytes.Repeat([]byte{space}, int(dbf.head.recordSize))
 	dbf.eof = dbf.head.recordCount == 0
 	return dbf, nil
@@ -87,6 +97,7 @@ func (dbf *DBF)readFields() error {
 		return err
 	}
 	// 字段个数，每个字段32位，DBF文件头固定32位，文件头结束标志0x0D占1位
+	// VFP文件头结束标志后面还有263位的backlink，所以读到结束标志为止
 	fieldsCount := (dbf.head.dataOffset - 32 -1) / 32
 	dbf.fieldsMap = make(map[string]dbfField, fieldsCount)
 	for i:=0; i<int(fieldsCount); i++ {
@@ -95,6 +106,9 @@ func (dbf *DBF)readFields() error {
 		if err != nil {
 			return err
 		}
+		if fieldBuff[0] == headerTerminator {
+			break
+		}
 		field := dbfField{
 			name:              dbf.decoder.ConvertString(strings.TrimSpace(strings.Trim(bytes2str(fieldBuff[:11]), bytes2str([]byte{0})))),
 			fieldType:         fieldType(fieldBuff[11]),
@@ -110,6 +124,7 @@ func (dbf *DBF)readFields() error {
 		dbf.fieldsMap[field.name] = field
 	}
 	dbf.fieldsCount = len(dbf.fieldsList)
+	dbf.assignNullFlagBits()
 	return nil
 }
 
@@ -139,6 +154,7 @@ func (dbf *DBF)Go(recordNo uint32) error {
 	}
 	dbf.currentRecordNo = recordNo
 	dbf.eof = dbf.currentRecordNo >= dbf.head.recordCount
+	dbf.memoValues = nil
 	return nil
 }
 
@@ -159,6 +175,9 @@ func (dbf *DBF)Next() error {
 }
 
 func (dbf *DBF)Close() error {
+	if dbf.memo != nil {
+		dbf.memo.close()
+	}
 	if dbf.file != nil {
 		return dbf.file.Close()
 	}
@@ -169,15 +188,23 @@ func (dbf *DBF)RecordCount() uint32 {
 	return dbf.head.recordCount
 }
 
+// FieldNames 字段名，不包括VFP的_NullFlags系统字段
 func (dbf *DBF)FieldNames() []string {
-	var fieldNames []string
+	fieldNames := make([]string, 0, dbf.FieldsCount())
 	for _, f := range dbf.fieldsList {
+		if f.fieldType == fieldtype_nullFlags {
+			continue
+		}
 		fieldNames = append(fieldNames, f.name)
 	}
 	return fieldNames
 }
 
+// FieldsCount 字段个数，和FieldNames一致，不包括VFP的_NullFlags系统字段
 func (dbf *DBF)FieldsCount() int {
+	if dbf.nullFlags != nil {
+		return dbf.fieldsCount - 1
+	}
 	return dbf.fieldsCount
 }
 
@@ -186,7 +213,14 @@ func (dbf *DBF)StringValueByName(fieldname string) (value string, err error) {
 	if !ok {
 		return "", field_not_exists
 	}
-	return strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)]))), nil
+	if isMemoField(field.fieldType) {
+		data, err := dbf.memoValue(field)
+		if err != nil {
+			return "", err
+		}
+		return dbf.decoder.ConvertString(bytes2str(data)), nil
+	}
+	return dbf.fieldText(field), nil
 }
 
 func (dbf *DBF)DecimalValueByName(fieldname string) (value decimal.Decimal, err error) {
@@ -194,7 +228,7 @@ func (dbf *DBF)DecimalValueByName(fieldname string) (value decimal.Decimal, err
 	if !ok {
 		return decimal.Zero, field_not_exists
 	}
-	return decimal.NewFromString(strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)]))))
+	return decimal.NewFromString(dbf.fieldText(field))
 }
 
 func (dbf *DBF)DecimalValueByNameX(fieldname string) (value decimal.Decimal) {
@@ -202,7 +236,7 @@ func (dbf *DBF)DecimalValueByNameX(fieldname string) (value decimal.Decimal) {
 	if !ok {
 		return decimal.Zero
 	}
-	value, _ = decimal.NewFromString(strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)]))))
+	value, _ = decimal.NewFromString(dbf.fieldText(field))
 	return value
 }
 
@@ -211,7 +245,11 @@ func (dbf *DBF)StringValueByNameX(fieldname string) (value string) {
 	if !ok {
 		return ""
 	}
-	return strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)])))
+	if isMemoField(field.fieldType) {
+		data, _ := dbf.memoValue(field)
+		return dbf.decoder.ConvertString(bytes2str(data))
+	}
+	return dbf.fieldText(field)
 }
 
 func (dbf *DBF)IntValueByName(fieldname string) (value int, err error) {
@@ -219,7 +257,7 @@ func (dbf *DBF)IntValueByName(fieldname string) (value int, err error) {
 	if !ok {
 		return 0, field_not_exists
 	}
-	return strconv.Atoi(strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)]))))
+	return strconv.Atoi(dbf.fieldText(field))
 }
 
 func (dbf *DBF)IntValueByNameX(fieldname string) (value int) {
@@ -227,7 +265,7 @@ func (dbf *DBF)IntValueByNameX(fieldname string) (value int) {
 	if !ok {
 		return 0
 	}
-	value, _ = strconv.Atoi(strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)]))))
+	value, _ = strconv.Atoi(dbf.fieldText(field))
 	return value
 }
 
@@ -236,7 +274,7 @@ func (dbf *DBF)FloatValueByName(fieldname string) (value float64, err error) {
 	if !ok {
 		return 0, field_not_exists
 	}
-	return strconv.ParseFloat(strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)]))), 64)
+	return strconv.ParseFloat(dbf.fieldText(field), 64)
 }
 
 func (dbf *DBF)FloatValueByNameX(fieldname string) (value float64) {
@@ -244,28 +282,39 @@ func (dbf *DBF)FloatValueByNameX(fieldname string) (value float64) {
 	if !ok {
 		return 0
 	}
-	value, _ = strconv.ParseFloat(strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)]))), 64)
+	value, _ = strconv.ParseFloat(dbf.fieldText(field), 64)
 	return value
 }
 
+// BytesValueByName 返回字段的原始数据，备注字段返回备注文件里面的数据，可以是文本，也可以是二进制
+func (dbf *DBF)BytesValueByName(fieldname string) (value []byte, err error) {
+	field, ok := dbf.fieldsMap[fieldname]
+	if !ok {
+		return nil, field_not_exists
+	}
+	if isMemoField(field.fieldType) {
+		return dbf.memoValue(field)
+	}
+	if isVarLengthField(field.fieldType) {
+		return append([]byte(nil), dbf.varValue(field)...), nil
+	}
+	return append([]byte(nil), dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)]...), nil
+}
+
 func (dbf *DBF)IsDeleted() bool {
 	return dbf.recordBuff[0] == deletedFlag
 }
 
 func (dbf *DBF)Append()  {
 	dbf.append = true
+	dbf.memoValues = nil
 	dbf.recordBuff = bytes.Repeat([]byte{space}, int(dbf.head.recordSize))
+	// 先清空_NullFlags，变长字段的默认值会设置长度标志
+	if dbf.nullFlags != nil {
+		copy(dbf.fieldBuff(*dbf.nullFlags), make([]byte, dbf.nullFlags.length))
+	}
 	for _, field := range dbf.fieldsList {
-		switch field.fieldType {
-		case fieldtype_float:
-			copy(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)], strconv.FormatFloat(0, 'f', int(field.decimalPlaces), 64))
-		case fieldtype_logical:
-			copy(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)], strconv.FormatFloat(0, 'f', int(field.decimalPlaces), 64))
-		case fieldtype_numeric:
-			copy(dbf.recordBuff[field.displacement: field.displacement+uint32(field.length)], strconv.FormatFloat(0, 'f', int(field.decimalPlaces), 64))
-		default:
-			//其余的全部当成字符串处理, 不需要做任何操作，默认空字符串
-		}
+		dbf.blankField(field)
 	}
 }
 
@@ -274,7 +323,29 @@ func (dbf *DBF)SetFieldValue(fieldname string, value string) error {
 	if !ok {
 		return field_not_exists
 	}
-	copy(dbf.recordBuff[field.displacement: field.displacement + uint32(field.length)], str2bytes(dbf.encoder.ConvertString(value)))
+	if isMemoField(field.fieldType) {
+		dbf.setMemoValue(field, []byte(dbf.encoder.ConvertString(value)))
+		return nil
+	}
+	return dbf.setFieldText(field, value)
+}
+
+// SetFieldBytes 设置字段的原始数据，备注字段可以保存二进制数据，在Post的时候写到备注文件里面
+func (dbf *DBF)SetFieldBytes(fieldname string, value []byte) error {
+	field, ok := dbf.fieldsMap[fieldname]
+	if !ok {
+		return field_not_exists
+	}
+	if isMemoField(field.fieldType) {
+		dbf.setMemoValue(field, append([]byte(nil), value...))
+		return nil
+	}
+	if isVarLengthField(field.fieldType) {
+		dbf.setVarValue(field, value)
+	} else {
+		copy(dbf.recordBuff[field.displacement: field.displacement + uint32(field.length)], value)
+	}
+	dbf.setFlagBit(field.nullBit, false)
 	return nil
 }
 
@@ -292,6 +363,10 @@ func (dbf *DBF)Post() (err error) {
 		return err
 	}
 	defer dbf.filelock.unlock()
+	// 先保存备注，把备注的块号写到记录里面
+	if err = dbf.postMemoValues(); err != nil {
+		return err
+	}
 	if !dbf.append {
 		// update
 		_, err = dbf.file.WriteAt(dbf.recordBuff, int64(dbf.head.dataOffset) + int64(dbf.currentRecordNo - 1) * int64(dbf.head.recordSize))
@@ -341,16 +416,9 @@ func NewFile(filename string, encoding string) *DBF {
 }
 
 func (dbf *DBF) addField(fieldName string, fieldType fieldType, length uint8, precision uint8) {
-	// 第1位是删除标记
-	var displacement uint32 = 1
-	if dbf.fieldsCount > 0 {
-		prevField := dbf.fieldsList[dbf.fieldsCount - 1]
-		displacement = prevField.displacement + uint32(prevField.length)
-	}
 	field := dbfField{
 		name:              fieldName,
 		fieldType:         fieldType,
-		displacement:      displacement,
 		length:            length,
 		decimalPlaces:     precision,
 		flag:              0,
@@ -359,11 +427,8 @@ func (dbf *DBF) addField(fieldName string, fieldType fieldType, length uint8, pr
 		reserved:          make([]byte, 20),
 	}
 	dbf.fieldsList = append(dbf.fieldsList, field)
-	dbf.fieldsCount += 1
-	dbf.fieldsMap[field.name] = field
-	dbf.head.recordSize = dbf.head.recordSize + uint16(length)
-	//32位长度的header + 字段描述个数 * 每个字段描述32位长度 + 1位文件头结束符
-	dbf.head.dataOffset = uint16(32 + 32 * dbf.fieldsCount + 1)
+	// 计算字段位置、记录长度和数据开始的位置
+	dbf.layoutFields()
 }
 
 func (dbf *DBF)AddBooleanField(fieldName string) {
@@ -386,13 +451,24 @@ func (dbf *DBF)AddFloatField(fieldName string, length uint8, precision uint8) {
 	dbf.addField(fieldName, fieldtype_float, length, precision)
 }
 
+// AddMemoField 新增备注字段，新文件会变成带备注的FoxPro文件，备注保存在同名的.fpt文件里面
+// VFP文件的备注字段是4位二进制块号
+func (dbf *DBF)AddMemoField(fieldName string) {
+	if dbf.isVisualFoxPro() {
+		dbf.addField(fieldName, fieldtype_memo, 4, 0)
+		return
+	}
+	dbf.head.fileType = byte(foxPro2_Memo)
+	dbf.addField(fieldName, fieldtype_memo, 10, 0)
+}
+
 func (dbf *DBF)FileName() string {
 	return dbf.filename
 }
 
 func (dbf *DBF)SaveNewFile() (err error) {
-	// 32位文件头，dbf.fieldsCount * 32位字段长度，1位文件头结束标记，1位文件尾结束标记
-	fileBuff := make([]byte, 32 + dbf.fieldsCount * 32 + 1 + 1)
+	// 32位文件头，dbf.fieldsCount * 32位字段长度，1位文件头结束标记，(VFP的263位backlink，)1位文件尾结束标记
+	fileBuff := make([]byte, int(dbf.head.dataOffset) + 1)
 	// 新文件的头
 	fileBuff[0] = dbf.head.fileType
 	fileBuff[1] = dbf.head.updateYear
@@ -402,6 +478,9 @@ func (dbf *DBF)SaveNewFile() (err error) {
 	binary.LittleEndian.PutUint16(fileBuff[8:10], dbf.head.dataOffset)
 	binary.LittleEndian.PutUint16(fileBuff[10:12], dbf.head.recordSize)
 	copy(fileBuff[12:32], dbf.head.reserved)
+	if dbf.isVisualFoxPro() && dbf.hasMemoFields() {
+		fileBuff[28] |= vfpTableFlagMemo
+	}
 	// 字段描述
 	// 字段名，最大10位，如果不足10位，用0x00填充
 	blankFieldName := bytes.Repeat([]byte{null}, 10)
@@ -418,7 +497,7 @@ func (dbf *DBF)SaveNewFile() (err error) {
 		fileBuff[32 + i*32 + 23] = field.autoincrementStep
 		copy(fileBuff[32 + i*32 + 24: 32 + i*32 + 32], blankFieldName)
 	}
-	fileBuff[len(fileBuff)-2] = headerTerminator
+	fileBuff[32 + dbf.fieldsCount * 32] = headerTerminator
 	fileBuff[len(fileBuff)-1] = fileTerminator
 	dbf.headBuff = fileBuff[:32]
 	if len(dbf.recordBuff) == 0 {
@@ -434,6 +513,11 @@ func (dbf *DBF)SaveNewFile() (err error) {
 		return err
 	}
 	defer dbf.filelock.unlock()
-	_, err = dbf.file.Write(fileBuff)
+	if _, err = dbf.file.Write(fileBuff); err != nil {
+		return err
+	}
+	if dbf.hasMemoFields() {
+		dbf.memo, err = createMemoFile(dbf.filename, fileType(dbf.head.fileType))
+	}
 	return err
 }
\ No newline at end of file
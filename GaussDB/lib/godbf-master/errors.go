@@ -7,4 +7,13 @@ var (
 	field_not_exists = errors.New("field name not exists")
 	empty_fields = errors.New("no fields found")
 	errLocked = errors.New("file already locked by other process")
+	memo_file_not_exists = errors.New("memo file not exists")
+	memo_block_invalid = errors.New("invalid memo block")
+	field_type_mismatch = errors.New("field type mismatch")
+	field_not_nullable = errors.New("field not nullable")
+	file_already_saved = errors.New("file already saved")
+	struct_pointer_required = errors.New("struct or pointer to struct required")
+	field_type_not_supported = errors.New("field type not supported")
+	field_length_required = errors.New("field length required")
+	value_too_wide = errors.New("value too wide for field")
 )
\ No newline at end of file
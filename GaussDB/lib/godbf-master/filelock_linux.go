@@ -13,7 +13,7 @@ import (
 //
 // constants from /usr/include/bits/fcntl-linux.h
 const (
-	F_OFD_GETLK  = 37
+	F_OFD_GETLK  = 36
 	F_OFD_SETLK  = 37
 	F_OFD_SETLKW = 38
 )
@@ -53,7 +53,7 @@ type lock struct {
 }
 
 // New creates a new lock
-func newlock(file *os.File) tryLockerSafe {
+func newLock(file *os.File) tryLockerSafe {
 	l := &lock{
 		file: file,
 	}
@@ -75,9 +75,8 @@ func (l *lock) unlock() error {
 	return linuxUnlockFile(l.file.Fd())
 }
 
-func ofdTryLockFile(fd int) (bool, error) {
-	flock := wrlck
-	if err := syscall.FcntlFlock(uintptr(fd), F_OFD_SETLK, &flock); err != nil {
+func flockTryLockFile(fd uintptr) (bool, error) {
+	if err := syscall.Flock(int(fd), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
 		if err == syscall.EWOULDBLOCK {
 			return false, errLocked
 		}
@@ -86,17 +85,36 @@ func ofdTryLockFile(fd int) (bool, error) {
 	return true, nil
 }
 
-func ofdLockFile(fd int) error {
+func flockLockFile(fd uintptr) error {
+	return syscall.Flock(int(fd), syscall.LOCK_EX)
+}
+
+func flockUnlockFile(fd uintptr) error {
+	return syscall.Flock(int(fd), syscall.LOCK_UN)
+}
+
+func ofdTryLockFile(fd uintptr) (bool, error) {
+	flock := wrlck
+	if err := syscall.FcntlFlock(fd, F_OFD_SETLK, &flock); err != nil {
+		if err == syscall.EAGAIN || err == syscall.EACCES {
+			return false, errLocked
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func ofdLockFile(fd uintptr) error {
 	flock := wrlck
-	return syscall.FcntlFlock(uintptr(fd), F_OFD_SETLKW, &flock)
+	return syscall.FcntlFlock(fd, F_OFD_SETLKW, &flock)
 }
 
-func ofdUnlockFile(fd int) error {
+func ofdUnlockFile(fd uintptr) error {
 	flock := unlck
-	return syscall.FcntlFlock(uintptr(fd), F_OFD_SETLKW, &flock)
+	return syscall.FcntlFlock(fd, F_OFD_SETLKW, &flock)
 }
 
 // Check the interfaces are satisfied
 var (
-	_ TryLockerSafe = &lock{}
+	_ tryLockerSafe = &lock{}
 )
@@ -1,6 +1,7 @@
 package godbf
 
 import (
+	"path/filepath"
 	"strconv"
 	"testing"
 )
@@ -26,6 +27,33 @@ func BenchmarkNewDBF_Append(b *testing.B) {
 	}
 }
 
+func BenchmarkWriter_Append(b *testing.B) {
+	dbf := NewFile(filepath.Join(b.TempDir(), "test_writer.dbf"), "gbk")
+	defer dbf.Close()
+	dbf.AddDateField("BEGIN_DATE")
+	dbf.AddDateField("END_DATE")
+	dbf.AddFloatField("PRICE", 12, 2)
+	dbf.AddNumericField("QTY", 8, 2)
+	dbf.AddBooleanField("FINISHED")
+	dbf.AddStringField("STOCK_CODE", 20)
+	w := dbf.NewWriter(10000)
+	for i:=0; i<b.N; i++ {
+		w.Append()
+		dbf.SetFieldValue("BEGIN_DATE", "20201213")
+		dbf.SetFieldValue("END_DATE", "20210605")
+		dbf.SetFieldValue("PRICE", "12.34")
+		dbf.SetFieldValue("QTY", strconv.FormatInt(int64(i), 10))
+		dbf.SetFieldValue("STOCK_CODE", "600570")
+		dbf.SetFieldValue("FINISHED", "T")
+		if err := w.Post(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		b.Fatal(err)
+	}
+}
+
 func BenchmarkDBF_Next(b *testing.B) {
 	dbf, err := LoadFrom("./testdata/test_5million.DBF", "gbk")
 	if err != nil {
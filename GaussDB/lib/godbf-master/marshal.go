@@ -0,0 +1,529 @@
+package godbf
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+/*
+	结构体和记录的映射，字段用dbf标签说明：
+	`dbf:"SCDM,len=6"`            字段名SCDM，长度6
+	`dbf:"CJJG,len=12,dec=3"`     长度12，3位小数
+	`dbf:"CJSJ,type=T"`           指定字段类型，默认按Go类型确定
+	`dbf:"BZ,len=20,null"`        可以为null，指针为nil的时候保存null
+	`dbf:"-"`                     忽略
+	没有标签的导出字段，字段名是大写的Go字段名
+	没有标签的嵌入结构体(不是指针)，它的字段当成外层的字段，同名的时候用外层的字段
+	Go类型和字段类型：string C，bool L，整数 N，浮点数和decimal.Decimal N，time.Time D，[]byte M
+*/
+
+const defaultNumericLength = 20
+const defaultIntegerLength = 18
+const defaultDecimalPlaces = 6
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	decimalType = reflect.TypeOf(decimal.Decimal{})
+	bytesType   = reflect.TypeOf([]byte(nil))
+)
+
+type structField struct {
+	index     []int
+	name      string
+	fieldType fieldType
+	length    uint8
+	decimals  uint8
+	hasDec    bool
+	nullable  bool
+}
+
+var structFieldsCache sync.Map // map[reflect.Type][]structField
+
+// structFields 解析结构体的dbf标签，结果按类型缓存
+func structFields(t reflect.Type) ([]structField, error) {
+	if fields, ok := structFieldsCache.Load(t); ok {
+		return fields.([]structField), nil
+	}
+	fields, err := typeFields(t, nil)
+	if err != nil {
+		return nil, err
+	}
+	// 和encoding/json一样，嵌入的结构体里面的字段和外层的字段同名的时候，用外层的
+	depth := make(map[string]int, len(fields))
+	for _, sf := range fields {
+		if d, ok := depth[sf.name]; !ok || len(sf.index) < d {
+			depth[sf.name] = len(sf.index)
+		}
+	}
+	visible := fields[:0]
+	for _, sf := range fields {
+		if len(sf.index) == depth[sf.name] {
+			visible = append(visible, sf)
+			depth[sf.name] = -1
+		}
+	}
+	structFieldsCache.Store(t, visible)
+	return visible, nil
+}
+
+// isEmbeddedStruct 没有标签的嵌入结构体，它的字段当成外层的字段
+func isEmbeddedStruct(f reflect.StructField) bool {
+	return f.Anonymous && f.Tag.Get("dbf") == "" && f.Type.Kind() == reflect.Struct &&
+		f.Type != timeType && f.Type != decimalType
+}
+
+func typeFields(t reflect.Type, index []int) ([]structField, error) {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		f.Index = append(append([]int(nil), index...), i)
+		if isEmbeddedStruct(f) {
+			embedded, err := typeFields(f.Type, f.Index)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, embedded...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := f.Tag.Get("dbf")
+		if tag == "-" {
+			continue
+		}
+		sf := structField{index: f.Index, name: strings.ToUpper(f.Name)}
+		parts := strings.Split(tag, ",")
+		if parts[0] != "" {
+			sf.name = parts[0]
+		}
+		for _, opt := range parts[1:] {
+			key, value := opt, ""
+			if i := strings.IndexByte(opt, '='); i >= 0 {
+				key, value = opt[:i], opt[i+1:]
+			}
+			switch key {
+			case "len", "dec":
+				n, err := strconv.ParseUint(value, 10, 8)
+				if err != nil {
+					return nil, fmt.Errorf("dbf tag of %s.%s: %w", t.Name(), f.Name, err)
+				}
+				if key == "len" {
+					sf.length = uint8(n)
+				} else {
+					sf.decimals, sf.hasDec = uint8(n), true
+				}
+			case "type":
+				if len(value) != 1 {
+					return nil, fmt.Errorf("dbf tag of %s.%s: %w", t.Name(), f.Name, field_type_not_supported)
+				}
+				sf.fieldType = fieldType(value[0])
+			case "null":
+				sf.nullable = true
+			default:
+				return nil, fmt.Errorf("dbf tag of %s.%s: unknown option %q", t.Name(), f.Name, opt)
+			}
+		}
+		if sf.fieldType == 0 {
+			sf.fieldType = defaultFieldType(f.Type)
+			if sf.fieldType == 0 {
+				return nil, fmt.Errorf("%s.%s of type %s: %w", t.Name(), f.Name, f.Type, field_type_not_supported)
+			}
+		}
+		fields = append(fields, sf)
+	}
+	return fields, nil
+}
+
+// defaultFieldType 根据Go类型确定字段类型，不支持的类型返回0
+func defaultFieldType(t reflect.Type) fieldType {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return fieldtype_date
+	case decimalType:
+		return fieldtype_numeric
+	case bytesType:
+		return fieldtype_memo
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return fieldtype_character
+	case reflect.Bool:
+		return fieldtype_logical
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fieldtype_numeric
+	}
+	return 0
+}
+
+func structValue(v interface{}, settable bool) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	} else if settable {
+		return reflect.Value{}, struct_pointer_required
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, struct_pointer_required
+	}
+	return rv, nil
+}
+
+// lookupField 先按字段名查找，找不到的话不区分大小写再找一次
+func (dbf *DBF) lookupField(name string) (dbfField, bool) {
+	if field, ok := dbf.fieldsMap[name]; ok {
+		return field, true
+	}
+	for _, field := range dbf.fieldsList {
+		if strings.EqualFold(field.name, name) {
+			return field, true
+		}
+	}
+	return dbfField{}, false
+}
+
+// AddStructFields 按结构体的dbf标签新增字段，v是结构体或者结构体指针，需要在SaveNewFile之前调用
+func (dbf *DBF) AddStructFields(v interface{}) error {
+	if dbf.file != nil {
+		return file_already_saved
+	}
+	rv, err := structValue(v, false)
+	if err != nil {
+		return err
+	}
+	fields, err := structFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	for _, sf := range fields {
+		goType := rv.Type().FieldByIndex(sf.index).Type
+		if goType.Kind() == reflect.Ptr {
+			goType = goType.Elem()
+		}
+		switch sf.fieldType {
+		case fieldtype_character:
+			if sf.length == 0 {
+				return fmt.Errorf("field %s: %w", sf.name, field_length_required)
+			}
+			dbf.AddStringField(sf.name, sf.length)
+		case fieldtype_numeric, fieldtype_float:
+			length, decimals := sf.length, sf.decimals
+			if !sf.hasDec && !isIntegerKind(goType.Kind()) {
+				decimals = defaultDecimalPlaces
+			}
+			if length == 0 {
+				length = defaultNumericLength
+				if isIntegerKind(goType.Kind()) {
+					length = defaultIntegerLength
+				}
+			}
+			if sf.fieldType == fieldtype_float {
+				dbf.AddFloatField(sf.name, length, decimals)
+			} else {
+				dbf.AddNumericField(sf.name, length, decimals)
+			}
+		case fieldtype_logical:
+			dbf.AddBooleanField(sf.name)
+		case fieldtype_date:
+			dbf.AddDateField(sf.name)
+		case fieldtype_memo:
+			dbf.AddMemoField(sf.name)
+		case fieldtype_dateTime:
+			dbf.AddDateTimeField(sf.name)
+		case fieldtype_currency:
+			dbf.AddCurrencyField(sf.name)
+		case fieldtype_integer:
+			dbf.AddIntegerField(sf.name)
+		case fieldtype_double:
+			decimals := sf.decimals
+			if !sf.hasDec {
+				decimals = defaultDecimalPlaces
+			}
+			dbf.AddDoubleField(sf.name, decimals)
+		case fieldtype_varchar, fieldtype_varbinary:
+			if sf.length == 0 {
+				return fmt.Errorf("field %s: %w", sf.name, field_length_required)
+			}
+			if sf.fieldType == fieldtype_varchar {
+				dbf.AddVarcharField(sf.name, sf.length)
+			} else {
+				dbf.AddVarbinaryField(sf.name, sf.length)
+			}
+		default:
+			return fmt.Errorf("field %s: %w", sf.name, field_type_not_supported)
+		}
+		if sf.nullable {
+			if err := dbf.SetFieldNullable(sf.name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isIntegerKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// Unmarshal 把当前记录读到结构体里面，v是结构体指针。
+// 空值读成零值，null读成零值，指针字段读成nil
+func (dbf *DBF) Unmarshal(v interface{}) error {
+	rv, err := structValue(v, true)
+	if err != nil {
+		return err
+	}
+	fields, err := structFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	for _, sf := range fields {
+		field, ok := dbf.lookupField(sf.name)
+		if !ok {
+			return fmt.Errorf("field %s: %w", sf.name, field_not_exists)
+		}
+		if err := dbf.unmarshalField(field, rv.FieldByIndex(sf.index)); err != nil {
+			return fmt.Errorf("field %s: %w", sf.name, err)
+		}
+	}
+	return nil
+}
+
+func (dbf *DBF) unmarshalField(field dbfField, fv reflect.Value) error {
+	if fv.Kind() == reflect.Ptr {
+		if dbf.flagBit(field.nullBit) {
+			fv.Set(reflect.Zero(fv.Type()))
+			return nil
+		}
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		fv = fv.Elem()
+	}
+	switch fv.Type() {
+	case timeType:
+		var t time.Time
+		var err error
+		if field.fieldType == fieldtype_dateTime || field.fieldType == fieldtype_date {
+			t, err = dbf.TimeValueByName(field.name)
+		} else if text := dbf.fieldText(field); text != "" {
+			t, err = parseDateTime(text)
+		}
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	case decimalType:
+		d := decimal.Zero
+		if dbf.fieldText(field) != "" {
+			var err error
+			if d, err = dbf.CurrencyValueByName(field.name); err != nil {
+				return err
+			}
+		}
+		fv.Set(reflect.ValueOf(d))
+		return nil
+	case bytesType:
+		data, err := dbf.BytesValueByName(field.name)
+		if err != nil {
+			return err
+		}
+		fv.SetBytes(data)
+		return nil
+	}
+
+	var text string
+	if isMemoField(field.fieldType) {
+		var err error
+		if text, err = dbf.StringValueByName(field.name); err != nil {
+			return err
+		}
+	} else {
+		text = dbf.fieldText(field)
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(text)
+	case reflect.Bool:
+		switch text {
+		case "T", "t", "Y", "y", "1":
+			fv.SetBool(true)
+		default:
+			fv.SetBool(false)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if text != "" {
+			// 数值字段可能带小数位，比如10.00
+			d, err := decimal.NewFromString(text)
+			if err != nil {
+				return err
+			}
+			n = d.IntPart()
+		}
+		if fv.OverflowInt(n) {
+			return fmt.Errorf("value %s overflows %s", text, fv.Type())
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n int64
+		if text != "" {
+			d, err := decimal.NewFromString(text)
+			if err != nil {
+				return err
+			}
+			n = d.IntPart()
+		}
+		if n < 0 || fv.OverflowUint(uint64(n)) {
+			return fmt.Errorf("value %s overflows %s", text, fv.Type())
+		}
+		fv.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if text != "" {
+			var err error
+			if f, err = strconv.ParseFloat(text, 64); err != nil {
+				return err
+			}
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("%s to %s: %w", string(field.fieldType), fv.Type(), field_type_not_supported)
+	}
+	return nil
+}
+
+// Marshal 把结构体的值写到当前记录，v是结构体或者结构体指针，之后需要调用Post提交。
+// 数值字段右对齐，文本和数值超过字段长度的时候返回错误，nil指针保存成null，字段不能为null的话保存成空值
+func (dbf *DBF) Marshal(v interface{}) error {
+	rv, err := structValue(v, false)
+	if err != nil {
+		return err
+	}
+	fields, err := structFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	for _, sf := range fields {
+		field, ok := dbf.lookupField(sf.name)
+		if !ok {
+			return fmt.Errorf("field %s: %w", sf.name, field_not_exists)
+		}
+		if err := dbf.marshalField(field, rv.FieldByIndex(sf.index)); err != nil {
+			return fmt.Errorf("field %s: %w", sf.name, err)
+		}
+	}
+	return nil
+}
+
+func (dbf *DBF) marshalField(field dbfField, fv reflect.Value) error {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			if field.nullBit >= 0 {
+				return dbf.SetFieldNull(field.name)
+			}
+			if isMemoField(field.fieldType) {
+				return dbf.SetFieldBytes(field.name, nil)
+			}
+			dbf.blankField(field)
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	switch fv.Type() {
+	case timeType:
+		if field.fieldType == fieldtype_dateTime || field.fieldType == fieldtype_date {
+			return dbf.SetFieldTime(field.name, fv.Interface().(time.Time))
+		}
+		return dbf.setFieldPadded(field, fv.Interface().(time.Time).Format(dateLayout))
+	case decimalType:
+		d := fv.Interface().(decimal.Decimal)
+		if field.fieldType == fieldtype_currency {
+			return dbf.SetFieldCurrency(field.name, d)
+		}
+		return dbf.setFieldPadded(field, d.StringFixed(int32(field.decimalPlaces)))
+	case bytesType:
+		return dbf.SetFieldBytes(field.name, fv.Bytes())
+	}
+
+	var text string
+	switch fv.Kind() {
+	case reflect.String:
+		text = fv.String()
+	case reflect.Bool:
+		text = "F"
+		if fv.Bool() {
+			text = "T"
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		text = strconv.FormatInt(fv.Int(), 10)
+		if isNumericText(field.fieldType) && field.decimalPlaces > 0 {
+			text = decimal.New(fv.Int(), 0).StringFixed(int32(field.decimalPlaces))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		text = strconv.FormatUint(fv.Uint(), 10)
+		if isNumericText(field.fieldType) && field.decimalPlaces > 0 {
+			text = decimal.RequireFromString(text).StringFixed(int32(field.decimalPlaces))
+		}
+	case reflect.Float32, reflect.Float64:
+		precision := -1
+		if isNumericText(field.fieldType) {
+			precision = int(field.decimalPlaces)
+		}
+		text = strconv.FormatFloat(fv.Float(), 'f', precision, fv.Type().Bits())
+	default:
+		return fmt.Errorf("%s to %s: %w", fv.Type(), string(field.fieldType), field_type_not_supported)
+	}
+	if isMemoField(field.fieldType) {
+		return dbf.SetFieldValue(field.name, text)
+	}
+	return dbf.setFieldPadded(field, text)
+}
+
+func isNumericText(t fieldType) bool {
+	return t == fieldtype_numeric || t == fieldtype_float
+}
+
+// setFieldPadded 保存文本字段的时候补齐空格，把原来的值全部覆盖，数值字段右对齐。
+// 按编码转换之后超过字段长度的时候返回错误，不截断，避免把一个汉字截成半个
+func (dbf *DBF) setFieldPadded(field dbfField, text string) error {
+	switch field.fieldType {
+	case fieldtype_character, fieldtype_logical, fieldtype_date, fieldtype_varchar:
+		data := dbf.encoder.ConvertString(text)
+		if len(data) > int(field.length) {
+			return fmt.Errorf("value %s: %w", text, value_too_wide)
+		}
+		if field.fieldType == fieldtype_varchar {
+			dbf.setVarValue(field, []byte(data))
+		} else {
+			buff := dbf.fieldBuff(field)
+			for i := copy(buff, data); i < len(buff); i++ {
+				buff[i] = space
+			}
+		}
+		dbf.setFlagBit(field.nullBit, false)
+		return nil
+	case fieldtype_numeric, fieldtype_float:
+		if len(text) > int(field.length) {
+			return fmt.Errorf("value %s: %w", text, value_too_wide)
+		}
+		text = strings.Repeat(" ", int(field.length)-len(text)) + text
+	}
+	return dbf.setFieldText(field, text)
+}
@@ -0,0 +1,226 @@
+package godbf
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type marshalTrade struct {
+	Code   string          `dbf:"SCDM,len=6"`
+	Name   string          `dbf:"ZQJC,len=8"`
+	Price  float64         `dbf:"CJJG,len=12,dec=3"`
+	Qty    int64           `dbf:"CJSL,len=10"`
+	Amount decimal.Decimal `dbf:"CJJE,len=16,dec=2"`
+	Date   time.Time       `dbf:"CJRQ"`
+	At     time.Time       `dbf:"CJSJ,type=T"`
+	Done   bool            `dbf:"WCBZ"`
+	Remark *string         `dbf:"BZ,type=V,len=20,null"`
+	Note   []byte          `dbf:"FJ"`
+	Ignore string          `dbf:"-"`
+}
+
+func newTradeFile(t *testing.T) (*DBF, string) {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "trade.dbf")
+	dbf := NewFile(filename, "gbk")
+	if err := dbf.AddStructFields(marshalTrade{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.SaveNewFile(); err != nil {
+		t.Fatal(err)
+	}
+	return dbf, filename
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	remark := "备注"
+	trades := []marshalTrade{
+		{
+			Code:   "600570",
+			Name:   "恒生电子",
+			Price:  12.345,
+			Qty:    -1200,
+			Amount: decimal.RequireFromString("14814.00"),
+			Date:   time.Date(2021, 6, 5, 0, 0, 0, 0, time.Local),
+			At:     time.Date(2021, 6, 5, 9, 30, 1, 0, time.Local),
+			Done:   true,
+			Remark: &remark,
+			Note:   []byte{0, 1, 2, 0xff},
+		},
+		{Code: "000001"},
+	}
+	dbf, filename := newTradeFile(t)
+	for i := range trades {
+		dbf.Append()
+		if err := dbf.Marshal(&trades[i]); err != nil {
+			t.Fatal(err)
+		}
+		if err := dbf.Post(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dbf.Close()
+
+	dbf, err := LoadFrom(filename, "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if err := dbf.Go(1); err != nil {
+		t.Fatal(err)
+	}
+	// 数值字段右对齐
+	if got := string(dbf.fieldBuff(dbf.fieldsMap["CJSL"])); got != "     -1200" {
+		t.Errorf("CJSL = %q, want right aligned", got)
+	}
+	for i, want := range trades {
+		if err := dbf.Go(uint32(i + 1)); err != nil {
+			t.Fatal(err)
+		}
+		got := marshalTrade{Ignore: "kept"}
+		if err := dbf.Unmarshal(&got); err != nil {
+			t.Fatal(err)
+		}
+		want.Ignore = "kept"
+		if !got.Amount.Equal(want.Amount) {
+			t.Errorf("record %d: Amount = %v, want %v", i+1, got.Amount, want.Amount)
+		}
+		if !bytes.Equal(got.Note, want.Note) {
+			t.Errorf("record %d: Note = %v, want %v", i+1, got.Note, want.Note)
+		}
+		got.Amount, want.Amount = decimal.Zero, decimal.Zero
+		got.Note, want.Note = nil, nil
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("record %d: got %+v, want %+v", i+1, got, want)
+		}
+	}
+}
+
+func TestMarshalTooWide(t *testing.T) {
+	dbf, _ := newTradeFile(t)
+	defer dbf.Close()
+
+	long := "一二三四五六七八九十一"
+	tests := []struct {
+		name  string
+		trade marshalTrade
+		field string
+		want  string
+		err   error
+	}{
+		// 长码两个汉字在GBK里面是4个字节，不能截成600570
+		{"character", marshalTrade{Code: "600570长码"}, "SCDM", "", value_too_wide},
+		{"half character", marshalTrade{Name: "恒生电子A"}, "ZQJC", "", value_too_wide},
+		{"fits", marshalTrade{Name: "恒生电子"}, "ZQJC", "恒生电子", nil},
+		{"numeric", marshalTrade{Qty: 12345678901}, "CJSL", "0", value_too_wide},
+		{"varchar", marshalTrade{Remark: &long}, "BZ", "", value_too_wide},
+	}
+	for _, tt := range tests {
+		dbf.Append()
+		if err := dbf.Marshal(tt.trade); !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+		// 出错的时候字段保持新增记录的默认值
+		if got := dbf.StringValueByNameX(tt.field); got != tt.want {
+			t.Errorf("%s: %s = %q, want %q", tt.name, tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestMarshalNilPointer(t *testing.T) {
+	type row struct {
+		Code  *string  `dbf:"SCDM,len=6"`
+		Qty   *float64 `dbf:"CJSL,len=8,dec=2"`
+		Done  *bool    `dbf:"WCBZ"`
+		Price *float64 `dbf:"CJJG,len=8,dec=2,null"`
+	}
+	dbf := NewFile(filepath.Join(t.TempDir(), "nil.dbf"), "gbk")
+	defer dbf.Close()
+	if err := dbf.AddStructFields(row{}); err != nil {
+		t.Fatal(err)
+	}
+
+	code, qty, done := "600570", 12345.67, true
+	dbf.Append()
+	if err := dbf.Marshal(row{Code: &code, Qty: &qty, Done: &done, Price: &qty}); err != nil {
+		t.Fatal(err)
+	}
+	// 不能为null的字段保存成空值，原来的值要全部覆盖
+	if err := dbf.Marshal(row{}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"SCDM": "      ", "CJSL": "    0.00", "WCBZ": "0"}
+	for name, text := range want {
+		if got := string(dbf.fieldBuff(dbf.fieldsMap[name])); got != text {
+			t.Errorf("%s = %q, want %q", name, got, text)
+		}
+	}
+	if null, err := dbf.IsNullByName("CJJG"); err != nil || !null {
+		t.Errorf("IsNullByName(CJJG) = %v, %v, want true", null, err)
+	}
+
+	var got row
+	if err := dbf.Unmarshal(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Code == nil || *got.Code != "" || got.Qty == nil || *got.Qty != 0 || got.Done == nil || *got.Done {
+		t.Errorf("got %+v, want pointers to zero values", got)
+	}
+	if got.Price != nil {
+		t.Errorf("Price = %v, want nil for null", *got.Price)
+	}
+}
+
+type marshalBase struct {
+	Code string    `dbf:"SCDM,len=6"`
+	Date time.Time `dbf:"CJRQ"`
+	Memo string    `dbf:"BZ,len=4"`
+}
+
+type marshalAudit struct {
+	User string `dbf:"CZY,len=8"`
+}
+
+func TestMarshalEmbedded(t *testing.T) {
+	type row struct {
+		marshalBase
+		*marshalAudit `dbf:"-"`
+		Qty           int64  `dbf:"CJSL,len=10"`
+		Memo          string `dbf:"BZ,len=10"` // 外层的字段优先
+	}
+	filename := filepath.Join(t.TempDir(), "embedded.dbf")
+	dbf := NewFile(filename, "gbk")
+	defer dbf.Close()
+	if err := dbf.AddStructFields(row{}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"SCDM", "CJRQ", "CJSL", "BZ"}; !reflect.DeepEqual(dbf.FieldNames(), want) {
+		t.Fatalf("FieldNames() = %v, want %v", dbf.FieldNames(), want)
+	}
+	if n := dbf.fieldsMap["BZ"].length; n != 10 {
+		t.Errorf("BZ of length %d, want 10 from the outer field", n)
+	}
+
+	want := row{
+		marshalBase: marshalBase{Code: "600570", Date: time.Date(2021, 6, 5, 0, 0, 0, 0, time.Local)},
+		Qty:         100,
+		Memo:        "outer",
+	}
+	dbf.Append()
+	if err := dbf.Marshal(want); err != nil {
+		t.Fatal(err)
+	}
+	var got row
+	if err := dbf.Unmarshal(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
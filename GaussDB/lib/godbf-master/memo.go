@@ -0,0 +1,543 @@
+package godbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+	备注文件结构说明：
+	FoxPro (.fpt)
+		文件头 512位，第1-4位下一个空闲块号(大端)，第7-8位块大小(大端)
+		每条备注从块的开头开始，前4位备注类型(大端，0图片 1文本 2对象)，再4位数据长度(大端)，然后是数据
+	dBASE III (.dbt)
+		文件头 512位，第1-4位下一个空闲块号(小端)，块大小固定512位
+		备注数据以 0x1A 0x1A 结束
+	dBASE IV (.dbt)
+		文件头 512位，第1-4位下一个空闲块号(小端)，第21-22位块大小(小端)
+		每条备注前4位固定 0xFF 0xFF 0x08 0x00，再4位长度(小端，包括这8位)，然后是数据
+	空闲块
+		三种格式都没有通用的空闲块列表，这里把不再使用的块记在文件头第25位开始没有使用的位置：
+		8位标志，2位个数(小端)，然后每段空闲块4位开始块号、4位块数(小端)。
+		每段空闲块的第1块开头也写上标志，其它程序重建或者改写过备注文件的时候对不上，这段就不再使用
+*/
+
+type memoKind uint8
+
+const (
+	memoFoxPro memoKind = iota
+	memoDBase3
+	memoDBase4
+)
+
+// 备注类型，只有FoxPro的备注文件会保存
+const (
+	memoTypePicture uint32 = 0
+	memoTypeText    uint32 = 1
+	memoTypeObject  uint32 = 2
+)
+
+const memoHeaderSize = 512
+const defaultFoxProBlockSize = 64
+const dBase3BlockSize = 512
+const memoTerminator byte = 0x1A //dBASE III备注的结束符号
+const memoFreeListOffset = 24
+const maxMemoFreeExtents = (memoHeaderSize - memoFreeListOffset - 10) / 8
+
+var memoFreeMark = []byte("GODBFREE")
+
+// memoExtent 一段连续的空闲块
+type memoExtent struct {
+	block uint32
+	count uint32
+}
+
+type memoFile struct {
+	file      *os.File
+	kind      memoKind
+	blockSize uint32
+	nextBlock uint32       //下一个空闲块号，写之前需要重新读取
+	free      []memoExtent //文件中间的空闲块，按块号排序，写之前需要重新读取
+}
+
+func isMemoField(t fieldType) bool {
+	return t == fieldtype_memo || t == fieldtype_general || t == fieldtype_picture
+}
+
+// memoKindOf 根据DBF的文件类型判断备注文件的格式，第二个返回值是备注文件的扩展名
+func memoKindOf(t fileType) (memoKind, string) {
+	switch t {
+	case foxBASE_III_Memo:
+		return memoDBase3, ".dbt"
+	case dbase_IV_Memo, dbase_IV_SQL_Table_Memo:
+		return memoDBase4, ".dbt"
+	default:
+		return memoFoxPro, ".fpt"
+	}
+}
+
+// memoFileName 和DBF文件同目录同名的备注文件，扩展名的大小写跟随DBF文件
+func memoFileName(filename string, ext string) string {
+	dbfExt := filepath.Ext(filename)
+	if dbfExt != "" && dbfExt == strings.ToUpper(dbfExt) {
+		ext = strings.ToUpper(ext)
+	}
+	return strings.TrimSuffix(filename, dbfExt) + ext
+}
+
+func openMemoFile(filename string, t fileType) (*memoFile, error) {
+	kind, ext := memoKindOf(t)
+	// 扩展名的大小写有可能和DBF文件不一致
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	var f *os.File
+	var err error
+	for _, name := range []string{memoFileName(filename, ext), base + ext, base + strings.ToUpper(ext)} {
+		if f, err = os.OpenFile(name, os.O_RDWR, 0666); !os.IsNotExist(err) {
+			break
+		}
+	}
+	if os.IsNotExist(err) {
+		return nil, memo_file_not_exists
+	}
+	if err != nil {
+		return nil, err
+	}
+	memo := &memoFile{file: f, kind: kind}
+	if err = memo.readHead(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return memo, nil
+}
+
+// createMemoFile 新建一个空的备注文件
+func createMemoFile(filename string, t fileType) (*memoFile, error) {
+	kind, ext := memoKindOf(t)
+	f, err := os.OpenFile(memoFileName(filename, ext), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	memo := &memoFile{file: f, kind: kind, blockSize: dBase3BlockSize}
+	if kind == memoFoxPro {
+		memo.blockSize = defaultFoxProBlockSize
+	}
+	// 文件头占用的块都不能使用
+	memo.nextBlock = (memoHeaderSize + memo.blockSize - 1) / memo.blockSize
+	head := make([]byte, memoHeaderSize)
+	switch kind {
+	case memoFoxPro:
+		binary.BigEndian.PutUint32(head[0:4], memo.nextBlock)
+		binary.BigEndian.PutUint16(head[6:8], uint16(memo.blockSize))
+	case memoDBase4:
+		binary.LittleEndian.PutUint32(head[0:4], memo.nextBlock)
+		binary.LittleEndian.PutUint16(head[20:22], uint16(memo.blockSize))
+	default:
+		binary.LittleEndian.PutUint32(head[0:4], memo.nextBlock)
+	}
+	if _, err = f.Write(head); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return memo, nil
+}
+
+func (m *memoFile) readHead() error {
+	head := make([]byte, memoHeaderSize)
+	if _, err := m.file.ReadAt(head, 0); err != nil {
+		return err
+	}
+	switch m.kind {
+	case memoFoxPro:
+		m.nextBlock = binary.BigEndian.Uint32(head[0:4])
+		m.blockSize = uint32(binary.BigEndian.Uint16(head[6:8]))
+	case memoDBase4:
+		m.nextBlock = binary.LittleEndian.Uint32(head[0:4])
+		m.blockSize = uint32(binary.LittleEndian.Uint16(head[20:22]))
+	default:
+		m.nextBlock = binary.LittleEndian.Uint32(head[0:4])
+		m.blockSize = dBase3BlockSize
+	}
+	if m.blockSize == 0 {
+		m.blockSize = dBase3BlockSize
+	}
+	m.free = m.readFreeList(head[memoFreeListOffset:])
+	return nil
+}
+
+// headBlocks 文件头占用的块数，这些块不能使用
+func (m *memoFile) headBlocks() uint32 {
+	return (memoHeaderSize + m.blockSize - 1) / m.blockSize
+}
+
+// readFreeList 解析文件头里面的空闲块列表，对不上的时候当成没有空闲块
+func (m *memoFile) readFreeList(buff []byte) []memoExtent {
+	if !bytes.Equal(buff[:8], memoFreeMark) {
+		return nil
+	}
+	n := int(binary.LittleEndian.Uint16(buff[8:10]))
+	if n > maxMemoFreeExtents {
+		return nil
+	}
+	free := make([]memoExtent, 0, n)
+	end := m.headBlocks()
+	mark := make([]byte, len(memoFreeMark))
+	for i := 0; i < n; i++ {
+		e := memoExtent{
+			block: binary.LittleEndian.Uint32(buff[10+i*8:]),
+			count: binary.LittleEndian.Uint32(buff[14+i*8:]),
+		}
+		if e.block < end || e.block >= m.nextBlock || e.count == 0 || e.count > m.nextBlock-e.block {
+			return nil
+		}
+		end = e.block + e.count
+		// 空闲块已经被其它程序用了的话就跳过这一段
+		if _, err := m.file.ReadAt(mark, int64(e.block)*int64(m.blockSize)); err != nil || !bytes.Equal(mark, memoFreeMark) {
+			continue
+		}
+		free = append(free, e)
+	}
+	return free
+}
+
+// writeHead 保存下一个空闲块号和空闲块列表
+func (m *memoFile) writeHead() error {
+	buff := make([]byte, memoHeaderSize-memoFreeListOffset)
+	if m.kind == memoFoxPro {
+		binary.BigEndian.PutUint32(buff, m.nextBlock)
+	} else {
+		binary.LittleEndian.PutUint32(buff, m.nextBlock)
+	}
+	if _, err := m.file.WriteAt(buff[:4], 0); err != nil {
+		return err
+	}
+	for i := range buff {
+		buff[i] = 0
+	}
+	if len(m.free) > 0 {
+		copy(buff, memoFreeMark)
+		binary.LittleEndian.PutUint16(buff[8:10], uint16(len(m.free)))
+		for i, e := range m.free {
+			binary.LittleEndian.PutUint32(buff[10+i*8:], e.block)
+			binary.LittleEndian.PutUint32(buff[14+i*8:], e.count)
+		}
+	}
+	_, err := m.file.WriteAt(buff, memoFreeListOffset)
+	return err
+}
+
+// release 把一段块放回空闲块列表，和相邻的空闲块合并。列表放不下的时候丢掉最小的一段
+func (m *memoFile) release(block uint32, count uint32) error {
+	if count == 0 {
+		return nil
+	}
+	i := sort.Search(len(m.free), func(i int) bool { return m.free[i].block > block })
+	m.free = append(m.free, memoExtent{})
+	copy(m.free[i+1:], m.free[i:])
+	m.free[i] = memoExtent{block: block, count: count}
+	if i+1 < len(m.free) && m.free[i].block+m.free[i].count == m.free[i+1].block {
+		m.free[i].count += m.free[i+1].count
+		m.free = append(m.free[:i+1], m.free[i+2:]...)
+	}
+	if i > 0 && m.free[i-1].block+m.free[i-1].count == m.free[i].block {
+		m.free[i-1].count += m.free[i].count
+		m.free = append(m.free[:i], m.free[i+1:]...)
+		i--
+	}
+	markBlock := m.free[i].block
+	if len(m.free) > maxMemoFreeExtents {
+		smallest := 0
+		for j, e := range m.free {
+			if e.count < m.free[smallest].count {
+				smallest = j
+			}
+		}
+		m.free = append(m.free[:smallest], m.free[smallest+1:]...)
+	}
+	_, err := m.file.WriteAt(memoFreeMark, int64(markBlock)*int64(m.blockSize))
+	return err
+}
+
+// allocate 从空闲块列表里面取count块，第一段放得下的就用，没有的话返回0
+func (m *memoFile) allocate(count uint32) (uint32, error) {
+	for i, e := range m.free {
+		if e.count < count {
+			continue
+		}
+		if e.count == count {
+			m.free = append(m.free[:i], m.free[i+1:]...)
+			return e.block, nil
+		}
+		m.free[i] = memoExtent{block: e.block + count, count: e.count - count}
+		_, err := m.file.WriteAt(memoFreeMark, int64(m.free[i].block)*int64(m.blockSize))
+		return e.block, err
+	}
+	return 0, nil
+}
+
+// read 读取从block块开始的备注，返回备注类型和数据
+func (m *memoFile) read(block uint32) (memoType uint32, data []byte, err error) {
+	offset := int64(block) * int64(m.blockSize)
+	if m.kind == memoDBase3 {
+		// 没有长度信息，一块一块往后读，直到结束符
+		buff := make([]byte, m.blockSize)
+		for {
+			n, err := m.file.ReadAt(buff, offset)
+			if err != nil && err != io.EOF {
+				return 0, nil, err
+			}
+			if i := bytes.IndexByte(buff[:n], memoTerminator); i >= 0 {
+				return memoTypeText, append(data, buff[:i]...), nil
+			}
+			data = append(data, buff[:n]...)
+			if err == io.EOF {
+				return memoTypeText, data, nil
+			}
+			offset += int64(n)
+		}
+	}
+
+	head := make([]byte, 8)
+	if _, err = m.file.ReadAt(head, offset); err != nil {
+		return 0, nil, memo_block_invalid
+	}
+	var length uint32
+	if m.kind == memoFoxPro {
+		memoType = binary.BigEndian.Uint32(head[0:4])
+		length = binary.BigEndian.Uint32(head[4:8])
+	} else {
+		memoType = memoTypeText
+		length = binary.LittleEndian.Uint32(head[4:8])
+		if head[0] != 0xFF || head[1] != 0xFF || length < 8 {
+			return 0, nil, memo_block_invalid
+		}
+		length -= 8
+	}
+	// 长度来自文件内容，损坏的文件有可能是一个很大的数，先确认数据在文件里面再分配内存
+	info, err := m.file.Stat()
+	if err != nil {
+		return 0, nil, err
+	}
+	if offset+8+int64(length) > info.Size() {
+		return 0, nil, memo_block_invalid
+	}
+	data = make([]byte, length)
+	if _, err = m.file.ReadAt(data, offset+8); err != nil {
+		return 0, nil, memo_block_invalid
+	}
+	return memoType, data, nil
+}
+
+// blocks 保存length长度的数据需要的块数
+func (m *memoFile) blocks(length uint32) uint32 {
+	if m.kind == memoDBase3 {
+		length += 2
+	} else {
+		length += 8
+	}
+	return (length + m.blockSize - 1) / m.blockSize
+}
+
+// write 保存备注，返回备注开始的块号。如果oldBlock上原来的备注占用的块放得下新数据，
+// 或者原来的备注就在文件末尾，就直接覆盖原来的块，多出来的块放回空闲块列表。
+// 否则先把原来的块放回空闲块列表，再找一段放得下的空闲块，没有的话追加到文件末尾
+func (m *memoFile) write(oldBlock uint32, memoType uint32, data []byte) (block uint32, err error) {
+	// 有可能其它进程已经追加了备注，需要重新读取一下头部
+	if err = m.readHead(); err != nil {
+		return 0, err
+	}
+	newBlocks := m.blocks(uint32(len(data)))
+	oldBlocks := m.usedBlocks(oldBlock)
+	switch {
+	case oldBlocks >= newBlocks:
+		block = oldBlock
+		err = m.release(oldBlock+newBlocks, oldBlocks-newBlocks)
+	case oldBlocks > 0 && oldBlock+oldBlocks == m.nextBlock:
+		block = oldBlock
+	default:
+		if err = m.release(oldBlock, oldBlocks); err == nil {
+			block, err = m.allocate(newBlocks)
+		}
+		if block == 0 {
+			block = m.nextBlock
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	end := block + newBlocks
+
+	buff := make([]byte, 0, newBlocks*m.blockSize)
+	switch m.kind {
+	case memoFoxPro:
+		buff = buff[:8]
+		binary.BigEndian.PutUint32(buff[0:4], memoType)
+		binary.BigEndian.PutUint32(buff[4:8], uint32(len(data)))
+		buff = append(buff, data...)
+	case memoDBase4:
+		buff = append(buff, 0xFF, 0xFF, 0x08, 0x00, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(buff[4:8], uint32(len(data)+8))
+		buff = append(buff, data...)
+	default:
+		buff = append(buff, data...)
+		buff = append(buff, memoTerminator, memoTerminator)
+	}
+	if end > m.nextBlock {
+		// 新的块要补齐整块，下一个空闲块才能对齐
+		buff = buff[:cap(buff)]
+	}
+	if _, err = m.file.WriteAt(buff, int64(block)*int64(m.blockSize)); err != nil {
+		return 0, err
+	}
+	if end > m.nextBlock {
+		m.nextBlock = end
+	}
+	if err = m.writeHead(); err != nil {
+		return 0, err
+	}
+	return block, nil
+}
+
+// usedBlocks 从block块开始的备注占用的块数，block是0或者读不出来的时候返回0
+func (m *memoFile) usedBlocks(block uint32) uint32 {
+	if block < m.headBlocks() || block >= m.nextBlock {
+		return 0
+	}
+	_, data, err := m.read(block)
+	if err != nil {
+		return 0
+	}
+	return m.blocks(uint32(len(data)))
+}
+
+// remove 清空从block块开始的备注，把占用的块放回空闲块列表
+func (m *memoFile) remove(block uint32) error {
+	if err := m.readHead(); err != nil {
+		return err
+	}
+	n := m.usedBlocks(block)
+	if n == 0 {
+		return nil
+	}
+	if err := m.release(block, n); err != nil {
+		return err
+	}
+	return m.writeHead()
+}
+
+func (m *memoFile) close() error {
+	return m.file.Close()
+}
+
+// memoBlock 解析记录里面保存的备注块号，0表示没有备注。
+// Visual FoxPro的备注字段是4位的二进制整数，其余的是10位的数字字符串
+func memoBlock(value []byte) uint32 {
+	if len(value) == 4 {
+		return binary.LittleEndian.Uint32(value)
+	}
+	block, _ := strconv.ParseUint(strings.TrimSpace(bytes2str(value)), 10, 32)
+	return uint32(block)
+}
+
+func putMemoBlock(value []byte, block uint32) {
+	if len(value) == 4 {
+		binary.LittleEndian.PutUint32(value, block)
+		return
+	}
+	if block == 0 {
+		copy(value, bytes.Repeat([]byte{space}, len(value)))
+		return
+	}
+	s := strconv.FormatUint(uint64(block), 10)
+	copy(value, bytes.Repeat([]byte{space}, len(value)-len(s)))
+	copy(value[len(value)-len(s):], s)
+}
+
+// memoTypeOf 根据字段类型确定保存的备注类型
+func memoTypeOf(t fieldType) uint32 {
+	switch t {
+	case fieldtype_picture:
+		return memoTypePicture
+	case fieldtype_general:
+		return memoTypeObject
+	default:
+		return memoTypeText
+	}
+}
+
+func (dbf *DBF) hasMemoFields() bool {
+	for _, field := range dbf.fieldsList {
+		if isMemoField(field.fieldType) {
+			return true
+		}
+	}
+	return false
+}
+
+// memoValue 读取当前记录备注字段的数据，还没有提交的备注直接返回
+func (dbf *DBF) memoValue(field dbfField) ([]byte, error) {
+	if value, ok := dbf.memoValues[field.name]; ok {
+		return value, nil
+	}
+	block := memoBlock(dbf.recordBuff[field.displacement : field.displacement+uint32(field.length)])
+	if block == 0 {
+		return nil, nil
+	}
+	if dbf.memo == nil {
+		return nil, memo_file_not_exists
+	}
+	_, data, err := dbf.memo.read(block)
+	return data, err
+}
+
+func (dbf *DBF) setMemoValue(field dbfField, value []byte) {
+	if dbf.memoValues == nil {
+		dbf.memoValues = make(map[string][]byte)
+	}
+	dbf.memoValues[field.name] = value
+	dbf.setFlagBit(field.nullBit, false)
+}
+
+// postMemoValues 把还没有提交的备注写到备注文件，并且把块号写到记录里面，需要在加锁之后调用
+func (dbf *DBF) postMemoValues() error {
+	if err := dbf.writeMemoValues(dbf.recordBuff, dbf.memoValues); err != nil {
+		return err
+	}
+	dbf.memoValues = nil
+	return nil
+}
+
+// writeMemoValues 把values里面的备注写到备注文件，并且把块号写到record里面，需要在加锁之后调用
+func (dbf *DBF) writeMemoValues(record []byte, values map[string][]byte) error {
+	if len(values) == 0 {
+		return nil
+	}
+	if dbf.memo == nil {
+		return memo_file_not_exists
+	}
+	for _, field := range dbf.fieldsList {
+		value, ok := values[field.name]
+		if !ok {
+			continue
+		}
+		buff := record[field.displacement : field.displacement+uint32(field.length)]
+		if len(value) == 0 {
+			if err := dbf.memo.remove(memoBlock(buff)); err != nil {
+				return err
+			}
+			putMemoBlock(buff, 0)
+			continue
+		}
+		block, err := dbf.memo.write(memoBlock(buff), memoTypeOf(field.fieldType), value)
+		if err != nil {
+			return err
+		}
+		putMemoBlock(buff, block)
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package godbf
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fldtest.dbf is a FoxPro table of 4 records whose MEMO field is stored in
+// fldtest.fpt, in blocks 8, 9 and 10 of 64 bytes.  The memo of the second
+// record is empty
+const fldtestDir = "../../odbc-master/testdata"
+
+var fldtestMemos = []string{"Hello", "", "World", "12398y345 sdflkjdsfsd fds;lkdsfgl;sd"}
+
+func copyFile(t *testing.T, from, to string) {
+	t.Helper()
+	src, err := os.Open(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	dst, err := os.Create(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if _, err = io.Copy(dst, src); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadFldtest copies the fldtest fixture to a temporary directory and opens
+// the copy
+func loadFldtest(t *testing.T) (*DBF, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"fldtest.dbf", "fldtest.fpt"} {
+		copyFile(t, filepath.Join(fldtestDir, name), filepath.Join(dir, name))
+	}
+	filename := filepath.Join(dir, "fldtest.dbf")
+	dbf, err := LoadFrom(filename, "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dbf, filename
+}
+
+func readMemos(t *testing.T, dbf *DBF) []string {
+	t.Helper()
+	var memos []string
+	for i := uint32(1); i <= dbf.RecordCount(); i++ {
+		if err := dbf.Go(i); err != nil {
+			t.Fatal(err)
+		}
+		value, err := dbf.BytesValueByName("MEMO")
+		if err != nil {
+			t.Fatal(err)
+		}
+		memos = append(memos, string(value))
+	}
+	return memos
+}
+
+func memoBlockOf(t *testing.T, dbf *DBF, recordNo uint32) uint32 {
+	t.Helper()
+	if err := dbf.Go(recordNo); err != nil {
+		t.Fatal(err)
+	}
+	field := dbf.fieldsMap["MEMO"]
+	return memoBlock(dbf.fieldBuff(field))
+}
+
+func TestMemoRead(t *testing.T) {
+	dbf, _ := loadFldtest(t)
+	defer dbf.Close()
+
+	if got := readMemos(t, dbf); strings.Join(got, "|") != strings.Join(fldtestMemos, "|") {
+		t.Fatalf("got memos %q, want %q", got, fldtestMemos)
+	}
+	if err := dbf.First(); err != nil {
+		t.Fatal(err)
+	}
+	if got := dbf.StringValueByNameX("MEMO"); got != "Hello" {
+		t.Errorf("got memo text %q, want Hello", got)
+	}
+	if got := strings.TrimSpace(dbf.StringValueByNameX("CHAR")); got != "123" {
+		t.Errorf("got CHAR %q, want 123", got)
+	}
+}
+
+func TestMemoWrite(t *testing.T) {
+	dbf, filename := loadFldtest(t)
+	grown := strings.Repeat("x", 100)
+	binaryValue := []byte{0, 1, 2, 0x1A, 0xFF}
+	tests := []struct {
+		recordNo uint32
+		value    []byte
+		block    uint32
+		next     uint32
+		free     []memoExtent
+	}{
+		// fits in the old block
+		{1, []byte("Hi"), 8, 11, nil},
+		// too long for the old block: appended, block 8 is freed
+		{1, []byte(grown), 11, 13, []memoExtent{{8, 1}}},
+		// the last memo of the file grows in place
+		{1, []byte(grown + grown), 11, 15, []memoExtent{{8, 1}}},
+		{4, binaryValue, 10, 15, []memoExtent{{8, 1}}},
+		// an empty memo has no block, block 9 is merged with block 8
+		{3, nil, 0, 15, []memoExtent{{8, 2}}},
+		// the freed blocks are reused
+		{2, []byte(grown), 8, 15, nil},
+		// a shorter memo keeps its first block and frees the rest
+		{1, []byte("short"), 11, 15, []memoExtent{{12, 3}}},
+	}
+	for _, tt := range tests {
+		if err := dbf.Go(tt.recordNo); err != nil {
+			t.Fatal(err)
+		}
+		if err := dbf.SetFieldBytes("MEMO", tt.value); err != nil {
+			t.Fatal(err)
+		}
+		// not written before Post, but read back
+		if data, err := dbf.BytesValueByName("MEMO"); err != nil || !bytes.Equal(data, tt.value) {
+			t.Fatalf("record %d: got pending memo %q, %v", tt.recordNo, data, err)
+		}
+		if err := dbf.Post(); err != nil {
+			t.Fatal(err)
+		}
+		if block := memoBlockOf(t, dbf, tt.recordNo); block != tt.block {
+			t.Errorf("record %d: memo of %d bytes in block %d, want %d", tt.recordNo, len(tt.value), block, tt.block)
+		}
+		if err := dbf.memo.readHead(); err != nil {
+			t.Fatal(err)
+		}
+		if dbf.memo.nextBlock != tt.next {
+			t.Errorf("record %d: next free block %d, want %d", tt.recordNo, dbf.memo.nextBlock, tt.next)
+		}
+		if len(dbf.memo.free) != len(tt.free) || len(tt.free) > 0 && !reflect.DeepEqual(dbf.memo.free, tt.free) {
+			t.Errorf("record %d: free blocks %v, want %v", tt.recordNo, dbf.memo.free, tt.free)
+		}
+	}
+	dbf.Close()
+
+	dbf, err := LoadFrom(filename, "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	want := []string{"short", grown, "", string(binaryValue)}
+	if got := readMemos(t, dbf); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got memos %q after reopening, want %q", got, want)
+	}
+}
+
+func TestMemoNewFile(t *testing.T) {
+	for _, ext := range []string{".dbf", ".DBF"} {
+		filename := filepath.Join(t.TempDir(), "memo"+ext)
+		dbf := NewFile(filename, "gbk")
+		dbf.AddStringField("CODE", 6)
+		dbf.AddMemoField("NOTE")
+		if err := dbf.SaveNewFile(); err != nil {
+			t.Fatal(err)
+		}
+		values := []string{"第一条备注", strings.Repeat("long ", 40), ""}
+		for i, v := range values {
+			dbf.Append()
+			dbf.SetFieldValue("CODE", string(rune('A'+i)))
+			dbf.SetFieldValue("NOTE", v)
+			if err := dbf.Post(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		dbf.Close()
+
+		memoName := strings.TrimSuffix(filename, ext) + ".fpt"
+		if ext == ".DBF" {
+			memoName = strings.TrimSuffix(filename, ext) + ".FPT"
+		}
+		if _, err := os.Stat(memoName); err != nil {
+			t.Fatalf("%s: memo file not created: %v", ext, err)
+		}
+		dbf, err := LoadFrom(filename, "gbk")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0, len(values))
+		for i := uint32(1); i <= dbf.RecordCount(); i++ {
+			if err := dbf.Go(i); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, dbf.StringValueByNameX("NOTE"))
+		}
+		dbf.Close()
+		if strings.Join(got, "|") != strings.Join(values, "|") {
+			t.Errorf("%s: got memos %q, want %q", ext, got, values)
+		}
+	}
+}
+
+func TestMemoFileMissing(t *testing.T) {
+	dir := t.TempDir()
+	copyFile(t, filepath.Join(fldtestDir, "fldtest.dbf"), filepath.Join(dir, "fldtest.dbf"))
+	dbf, err := LoadFrom(filepath.Join(dir, "fldtest.dbf"), "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if err := dbf.First(); err != nil {
+		t.Fatal(err)
+	}
+	// only the memo fields can not be read
+	if got := strings.TrimSpace(dbf.StringValueByNameX("CHAR")); got != "123" {
+		t.Errorf("got CHAR %q, want 123", got)
+	}
+	if _, err := dbf.StringValueByName("MEMO"); err != memo_file_not_exists {
+		t.Errorf("got error %v reading a memo, want %v", err, memo_file_not_exists)
+	}
+	if err := dbf.SetFieldValue("MEMO", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Post(); err != memo_file_not_exists {
+		t.Errorf("got error %v writing a memo, want %v", err, memo_file_not_exists)
+	}
+}
+
+func TestMemoCorrupt(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(f *os.File) error
+	}{
+		{"huge length", func(f *os.File) error {
+			_, err := f.WriteAt([]byte{0x7F, 0xFF, 0xFF, 0xFF}, 8*64+4)
+			return err
+		}},
+		{"truncated", func(f *os.File) error {
+			return f.Truncate(8*64 + 8 + 2)
+		}},
+		{"past the end", func(f *os.File) error {
+			return f.Truncate(8 * 64)
+		}},
+	}
+	for _, tt := range tests {
+		dbf, filename := loadFldtest(t)
+		f, err := os.OpenFile(strings.TrimSuffix(filename, ".dbf")+".fpt", os.O_RDWR, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tt.corrupt(f); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		if err := dbf.First(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dbf.BytesValueByName("MEMO"); err != memo_block_invalid {
+			t.Errorf("%s: got %v, want %v", tt.name, err, memo_block_invalid)
+		}
+		dbf.Close()
+	}
+}
+
+// TestMemoFreeListStale checks that freed blocks written over by another
+// program are not reused
+func TestMemoFreeListStale(t *testing.T) {
+	dbf, filename := loadFldtest(t)
+	defer dbf.Close()
+	if err := dbf.Go(3); err != nil {
+		t.Fatal(err)
+	}
+	dbf.SetFieldBytes("MEMO", nil)
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.memo.readHead(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []memoExtent{{9, 1}}; !reflect.DeepEqual(dbf.memo.free, want) {
+		t.Fatalf("free blocks %v, want %v", dbf.memo.free, want)
+	}
+
+	// 其它程序重建备注文件之后，块9放了别的备注
+	f, err := os.OpenFile(strings.TrimSuffix(filename, ".dbf")+".fpt", os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt([]byte{0, 0, 0, 1, 0, 0, 0, 2, 'h', 'i'}, 9*64)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Go(2); err != nil {
+		t.Fatal(err)
+	}
+	dbf.SetFieldValue("MEMO", "new")
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	if block := memoBlockOf(t, dbf, 2); block != 11 {
+		t.Errorf("memo written in block %d, want 11 at the end of the file", block)
+	}
+	if _, data, err := dbf.memo.read(9); err != nil || string(data) != "hi" {
+		t.Errorf("block 9 = %q, %v, want hi", data, err)
+	}
+}
@@ -15,6 +15,7 @@ const (
 	foxBASE_III_NoMemo fileType = 0x03    //0x03    FoxBASE+/Dbase III plus, no memo
 	foxPro fileType = 0x30                //0x30    Visual FoxPro
 	foxProAutoincrement fileType = 0x31   //0x31    Visual FoxPro,  enabled autoincrement
+	foxProVarchar fileType = 0x32         //0x32    Visual FoxPro,  with Varchar or Varbinary
 	dbase_IV_SQL_Table_NoMemo fileType = 0x43      //0x43    dBASE IV SQL table files, no memo
 	dbase_IV_SQL_System_NoMemo fileType = 0x63     //0x63    dBASE IV SQL system files, no memo
 	foxBASE_III_Memo fileType = 0x83               //0x83    FoxBASE+/dBASE III PLUS, with memo
@@ -31,16 +32,16 @@ const (
 	fieldtype_date      fieldType = 'D'
 	fieldtype_numeric   fieldType = 'N'  // 数值，包括整数和浮点小数
 	fieldtype_float     fieldType = 'F'
-	/*
-		暂不支持
-		fieldtype_dateTime  fieldType = "T"
-		fieldtype_currency  fieldType = "Y"
-		fieldtype_double    fieldType = "B"
-		fieldtype_integer   fieldType = "I"
-		fieldtype_memo   	fieldType = "M"
-		fieldtype_general   fieldType = "G"
-		fieldtype_picture   fieldType = "P"
-	*/
+	fieldtype_memo      fieldType = 'M'  // 备注，数据保存在备注文件里面，记录里面只保存块号
+	fieldtype_general   fieldType = 'G'  // OLE对象，保存在备注文件里面
+	fieldtype_picture   fieldType = 'P'  // 图片，保存在备注文件里面
+	fieldtype_dateTime  fieldType = 'T'  // 日期时间，VFP，8位二进制
+	fieldtype_currency  fieldType = 'Y'  // 货币，VFP，8位二进制
+	fieldtype_double    fieldType = 'B'  // 双精度浮点，VFP，8位二进制
+	fieldtype_integer   fieldType = 'I'  // 整数，VFP，4位二进制
+	fieldtype_varchar   fieldType = 'V'  // 变长字符串，VFP
+	fieldtype_varbinary fieldType = 'Q'  // 变长二进制，VFP
+	fieldtype_nullFlags fieldType = '0'  // VFP的_NullFlags系统字段
 )
 
 const headerTerminator byte = 0x0D  //文件头的结束符号
@@ -70,4 +71,6 @@ type dbfField struct {
 	autoincrementNext uint32  //第20-23位，自增字段的下一个值
 	autoincrementStep uint8  //第24位，自增步长
 	reserved    []byte  //第25-32位，reserve数据
+	nullBit     int  //在_NullFlags里面的null标志位，-1表示不能为null
+	varLengthBit int  //在_NullFlags里面的变长标志位，-1表示不是变长字段
 }
@@ -0,0 +1,490 @@
+package godbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+/*
+	Visual FoxPro扩展说明：
+	文件头结束符后面还有263位的backlink，保存数据库容器(.dbc)的路径
+	字段标志 0x01系统字段 0x02可以为null 0x04二进制字段
+	_NullFlags 是隐藏的系统字段，放在最后，按字段顺序给每个可以为null的字段分配一位null标志，
+	再给每个变长字段(V/Q)分配一位长度标志。变长字段的数据比字段长度短的时候，长度标志置1，
+	实际长度保存在字段的最后一位
+*/
+
+const (
+	fieldFlagSystem   byte = 0x01
+	fieldFlagNullable byte = 0x02
+	fieldFlagBinary   byte = 0x04
+)
+
+const nullFlagsFieldName = "_NullFlags"
+const vfpBacklinkSize = 263
+const vfpTableFlagMemo byte = 0x02 //第29位，表标志，有备注文件
+const julianDayUnixEpoch = 2440588 //1970-01-01的儒略日
+const dateTimeLayout = "20060102150405"
+const dateLayout = "20060102"
+
+func isVarLengthField(t fieldType) bool {
+	return t == fieldtype_varchar || t == fieldtype_varbinary
+}
+
+func (dbf *DBF) isVisualFoxPro() bool {
+	switch fileType(dbf.head.fileType) {
+	case foxPro, foxProAutoincrement, foxProVarchar:
+		return true
+	default:
+		return false
+	}
+}
+
+// assignNullFlagBits 给可以为null的字段和变长字段分配_NullFlags里面的标志位，返回用到的位数
+func (dbf *DBF) assignNullFlagBits() int {
+	bits := 0
+	dbf.nullFlags = nil
+	for i := range dbf.fieldsList {
+		field := &dbf.fieldsList[i]
+		field.nullBit, field.varLengthBit = -1, -1
+		if field.fieldType == fieldtype_nullFlags {
+			dbf.nullFlags = field
+		} else if field.flag&fieldFlagSystem == 0 {
+			if field.flag&fieldFlagNullable != 0 {
+				field.nullBit = bits
+				bits++
+			}
+			if isVarLengthField(field.fieldType) {
+				field.varLengthBit = bits
+				bits++
+			}
+		}
+		dbf.fieldsMap[field.name] = *field
+	}
+	return bits
+}
+
+// layoutFields 重新计算字段的位置、记录长度和数据开始的位置，_NullFlags字段按需要重新放到最后
+func (dbf *DBF) layoutFields() {
+	fields := dbf.fieldsList[:0]
+	for _, field := range dbf.fieldsList {
+		if field.fieldType != fieldtype_nullFlags {
+			fields = append(fields, field)
+		}
+	}
+	dbf.fieldsList = fields
+	dbf.fieldsMap = make(map[string]dbfField, len(fields)+1)
+	if bits := dbf.assignNullFlagBits(); bits > 0 {
+		dbf.fieldsList = append(dbf.fieldsList, dbfField{
+			name:      nullFlagsFieldName,
+			fieldType: fieldtype_nullFlags,
+			length:    uint8((bits + 7) / 8),
+			flag:      fieldFlagSystem | fieldFlagBinary,
+			reserved:  make([]byte, 8),
+		})
+		dbf.assignNullFlagBits()
+	}
+	// 第1位是删除标记
+	var displacement uint32 = 1
+	for i := range dbf.fieldsList {
+		dbf.fieldsList[i].displacement = displacement
+		displacement += uint32(dbf.fieldsList[i].length)
+		dbf.fieldsMap[dbf.fieldsList[i].name] = dbf.fieldsList[i]
+	}
+	dbf.fieldsCount = len(dbf.fieldsList)
+	dbf.head.recordSize = uint16(displacement)
+	//32位长度的header + 字段描述个数 * 每个字段描述32位长度 + 1位文件头结束符 (+ VFP的263位backlink)
+	dbf.head.dataOffset = uint16(32 + 32*dbf.fieldsCount + 1)
+	if dbf.isVisualFoxPro() {
+		dbf.head.dataOffset += vfpBacklinkSize
+	}
+}
+
+// useVisualFoxPro 新文件用到VFP的字段类型时，改成VFP文件，备注字段改成4位二进制块号
+func (dbf *DBF) useVisualFoxPro() {
+	if dbf.isVisualFoxPro() {
+		return
+	}
+	dbf.head.fileType = byte(foxPro)
+	for i := range dbf.fieldsList {
+		if isMemoField(dbf.fieldsList[i].fieldType) {
+			dbf.fieldsList[i].length = 4
+		}
+	}
+}
+
+func (dbf *DBF) addVFPField(fieldName string, fieldType fieldType, length uint8, precision uint8, flag byte) {
+	dbf.useVisualFoxPro()
+	dbf.addField(fieldName, fieldType, length, precision)
+	if flag != 0 {
+		field := &dbf.fieldsList[len(dbf.fieldsList)-1]
+		if field.fieldType == fieldtype_nullFlags {
+			field = &dbf.fieldsList[len(dbf.fieldsList)-2]
+		}
+		field.flag = flag
+		dbf.layoutFields()
+	}
+}
+
+func (dbf *DBF) AddDateTimeField(fieldName string) {
+	dbf.addVFPField(fieldName, fieldtype_dateTime, 8, 0, 0)
+}
+
+func (dbf *DBF) AddCurrencyField(fieldName string) {
+	dbf.addVFPField(fieldName, fieldtype_currency, 8, 4, 0)
+}
+
+func (dbf *DBF) AddIntegerField(fieldName string) {
+	dbf.addVFPField(fieldName, fieldtype_integer, 4, 0, 0)
+}
+
+func (dbf *DBF) AddDoubleField(fieldName string, precision uint8) {
+	dbf.addVFPField(fieldName, fieldtype_double, 8, precision, 0)
+}
+
+func (dbf *DBF) AddVarcharField(fieldName string, length uint8) {
+	dbf.addVFPField(fieldName, fieldtype_varchar, length, 0, 0)
+}
+
+func (dbf *DBF) AddVarbinaryField(fieldName string, length uint8) {
+	dbf.addVFPField(fieldName, fieldtype_varbinary, length, 0, fieldFlagBinary)
+}
+
+// SetFieldNullable 允许字段保存null，新文件会变成VFP文件，需要在SaveNewFile之前调用
+func (dbf *DBF) SetFieldNullable(fieldName string) error {
+	if dbf.file != nil {
+		return file_already_saved
+	}
+	for i := range dbf.fieldsList {
+		if dbf.fieldsList[i].name == fieldName && dbf.fieldsList[i].fieldType != fieldtype_nullFlags {
+			dbf.useVisualFoxPro()
+			dbf.fieldsList[i].flag |= fieldFlagNullable
+			dbf.layoutFields()
+			return nil
+		}
+	}
+	return field_not_exists
+}
+
+func (dbf *DBF) flagBit(bit int) bool {
+	if bit < 0 || dbf.nullFlags == nil || bit/8 >= int(dbf.nullFlags.length) {
+		return false
+	}
+	return dbf.recordBuff[dbf.nullFlags.displacement+uint32(bit/8)]&(1<<uint(bit%8)) != 0
+}
+
+func (dbf *DBF) setFlagBit(bit int, on bool) {
+	if bit < 0 || dbf.nullFlags == nil || bit/8 >= int(dbf.nullFlags.length) {
+		return
+	}
+	i := dbf.nullFlags.displacement + uint32(bit/8)
+	if on {
+		dbf.recordBuff[i] |= 1 << uint(bit%8)
+	} else {
+		dbf.recordBuff[i] &^= 1 << uint(bit%8)
+	}
+}
+
+func (dbf *DBF) fieldBuff(field dbfField) []byte {
+	return dbf.recordBuff[field.displacement : field.displacement+uint32(field.length)]
+}
+
+// varValue 变长字段的实际数据
+func (dbf *DBF) varValue(field dbfField) []byte {
+	buff := dbf.fieldBuff(field)
+	if dbf.flagBit(field.varLengthBit) && len(buff) > 0 && int(buff[len(buff)-1]) < len(buff) {
+		return buff[:buff[len(buff)-1]]
+	}
+	return buff
+}
+
+func (dbf *DBF) setVarValue(field dbfField, value []byte) {
+	buff := dbf.fieldBuff(field)
+	n := copy(buff, value)
+	for i := n; i < len(buff); i++ {
+		buff[i] = null
+	}
+	if n < len(buff) {
+		buff[len(buff)-1] = byte(n)
+	}
+	dbf.setFlagBit(field.varLengthBit, n < len(buff))
+}
+
+// blankField 新增记录时字段的默认值，会把字段原来的内容全部覆盖
+func (dbf *DBF) blankField(field dbfField) {
+	buff := dbf.fieldBuff(field)
+	switch field.fieldType {
+	case fieldtype_nullFlags:
+		// _NullFlags由Append先清空，这里不能清掉变长字段的长度标志
+	case fieldtype_memo, fieldtype_general, fieldtype_picture:
+		putMemoBlock(buff, 0)
+	case fieldtype_integer, fieldtype_double, fieldtype_currency, fieldtype_dateTime:
+		for i := range buff {
+			buff[i] = null
+		}
+	case fieldtype_varchar, fieldtype_varbinary:
+		dbf.setVarValue(field, nil)
+	default:
+		//其余的全部当成字符串处理，先填满空格，数值字段再右对齐写上0，逻辑字段和原来一样写0
+		for i := range buff {
+			buff[i] = space
+		}
+		switch field.fieldType {
+		case fieldtype_float, fieldtype_numeric:
+			zero := strconv.FormatFloat(0, 'f', int(field.decimalPlaces), 64)
+			if len(zero) <= len(buff) {
+				copy(buff[len(buff)-len(zero):], zero)
+			}
+		case fieldtype_logical:
+			copy(buff, "0")
+		}
+	}
+}
+
+// fieldText 字段值的文本形式，二进制字段会转换成文本，null返回空字符串
+func (dbf *DBF) fieldText(field dbfField) string {
+	buff := dbf.fieldBuff(field)
+	if dbf.flagBit(field.nullBit) {
+		return ""
+	}
+	switch {
+	case field.fieldType == fieldtype_integer && len(buff) == 4:
+		return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(buff))))
+	case field.fieldType == fieldtype_double && len(buff) == 8:
+		return strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(buff)), 'f', -1, 64)
+	case field.fieldType == fieldtype_currency && len(buff) == 8:
+		return decodeCurrency(buff).String()
+	case field.fieldType == fieldtype_dateTime && len(buff) == 8:
+		if t := decodeDateTime(buff); !t.IsZero() {
+			return t.Format(dateTimeLayout)
+		}
+		return ""
+	case field.fieldType == fieldtype_varchar:
+		return dbf.decoder.ConvertString(bytes2str(dbf.varValue(field)))
+	case field.fieldType == fieldtype_varbinary:
+		return string(dbf.varValue(field))
+	default:
+		return strings.TrimSpace(dbf.decoder.ConvertString(bytes2str(buff)))
+	}
+}
+
+// setFieldText 按字段类型保存文本形式的值
+func (dbf *DBF) setFieldText(field dbfField, value string) error {
+	buff := dbf.fieldBuff(field)
+	switch field.fieldType {
+	case fieldtype_integer:
+		var n int64
+		if value = strings.TrimSpace(value); value != "" {
+			var err error
+			if n, err = strconv.ParseInt(value, 10, 32); err != nil {
+				return err
+			}
+		}
+		binary.LittleEndian.PutUint32(buff, uint32(int32(n)))
+	case fieldtype_double:
+		var f float64
+		if value = strings.TrimSpace(value); value != "" {
+			var err error
+			if f, err = strconv.ParseFloat(value, 64); err != nil {
+				return err
+			}
+		}
+		binary.LittleEndian.PutUint64(buff, math.Float64bits(f))
+	case fieldtype_currency:
+		d := decimal.Zero
+		if value = strings.TrimSpace(value); value != "" {
+			var err error
+			if d, err = decimal.NewFromString(value); err != nil {
+				return err
+			}
+		}
+		encodeCurrency(buff, d)
+	case fieldtype_dateTime:
+		var t time.Time
+		if value = strings.TrimSpace(value); value != "" {
+			var err error
+			if t, err = parseDateTime(value); err != nil {
+				return err
+			}
+		}
+		encodeDateTime(buff, t)
+	case fieldtype_varchar:
+		dbf.setVarValue(field, []byte(dbf.encoder.ConvertString(value)))
+	case fieldtype_varbinary:
+		dbf.setVarValue(field, []byte(value))
+	default:
+		// 先填满空格再写，短的值不会留下原来的内容，数值字段右对齐，太长的时候不能截断
+		data := str2bytes(dbf.encoder.ConvertString(value))
+		if field.fieldType == fieldtype_numeric || field.fieldType == fieldtype_float {
+			data = bytes.TrimSpace(data)
+			if len(data) > len(buff) {
+				return fmt.Errorf("value %s: %w", value, value_too_wide)
+			}
+			data = append(bytes.Repeat([]byte{space}, len(buff)-len(data)), data...)
+		}
+		for i := copy(buff, data); i < len(buff); i++ {
+			buff[i] = space
+		}
+	}
+	dbf.setFlagBit(field.nullBit, false)
+	return nil
+}
+
+func (dbf *DBF) IsNullByName(fieldname string) (bool, error) {
+	field, ok := dbf.fieldsMap[fieldname]
+	if !ok {
+		return false, field_not_exists
+	}
+	return dbf.flagBit(field.nullBit), nil
+}
+
+// SetFieldNull 把字段设置成null，字段需要允许null
+func (dbf *DBF) SetFieldNull(fieldname string) error {
+	field, ok := dbf.fieldsMap[fieldname]
+	if !ok {
+		return field_not_exists
+	}
+	if field.nullBit < 0 {
+		return field_not_nullable
+	}
+	if isMemoField(field.fieldType) {
+		// 保存成空的备注，Post的时候把原来的块放回空闲块列表
+		dbf.setMemoValue(field, nil)
+	} else {
+		dbf.blankField(field)
+	}
+	dbf.setFlagBit(field.nullBit, true)
+	return nil
+}
+
+// TimeValueByName 读取日期时间(T)或者日期(D)字段，空值和null返回零值
+func (dbf *DBF) TimeValueByName(fieldname string) (value time.Time, err error) {
+	field, ok := dbf.fieldsMap[fieldname]
+	if !ok {
+		return time.Time{}, field_not_exists
+	}
+	if dbf.flagBit(field.nullBit) {
+		return time.Time{}, nil
+	}
+	switch field.fieldType {
+	case fieldtype_dateTime:
+		return decodeDateTime(dbf.fieldBuff(field)), nil
+	case fieldtype_date:
+		s := strings.TrimSpace(bytes2str(dbf.fieldBuff(field)))
+		if s == "" {
+			return time.Time{}, nil
+		}
+		return time.ParseInLocation(dateLayout, s, time.Local)
+	default:
+		return time.Time{}, field_type_mismatch
+	}
+}
+
+func (dbf *DBF) TimeValueByNameX(fieldname string) (value time.Time) {
+	value, _ = dbf.TimeValueByName(fieldname)
+	return value
+}
+
+// SetFieldTime 保存日期时间(T)或者日期(D)字段，零值保存为空
+func (dbf *DBF) SetFieldTime(fieldname string, value time.Time) error {
+	field, ok := dbf.fieldsMap[fieldname]
+	if !ok {
+		return field_not_exists
+	}
+	switch field.fieldType {
+	case fieldtype_dateTime:
+		encodeDateTime(dbf.fieldBuff(field), value)
+	case fieldtype_date:
+		if value.IsZero() {
+			copy(dbf.fieldBuff(field), "        ")
+		} else {
+			copy(dbf.fieldBuff(field), value.Format(dateLayout))
+		}
+	default:
+		return field_type_mismatch
+	}
+	dbf.setFlagBit(field.nullBit, false)
+	return nil
+}
+
+// CurrencyValueByName 读取货币(Y)字段，其它字段按数值读取
+func (dbf *DBF) CurrencyValueByName(fieldname string) (value decimal.Decimal, err error) {
+	field, ok := dbf.fieldsMap[fieldname]
+	if !ok {
+		return decimal.Zero, field_not_exists
+	}
+	if field.fieldType == fieldtype_currency && !dbf.flagBit(field.nullBit) {
+		return decodeCurrency(dbf.fieldBuff(field)), nil
+	}
+	return decimal.NewFromString(dbf.fieldText(field))
+}
+
+func (dbf *DBF) CurrencyValueByNameX(fieldname string) (value decimal.Decimal) {
+	value, _ = dbf.CurrencyValueByName(fieldname)
+	return value
+}
+
+// SetFieldCurrency 保存货币(Y)字段，保留4位小数，其它字段按小数位数保存
+func (dbf *DBF) SetFieldCurrency(fieldname string, value decimal.Decimal) error {
+	field, ok := dbf.fieldsMap[fieldname]
+	if !ok {
+		return field_not_exists
+	}
+	if field.fieldType == fieldtype_currency {
+		encodeCurrency(dbf.fieldBuff(field), value)
+		dbf.setFlagBit(field.nullBit, false)
+		return nil
+	}
+	return dbf.setFieldText(field, value.StringFixed(int32(field.decimalPlaces)))
+}
+
+// decodeDateTime 前4位是儒略日，后4位是从0点开始的毫秒数，都是小端
+func decodeDateTime(buff []byte) time.Time {
+	days := int32(binary.LittleEndian.Uint32(buff[0:4]))
+	ms := int32(binary.LittleEndian.Uint32(buff[4:8]))
+	if days <= 0 || strings.TrimSpace(bytes2str(buff)) == "" {
+		return time.Time{}
+	}
+	// 毫秒数是当天的钟点，按年月日时分秒组装，夏令时切换的那天不能按经过的时间加
+	date := time.Unix(int64(days-julianDayUnixEpoch)*86400, 0).UTC()
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, int(ms)*int(time.Millisecond), time.Local)
+}
+
+func encodeDateTime(buff []byte, t time.Time) {
+	if t.IsZero() {
+		binary.LittleEndian.PutUint64(buff, 0)
+		return
+	}
+	date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	days := julianDayUnixEpoch + date.Unix()/86400
+	ms := ((t.Hour()*60+t.Minute())*60+t.Second())*1000 + t.Nanosecond()/int(time.Millisecond)
+	binary.LittleEndian.PutUint32(buff[0:4], uint32(days))
+	binary.LittleEndian.PutUint32(buff[4:8], uint32(ms))
+}
+
+func parseDateTime(value string) (time.Time, error) {
+	var err error
+	for _, layout := range []string{dateTimeLayout, "2006-01-02 15:04:05", dateLayout} {
+		var t time.Time
+		if t, err = time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// 货币是放大10000倍的int64，小端
+func decodeCurrency(buff []byte) decimal.Decimal {
+	return decimal.New(int64(binary.LittleEndian.Uint64(buff)), -4)
+}
+
+func encodeCurrency(buff []byte, value decimal.Decimal) {
+	binary.LittleEndian.PutUint64(buff, uint64(value.Shift(4).Round(0).IntPart()))
+}
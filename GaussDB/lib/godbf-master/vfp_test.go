@@ -0,0 +1,283 @@
+package godbf
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/shopspring/decimal"
+)
+
+// newVFPFile creates a table using every Visual FoxPro field type, with NAME
+// and QTY nullable
+func newVFPFile(t *testing.T) (*DBF, string) {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "vfp.dbf")
+	dbf := NewFile(filename, "gbk")
+	dbf.AddIntegerField("ID")
+	dbf.AddCurrencyField("PRICE")
+	dbf.AddDateTimeField("AT")
+	dbf.AddDoubleField("RATE", 2)
+	dbf.AddVarcharField("NAME", 10)
+	dbf.AddVarbinaryField("DATA", 6)
+	dbf.AddNumericField("QTY", 8, 2)
+	dbf.AddBooleanField("OK")
+	dbf.AddStringField("CODE", 6)
+	for _, name := range []string{"NAME", "QTY"} {
+		if err := dbf.SetFieldNullable(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dbf.SaveNewFile(); err != nil {
+		t.Fatal(err)
+	}
+	return dbf, filename
+}
+
+func TestVFPFieldNames(t *testing.T) {
+	dbf, _ := newVFPFile(t)
+	defer dbf.Close()
+
+	want := []string{"ID", "PRICE", "AT", "RATE", "NAME", "DATA", "QTY", "OK", "CODE"}
+	if names := dbf.FieldNames(); !reflect.DeepEqual(names, want) {
+		t.Errorf("FieldNames() = %v, want %v", names, want)
+	}
+	if n := dbf.FieldsCount(); n != len(want) {
+		t.Errorf("FieldsCount() = %d, want %d", n, len(want))
+	}
+	// NAME的null标志和长度标志，DATA的长度标志，QTY的null标志
+	if dbf.nullFlags == nil || dbf.nullFlags.length != 1 {
+		t.Fatalf("_NullFlags = %+v, want a field of 1 byte", dbf.nullFlags)
+	}
+	if _, ok := dbf.fieldsMap[nullFlagsFieldName]; !ok {
+		t.Errorf("%s is not in the fields", nullFlagsFieldName)
+	}
+
+	if err := dbf.SetFieldNullable("ID"); err != file_already_saved {
+		t.Errorf("SetFieldNullable after SaveNewFile: got %v, want %v", err, file_already_saved)
+	}
+}
+
+func TestVFPRoundTrip(t *testing.T) {
+	at := time.Date(2021, 6, 5, 13, 14, 15, 0, time.Local)
+	dbf, filename := newVFPFile(t)
+
+	// 1: 所有字段都有值
+	dbf.Append()
+	for name, value := range map[string]string{
+		"ID":   "-42",
+		"RATE": "1.25",
+		"NAME": "abc",
+		"QTY":  "    3.50",
+		"OK":   "T",
+		"CODE": "600570",
+	} {
+		if err := dbf.SetFieldValue(name, value); err != nil {
+			t.Fatalf("SetFieldValue(%s): %v", name, err)
+		}
+	}
+	if err := dbf.SetFieldCurrency("PRICE", decimal.RequireFromString("12.3456")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.SetFieldTime("AT", at); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.SetFieldBytes("DATA", []byte{0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	// 2: 默认值
+	dbf.Append()
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	// 3: null，变长字段写满
+	dbf.Append()
+	for _, name := range []string{"NAME", "QTY"} {
+		if err := dbf.SetFieldNull(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dbf.SetFieldNull("ID"); err != field_not_nullable {
+		t.Errorf("SetFieldNull(ID): got %v, want %v", err, field_not_nullable)
+	}
+	if err := dbf.SetFieldBytes("DATA", []byte("abcdef")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	dbf.Close()
+
+	dbf, err := LoadFrom(filename, "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if n := dbf.FieldsCount(); n != 9 {
+		t.Errorf("FieldsCount() = %d after reopening, want 9", n)
+	}
+
+	tests := []struct {
+		text  map[string]string
+		data  []byte
+		nulls []string
+	}{
+		{
+			text: map[string]string{"ID": "-42", "PRICE": "12.3456", "RATE": "1.25", "NAME": "abc", "QTY": "3.50", "OK": "T", "CODE": "600570"},
+			data: []byte{0, 1, 2},
+		},
+		{
+			text: map[string]string{"ID": "0", "PRICE": "0", "AT": "", "RATE": "0", "NAME": "", "QTY": "0.00", "OK": "0", "CODE": ""},
+			data: []byte{},
+		},
+		{
+			text:  map[string]string{"NAME": "", "QTY": ""},
+			data:  []byte("abcdef"),
+			nulls: []string{"NAME", "QTY"},
+		},
+	}
+	for i, tt := range tests {
+		if err := dbf.Go(uint32(i + 1)); err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range tt.text {
+			if got, err := dbf.StringValueByName(name); err != nil || got != want {
+				t.Errorf("record %d: %s = %q, %v, want %q", i+1, name, got, err, want)
+			}
+		}
+		if got, err := dbf.BytesValueByName("DATA"); err != nil || !bytes.Equal(got, tt.data) {
+			t.Errorf("record %d: DATA = %v, %v, want %v", i+1, got, err, tt.data)
+		}
+		for _, name := range []string{"NAME", "QTY"} {
+			want := false
+			for _, null := range tt.nulls {
+				want = want || null == name
+			}
+			if got, err := dbf.IsNullByName(name); err != nil || got != want {
+				t.Errorf("record %d: IsNullByName(%s) = %v, %v, want %v", i+1, name, got, err, want)
+			}
+		}
+	}
+
+	if err := dbf.Go(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := dbf.TimeValueByNameX("AT"); !got.Equal(at) {
+		t.Errorf("AT = %v, want %v", got, at)
+	}
+	if got := dbf.CurrencyValueByNameX("PRICE"); !got.Equal(decimal.RequireFromString("12.3456")) {
+		t.Errorf("PRICE = %v, want 12.3456", got)
+	}
+	if err := dbf.Go(2); err != nil {
+		t.Fatal(err)
+	}
+	if got := dbf.TimeValueByNameX("AT"); !got.IsZero() {
+		t.Errorf("blank AT = %v, want the zero time", got)
+	}
+}
+
+func TestBlankField(t *testing.T) {
+	dbf := NewFile(filepath.Join(t.TempDir(), "blank.dbf"), "gbk")
+	dbf.AddNumericField("QTY", 8, 2)
+	dbf.AddFloatField("PRICE", 6, 0)
+	dbf.AddBooleanField("OK")
+	dbf.AddStringField("CODE", 6)
+	dbf.AddDateField("DAY")
+	dbf.Append()
+	// 字段原来的内容要全部覆盖
+	for i := 1; i < len(dbf.recordBuff); i++ {
+		dbf.recordBuff[i] = '9'
+	}
+	want := map[string]string{
+		"QTY":   "    0.00",
+		"PRICE": "     0",
+		"OK":    "0",
+		"CODE":  "      ",
+		"DAY":   "        ",
+	}
+	for name, text := range want {
+		field := dbf.fieldsMap[name]
+		dbf.blankField(field)
+		if got := string(dbf.fieldBuff(field)); got != text {
+			t.Errorf("blank %s = %q, want %q", name, got, text)
+		}
+	}
+}
+
+func TestSetFieldValueShorter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "shorter.dbf")
+	dbf := NewFile(filename, "gbk")
+	dbf.AddNumericField("AMT", 8, 2)
+	dbf.AddStringField("CODE", 6)
+	dbf.Append()
+	// 新增记录的默认值是0.00，12不能写成1200
+	if err := dbf.SetFieldValue("AMT", "12"); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(dbf.fieldBuff(dbf.fieldsMap["AMT"])); got != "      12" {
+		t.Errorf("AMT = %q, want %q", got, "      12")
+	}
+	dbf.SetFieldValue("AMT", "12.50")
+	dbf.SetFieldValue("CODE", "600570")
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	dbf.Close()
+
+	dbf, err := LoadFrom(filename, "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if err := dbf.First(); err != nil {
+		t.Fatal(err)
+	}
+	// 修改已有记录，短的值把长的值全部覆盖
+	dbf.SetFieldValue("AMT", "3")
+	dbf.SetFieldValue("CODE", "A")
+	if err := dbf.Post(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Go(1); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"AMT": "3", "CODE": "A"} {
+		if got := dbf.StringValueByNameX(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if err := dbf.SetFieldValue("AMT", "123456789"); !errors.Is(err, value_too_wide) {
+		t.Errorf("SetFieldValue(AMT, 123456789): got %v, want %v", err, value_too_wide)
+	}
+}
+
+func TestDateTimeDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := time.Local
+	time.Local = loc
+	defer func() { time.Local = local }()
+
+	// 2021-03-14 02:00 开始夏令时，2021-11-07 02:00 结束
+	for _, want := range []time.Time{
+		time.Date(2021, 3, 14, 3, 30, 0, 0, loc),
+		time.Date(2021, 3, 14, 23, 59, 59, 999e6, loc),
+		time.Date(2021, 11, 7, 12, 0, 0, 0, loc),
+		time.Date(2021, 11, 7, 0, 0, 0, 0, loc),
+	} {
+		buff := make([]byte, 8)
+		encodeDateTime(buff, want)
+		if got := decodeDateTime(buff); !got.Equal(want) {
+			t.Errorf("decodeDateTime(encodeDateTime(%v)) = %v", want, got)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package godbf
+
+import (
+	"encoding/binary"
+)
+
+// Writer 批量新增记录。
+// 记录先缓存在内存里面，Flush的时候只加一次锁，把缓存的记录一次写到文件尾，最后才更新一次头部的数据条数，
+// 所以其它进程要么看不到这一批记录，要么看到全部，写失败的时候文件会恢复到写之前的长度
+type Writer struct {
+	dbf        *DBF
+	batchSize  int                       //缓存的记录数达到batchSize的时候自动Flush，0表示只在调用Flush的时候写
+	buff       []byte                    //缓存的记录
+	count      int                       //缓存的记录数
+	memoValues map[int]map[string][]byte //缓存的记录的备注数据，key是记录在这一批里面的序号
+}
+
+// NewWriter 创建批量新增记录的Writer，batchSize为0的时候只在调用Flush的时候写
+func (dbf *DBF) NewWriter(batchSize int) *Writer {
+	if batchSize < 0 {
+		batchSize = 0
+	}
+	return &Writer{
+		dbf:       dbf,
+		batchSize: batchSize,
+		buff:      make([]byte, 0, batchSize*int(dbf.head.recordSize)),
+	}
+}
+
+// Append 开始新增一条记录，字段的值用DBF的SetFieldValue等方法设置，然后调用Writer的Post
+func (w *Writer) Append() {
+	w.dbf.Append()
+}
+
+// Post 把当前记录放到缓存里面，缓存的记录数达到batchSize的时候自动Flush。
+// 自动Flush失败的时候当前记录已经在缓存里面，不要重新Post，可以再调用Flush重试，或者调用Discard放弃整批记录
+func (w *Writer) Post() error {
+	if w.dbf.fieldsCount <= 0 {
+		return empty_fields
+	}
+	w.buff = append(w.buff, w.dbf.recordBuff...)
+	if len(w.dbf.memoValues) > 0 {
+		if w.memoValues == nil {
+			w.memoValues = make(map[int]map[string][]byte)
+		}
+		w.memoValues[w.count] = w.dbf.memoValues
+		w.dbf.memoValues = nil
+	}
+	w.count++
+	if w.batchSize > 0 && w.count >= w.batchSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Buffered 缓存里面还没有写的记录数
+func (w *Writer) Buffered() int {
+	return w.count
+}
+
+// Discard 丢弃缓存里面还没有写的记录
+func (w *Writer) Discard() {
+	w.buff = w.buff[:0]
+	w.count = 0
+	w.memoValues = nil
+}
+
+// Flush 加锁之后把缓存的记录一次写到文件尾，再更新头部的数据条数
+func (w *Writer) Flush() (err error) {
+	if w.count == 0 {
+		return nil
+	}
+	dbf := w.dbf
+	// 有可能是新增文件之后没有保存，就直接新增数据提交，这种情况下需要先保存文件
+	if dbf.file == nil {
+		if err = dbf.SaveNewFile(); err != nil {
+			return err
+		}
+	}
+	if err = dbf.filelock.lock(); err != nil {
+		return err
+	}
+	defer dbf.filelock.unlock()
+	// 需要重新读取一下头部，不然有可能加锁写之前，有其它进程已经写了新数据进来
+	if err = dbf.readHead(); err != nil {
+		return err
+	}
+	// 先保存备注，把备注的块号写到缓存的记录里面
+	recordSize := int(dbf.head.recordSize)
+	for i, values := range w.memoValues {
+		if err = dbf.writeMemoValues(w.buff[i*recordSize:(i+1)*recordSize], values); err != nil {
+			return err
+		}
+	}
+	offset := int64(dbf.head.dataOffset) + int64(dbf.head.recordCount)*int64(dbf.head.recordSize)
+	if _, err = dbf.file.WriteAt(append(w.buff, fileTerminator), offset); err != nil {
+		// 数据条数还没有更新，把写了一部分的记录去掉，恢复文件结束符
+		if dbf.file.Truncate(offset) == nil {
+			dbf.file.WriteAt([]byte{fileTerminator}, offset)
+		}
+		return err
+	}
+	//更新头信息里面的数据条数
+	recordCountBuff := make([]byte, 4)
+	binary.LittleEndian.PutUint32(recordCountBuff, dbf.head.recordCount+uint32(w.count))
+	if _, err = dbf.file.WriteAt(recordCountBuff, 4); err != nil {
+		return err
+	}
+	dbf.head.recordCount += uint32(w.count)
+	w.Discard()
+	return nil
+}
+
+// AppendBatch 新增count条记录，fill设置第i条记录的字段值，全部记录一次写进去，fill返回错误的时候一条都不写
+func (dbf *DBF) AppendBatch(count int, fill func(i int) error) error {
+	w := dbf.NewWriter(0)
+	for i := 0; i < count; i++ {
+		w.Append()
+		if err := fill(i); err != nil {
+			return err
+		}
+		if err := w.Post(); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,154 @@
+package godbf
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newWriterFile(t *testing.T) (*DBF, string) {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "writer.dbf")
+	dbf := NewFile(filename, "gbk")
+	dbf.AddStringField("CODE", 6)
+	dbf.AddNumericField("QTY", 8, 2)
+	dbf.AddMemoField("NOTE")
+	if err := dbf.SaveNewFile(); err != nil {
+		t.Fatal(err)
+	}
+	return dbf, filename
+}
+
+// readRecords reopens filename and returns CODE|QTY|NOTE of every record
+func readRecords(t *testing.T, filename string) []string {
+	t.Helper()
+	dbf, err := LoadFrom(filename, "gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	records := []string{}
+	for i := uint32(1); i <= dbf.RecordCount(); i++ {
+		if err := dbf.Go(i); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, strings.Join([]string{
+			dbf.StringValueByNameX("CODE"),
+			dbf.StringValueByNameX("QTY"),
+			dbf.StringValueByNameX("NOTE"),
+		}, "|"))
+	}
+	return records
+}
+
+func postRecord(t *testing.T, w *Writer, i int, note string) {
+	t.Helper()
+	w.Append()
+	w.dbf.SetFieldValue("CODE", "C"+strconv.Itoa(i))
+	w.dbf.SetFieldValue("QTY", strconv.Itoa(i))
+	if note != "" {
+		w.dbf.SetFieldValue("NOTE", note)
+	}
+	if err := w.Post(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriterAutoFlush(t *testing.T) {
+	dbf, filename := newWriterFile(t)
+	defer dbf.Close()
+	w := dbf.NewWriter(2)
+
+	postRecord(t, w, 1, "第一条备注")
+	if n := w.Buffered(); n != 1 {
+		t.Errorf("Buffered() = %d, want 1", n)
+	}
+	if records := readRecords(t, filename); len(records) != 0 {
+		t.Errorf("records written before the batch is full: %q", records)
+	}
+
+	postRecord(t, w, 2, "")
+	if n := w.Buffered(); n != 0 {
+		t.Errorf("Buffered() = %d after the batch is full, want 0", n)
+	}
+	want := []string{"C1|1|第一条备注", "C2|2|"}
+	if records := readRecords(t, filename); !reflect.DeepEqual(records, want) {
+		t.Errorf("after auto flush: got %q, want %q", records, want)
+	}
+
+	postRecord(t, w, 3, strings.Repeat("long ", 40))
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, "C3|3|"+strings.Repeat("long ", 40))
+	if records := readRecords(t, filename); !reflect.DeepEqual(records, want) {
+		t.Errorf("after Flush: got %q, want %q", records, want)
+	}
+	if n := dbf.RecordCount(); n != 3 {
+		t.Errorf("RecordCount() = %d, want 3", n)
+	}
+}
+
+func TestWriterDiscard(t *testing.T) {
+	dbf, filename := newWriterFile(t)
+	defer dbf.Close()
+	w := dbf.NewWriter(0)
+
+	postRecord(t, w, 1, "discarded")
+	postRecord(t, w, 2, "")
+	w.Discard()
+	if n := w.Buffered(); n != 0 {
+		t.Errorf("Buffered() = %d after Discard, want 0", n)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if records := readRecords(t, filename); len(records) != 0 {
+		t.Errorf("discarded records were written: %q", records)
+	}
+
+	postRecord(t, w, 3, "kept")
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"C3|3|kept"}
+	if records := readRecords(t, filename); !reflect.DeepEqual(records, want) {
+		t.Errorf("got %q, want %q", records, want)
+	}
+}
+
+func TestAppendBatch(t *testing.T) {
+	dbf, filename := newWriterFile(t)
+	defer dbf.Close()
+
+	fillErr := errors.New("fill failed")
+	err := dbf.AppendBatch(5, func(i int) error {
+		if i == 3 {
+			return fillErr
+		}
+		dbf.SetFieldValue("CODE", "X"+strconv.Itoa(i))
+		return dbf.SetFieldValue("NOTE", "memo")
+	})
+	if err != fillErr {
+		t.Fatalf("AppendBatch: got %v, want %v", err, fillErr)
+	}
+	if records := readRecords(t, filename); len(records) != 0 {
+		t.Errorf("records written after a fill error: %q", records)
+	}
+
+	err = dbf.AppendBatch(3, func(i int) error {
+		dbf.SetFieldValue("CODE", "C"+strconv.Itoa(i))
+		dbf.SetFieldValue("QTY", strconv.Itoa(i))
+		return dbf.SetFieldValue("NOTE", "memo"+strconv.Itoa(i))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"C0|0|memo0", "C1|1|memo1", "C2|2|memo2"}
+	if records := readRecords(t, filename); !reflect.DeepEqual(records, want) {
+		t.Errorf("got %q, want %q", records, want)
+	}
+}
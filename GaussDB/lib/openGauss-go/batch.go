@@ -0,0 +1,246 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+var errEmptyBatch = errors.New("pq: batch has no queued statements")
+
+// Batch queues statements, each with its own arguments, to be sent to the
+// server in a single network round trip by SendBatch.
+type Batch struct {
+	items []batchItem
+}
+
+type batchItem struct {
+	query string
+	args  []interface{}
+}
+
+// Queue appends a statement and its arguments to the batch.  Arguments are
+// converted with driver.DefaultParameterConverter, the same way database/sql
+// converts query arguments.
+func (b *Batch) Queue(query string, args ...interface{}) {
+	b.items = append(b.items, batchItem{query: query, args: args})
+}
+
+// Len returns the number of queued statements.
+func (b *Batch) Len() int {
+	return len(b.items)
+}
+
+// BatchResult is the outcome of one statement of a Batch.
+type BatchResult struct {
+	// RowsAffected is the number of rows the statement affected.
+	RowsAffected int64
+	// Err is the error the server reported for the statement, if any.
+	Err error
+}
+
+// SendBatch pipelines every statement of b on the connection and waits for
+// all of them to complete.  Each statement is sent with the extended query
+// protocol followed by its own Sync, so outside of a transaction every
+// statement runs on its own and a failing statement does not prevent the
+// following ones from running; inside a transaction a failure aborts the
+// transaction as usual and the following statements report that.
+//
+// Rows returned by the statements are discarded.  The returned slice holds
+// one BatchResult per queued statement, in queue order.  The error is only
+// set when the batch could not be sent or the responses could not be read, in
+// which case the results received so far are returned.
+//
+// SendBatch works on a driver connection, which can be obtained with
+// sql.Conn.Raw:
+//
+//	var results []pq.BatchResult
+//	err = conn.Raw(func(driverConn interface{}) error {
+//		results, err = pq.SendBatch(ctx, driverConn.(driver.Conn), batch)
+//		return err
+//	})
+func SendBatch(ctx context.Context, c driver.Conn, b *Batch) ([]BatchResult, error) {
+	cn, ok := c.(*conn)
+	if !ok {
+		return nil, fmt.Errorf("pq: SendBatch requires a pq connection, got %T", c)
+	}
+	cn.LockReaderMutex()
+	defer cn.UnlockReaderMutex()
+	return cn.sendBatch(ctx, b)
+}
+
+func (cn *conn) sendBatch(ctx context.Context, b *Batch) ([]BatchResult, error) {
+	if cn.getBad() {
+		return nil, driver.ErrBadConn
+	}
+	if cn.inCopy {
+		return nil, errCopyInProgress
+	}
+	if b == nil || len(b.items) == 0 {
+		return nil, errEmptyBatch
+	}
+	if finish := cn.watchCancel(ctx); finish != nil {
+		defer finish()
+	}
+	if err := cn.statementTimeout(ctx); err != nil {
+		return nil, err
+	}
+
+	if cn.pgconn != nil {
+		// The client encryption hooks keep their state per thread: build the
+		// batch and free its memory on the same one.
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+	}
+	w, err := cn.buildBatch(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// Write the batch while the responses are read, so that neither side
+	// blocks on a full socket buffer when the batch is large.  The writer
+	// only touches the socket.  The first side to fail closes the socket so
+	// that the other one returns too, and its error is the one reported.
+	var (
+		failOnce sync.Once
+		failErr  error
+	)
+	fail := func(err error) {
+		failOnce.Do(func() {
+			failErr = err
+			cn.c.Close()
+		})
+	}
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		if _, err := cn.c.Write(w.wrap()); err != nil {
+			fail(fmt.Errorf("fail to send: %w", err))
+		}
+	}()
+
+	results, err := cn.readBatchResults(len(b.items))
+	if err != nil {
+		fail(err)
+	}
+	<-sent
+	if cn.pgconn != nil {
+		free_mem_manager()
+	}
+	if failErr != nil {
+		cn.setBad()
+		return results, failErr
+	}
+	return results, nil
+}
+
+// buildBatch encodes the Parse/Bind/Execute/Sync messages of every statement
+// of b.  The message is built in its own buffer rather than the connection's
+// scratch buffer, which is used for reading while the batch is sent.
+func (cn *conn) buildBatch(b *Batch) (*writeBuf, error) {
+	w := &writeBuf{buf: []byte{'P', 0, 0, 0, 0}, pos: 1}
+	for i, item := range b.items {
+		if len(item.args) >= 65536 {
+			return nil, fmt.Errorf("batch statement %d: got %d parameters but PostgreSQL only supports 65535 parameters", i, len(item.args))
+		}
+		args := make([]driver.Value, len(item.args))
+		for j, arg := range item.args {
+			v, err := driver.DefaultParameterConverter.ConvertValue(arg)
+			if err != nil {
+				return nil, fmt.Errorf("batch statement %d: cannot convert argument %d: %w", i, j+1, err)
+			}
+			args[j] = v
+		}
+
+		q := item.query
+		if cn.pgconn != nil {
+			var queryCstring *Cchar
+			var err error
+			q, queryCstring, err = cn.replaceQuery("", q)
+			Cfree(unsafe.Pointer(queryCstring))
+			if err != nil {
+				return nil, fmt.Errorf("cannot replace query: %w", err)
+			}
+			accept_pending_statements(cn.pgconn)
+		}
+
+		if i > 0 {
+			w.next('P')
+		}
+		w.byte(0) // unnamed statement
+		w.string(transferPlaceholder(q))
+		w.int16(0)
+
+		w.next('B')
+		w.int16(0) // unnamed portal and statement
+		if err := cn.sendBinaryParameters("", w, args, nil); err != nil {
+			return nil, fmt.Errorf("cannot send binary parameter: %w", err)
+		}
+		w.bytes(colFmtDataAllText)
+
+		w.next('E')
+		w.byte(0)
+		w.int32(0)
+
+		w.next('S')
+	}
+	return w, nil
+}
+
+// readBatchResults reads the responses of n pipelined statements, each ending
+// with ReadyForQuery.  An error leaves the connection out of sync with the
+// server, the caller must not use it again.
+func (cn *conn) readBatchResults(n int) ([]BatchResult, error) {
+	results := make([]BatchResult, 0, n)
+	for len(results) < n {
+		var (
+			res     driver.Result
+			stmtErr error
+		)
+	stmt:
+		for {
+			t, r, err := cn.recv1()
+			if err != nil {
+				cn.setBad()
+				return results, fmt.Errorf("cannot recv from conn: %w", err)
+			}
+			switch t {
+			case '1', '2': // ParseComplete, BindComplete
+			case 'C':
+				s, err := r.string()
+				if err != nil {
+					cn.setBad()
+					return results, fmt.Errorf("cannot get string from read buf: %w", err)
+				}
+				res, _, err = cn.parseComplete(s)
+				if err != nil {
+					cn.setBad()
+					return results, fmt.Errorf("cannot parse complete: %w", err)
+				}
+			case 'I':
+				res = emptyRows
+			case 'T', 'D', 's':
+				// ignore any results
+			case 'E':
+				stmtErr = parseError(r, cn)
+			case 'Z':
+				cn.processReadyForQuery(r)
+				break stmt
+			default:
+				cn.setBad()
+				return results, fmt.Errorf("unknown batch response: %q", t)
+			}
+		}
+
+		result := BatchResult{Err: stmtErr}
+		if stmtErr == nil && res != nil {
+			result.RowsAffected, _ = res.RowsAffected()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
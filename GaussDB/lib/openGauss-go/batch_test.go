@@ -0,0 +1,129 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+func TestSendBatch(t *testing.T) {
+	script := pqtest.NewScript().
+		On("INSERT INTO items VALUES ($1)", &pqtest.Result{Tag: "INSERT 0 1"}).
+		On("UPDATE items SET n = n + 1", &pqtest.Result{Tag: "UPDATE 3"}).
+		On("INSERT INTO missing VALUES ($1)", &pqtest.Result{Err: pqtest.NewError("42P01", `relation "missing" does not exist`)}).
+		On("select 1", int4Result("?column?", 1))
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	b := &Batch{}
+	b.Queue("INSERT INTO items VALUES ($1)", 1)
+	b.Queue("INSERT INTO missing VALUES ($1)", 2)
+	b.Queue("UPDATE items SET n = n + 1")
+	b.Queue("select 1")
+
+	var results []BatchResult
+	err := withDriverConn(t, db, func(c driver.Conn) (err error) {
+		results, err = SendBatch(context.Background(), c, b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("got %d results, want 4", len(results))
+	}
+	for i, want := range []int64{1, 0, 3, 1} {
+		if results[i].RowsAffected != want {
+			t.Errorf("statement %d: %d rows affected, want %d", i, results[i].RowsAffected, want)
+		}
+	}
+	var pgErr *Error
+	if !errors.As(results[1].Err, &pgErr) || pgErr.Code != "42P01" {
+		t.Errorf("statement 1: got error %v", results[1].Err)
+	}
+	for _, i := range []int{0, 2, 3} {
+		if results[i].Err != nil {
+			t.Errorf("statement %d: %v", i, results[i].Err)
+		}
+	}
+}
+
+func TestSendBatchEmpty(t *testing.T) {
+	_, db, done := openTestDB(t, pqtest.NewScript())
+	defer done()
+
+	err := withDriverConn(t, db, func(c driver.Conn) error {
+		_, err := SendBatch(context.Background(), c, &Batch{})
+		return err
+	})
+	if err != errEmptyBatch {
+		t.Fatalf("got error %v, want %v", err, errEmptyBatch)
+	}
+}
+
+// largeBatch returns a batch of n statements big enough to fill the socket
+// buffers in both directions.
+func largeBatch(n int) *Batch {
+	query := "UPDATE items SET name = $1 WHERE name <> '" + strings.Repeat("x", 200) + "'"
+	b := &Batch{}
+	for i := 0; i < n; i++ {
+		b.Queue(query, "item")
+	}
+	return b
+}
+
+func TestSendBatchLarge(t *testing.T) {
+	script := pqtest.NewScript().OnPrefix("UPDATE items", &pqtest.Result{Tag: "UPDATE 1"})
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	const n = 20000
+	var results []BatchResult
+	err := withDriverConn(t, db, func(c driver.Conn) (err error) {
+		results, err = SendBatch(context.Background(), c, largeBatch(n))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != n {
+		t.Fatalf("got %d results, want %d", len(results), n)
+	}
+}
+
+func TestSendBatchErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		res  *pqtest.Result
+	}{
+		{"bad command tag", &pqtest.Result{Tag: "UPDATE many"}},
+		{"connection lost", &pqtest.Result{Drop: true}},
+	}
+	for _, tt := range tests {
+		// large rows fill the socket buffers with responses once they are
+		// no longer read, which blocks the server and then the writer
+		tt.res.Columns = []pqtest.Column{{Name: "name", OID: 25}}
+		tt.res.Rows = [][][]byte{pqtest.Row(strings.Repeat("y", 4096))}
+		script := pqtest.NewScript().OnPrefix("UPDATE items", tt.res)
+		_, db, done := openTestDB(t, script)
+
+		err := withDriverConn(t, db, func(c driver.Conn) error {
+			_, err := SendBatch(context.Background(), c, largeBatch(20000))
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			if !c.(*conn).getBad() {
+				t.Errorf("%s: connection was not marked bad", tt.name)
+			}
+			return nil
+		})
+		done()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+	}
+}
@@ -18,6 +18,9 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pgpassfile"
+	"gitee.com/opengauss/openGauss-connector-go-pq/pgservicefile"
 )
 
 // Config is the settings used to establish a connection to a PostgreSQL server. It must be created by ParseConfig. A
@@ -40,6 +43,11 @@ type Config struct {
 	RuntimeParams map[string]string // Run-time parameters to set on connection as session default values (e.g. search_path or application_name)
 	Fallbacks     []*FallbackConfig
 	crlList       *pkix.CertificateList
+	// passfile password of Host, see FallbackConfig.Password
+	hostPassword string
+	// passfile read when no password is given, for the coordinator nodes
+	// found after parsing
+	passfile *pgpassfile.Passfile
 
 	targetSessionAttrs uint8
 	// ValidateConnect is called during a connection attempt after a successful authentication with the PostgreSQL server.
@@ -64,9 +72,40 @@ type Config struct {
 	// debugging.
 	disablePreparedBinaryResult bool
 	binaryParameters            bool
+	// If set, results of prepared statements are also received in binary
+	// format for the types decoded by decode_binary.go, see binaryResultType.
+	binaryResults bool
 
 	Logger   Logger
 	LogLevel LogLevel
+
+	// StatementCacheCapacity is the number of prepared statements cached per
+	// connection for queries with arguments, set with the
+	// statement_cache_capacity setting.  Zero disables the cache.
+	StatementCacheCapacity int
+
+	// PreferSlaveRecheckInterval is how long a target_session_attrs=preferSlave
+	// connection which fell back to the master is reused before it is closed,
+	// so that the next connection finds a standby again once one is back.  It
+	// is set in seconds with the preferSlaveRecheckTime setting.  Zero, the
+	// default, disables the recycling.
+	PreferSlaveRecheckInterval time.Duration
+
+	// Tracer, if set, receives structured events for connect, prepare,
+	// query, exec, copy and transaction operations.
+	Tracer Tracer
+
+	// ResetSessionQuery is run when the connection is returned to the pool
+	// if a statement changed the session state, e.g. "DISCARD ALL", set with
+	// the reset_session_query setting.  RuntimeParams are set again after
+	// it.  Empty disables the reset.
+	ResetSessionQuery string
+
+	// DeadlineStatementTimeout makes statements run with a context deadline
+	// set statement_timeout to the time left, set with the
+	// deadline_statement_timeout setting.  It costs a round trip per
+	// statement.
+	DeadlineStatementTimeout bool
 }
 
 // Copy returns a deep copy of the config that is safe to use and modify.
@@ -114,6 +153,9 @@ type FallbackConfig struct {
 	Host      string // host (e.g. localhost) or path to unix domain socket directory (e.g. /private/tmp)
 	Port      uint16
 	TLSConfig *tls.Config // nil disables TLS
+	// Password found in the passfile for this host, base64 encoded like
+	// Config.Password.  Empty means Config.Password is used.
+	Password string
 }
 
 // NetworkAddress converts a PostgreSQL host and port into network and address suitable for use with
@@ -167,6 +209,13 @@ func NetworkAddress(host string, port uint16) (network, address string) {
 //	PGAPPNAME
 //	PGCONNECT_TIMEOUT
 //	PGTARGETSESSIONATTRS
+//	PGPASSFILE
+//	PGSERVICE
+//	PGSERVICEFILE
+//
+// A service named with the service key or PGSERVICE is looked up in the service file (PGSERVICEFILE, default
+// ~/.pg_service.conf) and then in pg_service.conf of PGSYSCONFDIR. Its settings are overridden by the connection
+// string.
 //
 // They are usually but not always the environment variable name downcased and without the "PG" prefix.
 //
@@ -186,8 +235,8 @@ func NetworkAddress(host string, port uint16) (network, address string) {
 //
 // If a host name resolves into multiple addresses, libpq will try all addresses. pgconn will only try the first.
 //
-// When multiple hosts are specified, libpq allows them to have different passwords set via the .pgpass file. pgconn
-// does not.
+// When multiple hosts are specified, the password of every host is looked up in the .pgpass file (PGPASSFILE, default
+// ~/.pgpass) unless a password is given.
 //
 // In addition, ParseConfig accepts the following options:
 //
@@ -268,6 +317,14 @@ func ParseConfig(connString string) (*Config, *DistConfig, error) {
 	}
 
 	settings := mergeSettings(defSettings, envSettings, connStringSettings)
+	if service, present := settings["service"]; present {
+		serviceSettings, err := parseServiceSettings(settings["servicefile"], service)
+		if err != nil {
+			return nil, nil, &parseConfigError{connString: connString, msg: "failed to read service", err: err}
+		}
+
+		settings = mergeSettings(defSettings, envSettings, serviceSettings, connStringSettings)
+	}
 	encodePassword(&settings)
 	config := &Config{
 		createdByParseConfig: true,
@@ -332,10 +389,14 @@ func ParseConfig(connString string) (*Config, *DistConfig, error) {
 		"database":                       struct{}{},
 		"user":                           struct{}{},
 		"password":                       struct{}{},
+		"passfile":                       struct{}{},
+		"service":                        struct{}{},
+		"servicefile":                    struct{}{},
 		"connect_timeout":                struct{}{},
 		"autoBalance":                    struct{}{},
 		"recheckTime":                    struct{}{},
 		"usingEip":                       struct{}{},
+		"preferSlaveRecheckTime":         struct{}{},
 		"enable_ce":                      struct{}{},
 		"auto_sendtoken":                 struct{}{},
 		"key_info":                       struct{}{},
@@ -350,7 +411,11 @@ func ParseConfig(connString string) (*Config, *DistConfig, error) {
 		"min_read_buffer_size":           struct{}{},
 		"disable_prepared_binary_result": struct{}{},
 		"binary_parameters":              struct{}{},
+		"binary_results":                 struct{}{},
 		"loggerLevel":                    struct{}{},
+		"statement_cache_capacity":       struct{}{},
+		"reset_session_query":            struct{}{},
+		"deadline_statement_timeout":     struct{}{},
 	}
 
 	for k, v := range settings {
@@ -373,6 +438,15 @@ func ParseConfig(connString string) (*Config, *DistConfig, error) {
 
 	var fallbacks []*FallbackConfig
 
+	// Without a password the passfile is looked up for every host, as
+	// libpq does.
+	var passfile *pgpassfile.Passfile
+	if config.Password == "" {
+		if pf, err := pgpassfile.ReadPassfile(settings["passfile"]); err == nil {
+			passfile = pf
+		}
+	}
+
 	hosts := strings.Split(settings["host"], ",")
 	ports := strings.Split(settings["port"], ",")
 
@@ -402,11 +476,16 @@ func ParseConfig(connString string) (*Config, *DistConfig, error) {
 			}
 		}
 		distCfg.tlsCfgs = tlsConfigs
+		var password string
+		if passfile != nil {
+			password = findPassfilePassword(passfile, host, port, config.Database, config.User)
+		}
 		for _, tlsConfig := range tlsConfigs {
 			fallbacks = append(fallbacks, &FallbackConfig{
 				Host:      host,
 				Port:      port,
 				TLSConfig: tlsConfig,
+				Password:  password,
 			})
 		}
 	}
@@ -415,6 +494,8 @@ func ParseConfig(connString string) (*Config, *DistConfig, error) {
 	config.Port = fallbacks[0].Port
 	config.TLSConfig = fallbacks[0].TLSConfig
 	config.Fallbacks = fallbacks[1:]
+	config.hostPassword = fallbacks[0].Password
+	config.passfile = passfile
 
 	tryParseSslCrl(settings, config)
 	targetSessionAttrs, err := parseTargetSessionAttr(settings, connString)
@@ -428,6 +509,10 @@ func ParseConfig(connString string) (*Config, *DistConfig, error) {
 	if err != nil {
 		return nil, nil, &parseConfigError{connString: connString, msg: "invalid disable_prepared_binary_result", err: err}
 	}
+	config.binaryResults, err = parseBoolSettings("binary_results", settings, false)
+	if err != nil {
+		return nil, nil, &parseConfigError{connString: connString, msg: "invalid binary_results", err: err}
+	}
 	config.binaryParameters, err = parseBoolSettings("binary_parameters", settings, false)
 	if err != nil {
 		return nil, nil, &parseConfigError{connString: connString, msg: "invalid binary_parameters", err: err}
@@ -455,6 +540,24 @@ func ParseConfig(connString string) (*Config, *DistConfig, error) {
 			return nil, nil, &parseConfigError{connString: connString, msg: "invalid recheckTime", err: err}
 		}
 	}
+	if v, ok := settings["statement_cache_capacity"]; ok {
+		config.StatementCacheCapacity, err = strconv.Atoi(v)
+		if err != nil || config.StatementCacheCapacity < 0 {
+			return nil, nil, &parseConfigError{connString: connString, msg: "invalid statement_cache_capacity", err: err}
+		}
+	}
+	config.ResetSessionQuery = settings["reset_session_query"]
+	config.DeadlineStatementTimeout, err = parseBoolSettings("deadline_statement_timeout", settings, false)
+	if err != nil {
+		return nil, nil, &parseConfigError{connString: connString, msg: "invalid deadline_statement_timeout", err: err}
+	}
+	if v, ok := settings["preferSlaveRecheckTime"]; ok {
+		sec, err := strconv.Atoi(v)
+		if err != nil || sec < 0 {
+			return nil, nil, &parseConfigError{connString: connString, msg: "invalid preferSlaveRecheckTime", err: err}
+		}
+		config.PreferSlaveRecheckInterval = time.Duration(sec) * time.Second
+	}
 	distCfg.isUsingEip, err = parseBoolSettings("usingEip", settings, true)
 	if err != nil {
 		return nil, nil, &parseConfigError{connString: connString, msg: "invalid usingEip", err: err}
@@ -642,6 +745,9 @@ func parseEnvSettings() map[string]string {
 		"PGSSLCRL":             "sslcrl",
 		"PGTARGETSESSIONATTRS": "target_session_attrs",
 		"PGLOGGERLEVEL":        "loggerLevel",
+		"PGPASSFILE":           "passfile",
+		"PGSERVICE":            "service",
+		"PGSERVICEFILE":        "servicefile",
 	}
 
 	for envname, realname := range nameMap {
@@ -654,6 +760,63 @@ func parseEnvSettings() map[string]string {
 	return settings
 }
 
+// parseServiceSettings returns the settings of service from the service file
+// at servicefilePath.  If the service is not defined there, the system-wide
+// pg_service.conf in PGSYSCONFDIR is tried, as libpq does.
+func parseServiceSettings(servicefilePath, serviceName string) (map[string]string, error) {
+	paths := []string{servicefilePath}
+	if sysconfdir := os.Getenv("PGSYSCONFDIR"); sysconfdir != "" {
+		paths = append(paths, filepath.Join(sysconfdir, "pg_service.conf"))
+	}
+
+	var service *pgservicefile.Service
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		servicefile, err := pgservicefile.ReadServicefile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read service file %v: %w", path, err)
+		}
+		if service, err = servicefile.GetService(serviceName); err == nil {
+			break
+		}
+	}
+	if service == nil {
+		return nil, fmt.Errorf("unable to find service: %v", serviceName)
+	}
+
+	nameMap := map[string]string{
+		"dbname": "database",
+	}
+
+	settings := make(map[string]string, len(service.Settings))
+	for k, v := range service.Settings {
+		if k2, present := nameMap[k]; present {
+			k = k2
+		}
+		settings[k] = v
+	}
+	return settings, nil
+}
+
+// findPassfilePassword looks up the password for host and port in passfile and
+// returns it base64 encoded, or an empty string if there is none.
+func findPassfilePassword(passfile *pgpassfile.Passfile, host string, port uint16, database, user string) string {
+	// libpq matches unix domain sockets as localhost
+	if network, _ := NetworkAddress(host, port); network == "unix" {
+		host = "localhost"
+	}
+	password := passfile.FindPassword(host, strconv.Itoa(int(port)), database, user)
+	if password == "" {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString([]byte(password))
+}
+
 func parseURLSettings(connString string) (map[string]string, error) {
 	settings := make(map[string]string)
 
@@ -0,0 +1,86 @@
+package pq
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePassfile writes a passfile into a temporary directory, which the
+// returned func removes.
+func writePassfile(t *testing.T, content string) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "pq-passfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "pgpass")
+	if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return name, func() { os.RemoveAll(dir) }
+}
+
+func TestParseConfigPassfileMultiHost(t *testing.T) {
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name     string
+		passfile string
+		host1    string
+		host2    string
+	}{
+		{
+			name:     "only first host",
+			passfile: "db1.example.com:5432:postgres:gauss:secret1\n",
+			host1:    encode("secret1"),
+			host2:    "",
+		},
+		{
+			name:     "own password per host",
+			passfile: "db1.example.com:5432:postgres:gauss:secret1\ndb2.example.com:5433:postgres:gauss:secret2\n",
+			host1:    encode("secret1"),
+			host2:    encode("secret2"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passfile, remove := writePassfile(t, tt.passfile)
+			defer remove()
+			config, _, err := ParseConfig("host=db1.example.com,db2.example.com port=5432,5433 " +
+				"user=gauss dbname=postgres sslmode=disable passfile=" + passfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Password != "" {
+				t.Errorf("Config.Password = %q, want it left empty", config.Password)
+			}
+			if config.hostPassword != tt.host1 {
+				t.Errorf("password of host 1 = %q, want %q", config.hostPassword, tt.host1)
+			}
+			if len(config.Fallbacks) != 1 {
+				t.Fatalf("got %d fallbacks, want 1", len(config.Fallbacks))
+			}
+			if config.Fallbacks[0].Password != tt.host2 {
+				t.Errorf("password of host 2 = %q, want %q", config.Fallbacks[0].Password, tt.host2)
+			}
+		})
+	}
+}
+
+func TestParseConfigPasswordOverridesPassfile(t *testing.T) {
+	passfile, remove := writePassfile(t, "*:*:*:*:fromfile\n")
+	defer remove()
+	config, _, err := ParseConfig("host=db1.example.com,db2.example.com user=gauss dbname=postgres " +
+		"sslmode=disable password=explicit passfile=" + passfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.hostPassword != "" || config.Fallbacks[0].Password != "" {
+		t.Errorf("passfile must not be read when a password is set, got %q and %q",
+			config.hostPassword, config.Fallbacks[0].Password)
+	}
+}
@@ -59,6 +59,13 @@ type parameterStatus struct {
 	// the current location based on the TimeZone value of the session, if
 	// available
 	currentLocation *time.Location
+
+	// the IntervalStyle of the session, if the server reports it
+	intervalStyle string
+
+	// the last in_hot_standby value, if the server reports it
+	inHotStandby       bool
+	hotStandbyReported bool
 }
 
 type transactionStatus byte
@@ -110,6 +117,10 @@ type conn struct {
 	scratch        [512]byte
 	txnStatus      transactionStatus
 	txnFinish      func()
+	// context of the transaction started by BeginTx, for tracing
+	txnCtx context.Context
+	// number of open nested transactions, see beginNested
+	txnDepth int
 	// Save connection arguments to use during CancelRequest.
 	dialer Dialer
 
@@ -138,6 +149,8 @@ type conn struct {
 	// If true this connection is in the middle of a COPY
 	inCopy                 bool
 	isMasterForPreferSlave bool
+	// when the preferSlave connection fell back to the master
+	masterSince time.Time
 
 	// If not nil, notices will be synchronously sent here
 	noticeHandler func(*Error)
@@ -147,6 +160,30 @@ type conn struct {
 
 	// mutex to safe-guard pgconn_free()
 	pgconnMutex sync.RWMutex
+
+	// prepared statements reused by query and exec, see
+	// Config.StatementCacheCapacity
+	stmtCache *stmtCache
+	// number of times the server deallocated all prepared statements, see
+	// stmt.reprepare
+	stmtResets int
+	// whether a statement changed the session state since the last reset,
+	// see Config.ResetSessionQuery
+	sessionChanged bool
+	// read deadline of the socket, see watchDeadline
+	readDeadline time.Time
+	// whether statement_timeout was set from a context deadline, and whether
+	// it was changed in the current transaction, see statementTimeout
+	stmtTimeoutSet   bool
+	stmtTimeoutInTxn bool
+	// If not nil, called when the server stopped responding, to stop
+	// dialing its node
+	evictNode func()
+
+	// If not nil, called once when the connection is closed.  Close can run
+	// concurrently, from the finish func of watchCancel.
+	onClose     func()
+	onCloseOnce sync.Once
 }
 
 func (cn *conn) LockReaderMutex() {
@@ -175,11 +212,15 @@ func (cn *conn) UnlockWriterMutex() {
 
 func (cn *conn) ResetSession(ctx context.Context) error {
 	cn.LockReaderMutex()
-	defer cn.UnlockReaderMutex()
-	if cn.pgconn != nil {
+	redial := cn.needsRedial()
+	if !redial && cn.pgconn != nil {
 		pgconn_reset(cn.pgconn)
 	}
-	return nil
+	cn.UnlockReaderMutex()
+	if redial {
+		return driver.ErrBadConn
+	}
+	return cn.resetSessionState(ctx)
 }
 
 func (cn *conn) shouldLog(lvl LogLevel) bool {
@@ -258,9 +299,14 @@ func (cn *conn) checkIsInTransaction(intxn bool) (err error) {
 	return nil
 }
 
+// Begin starts a transaction, or a nested transaction in a savepoint if a
+// transaction is already open.
 func (cn *conn) Begin() (_ driver.Tx, err error) {
 	cn.LockReaderMutex()
 	defer cn.UnlockReaderMutex()
+	if cn.isInTransaction() {
+		return cn.beginNested()
+	}
 	return cn.begin("")
 }
 
@@ -291,12 +337,16 @@ func (cn *conn) closeTxn() {
 	if finish := cn.txnFinish; finish != nil {
 		finish()
 	}
+	cn.txnCtx = nil
+	cn.txnDepth = 0
 }
 
 func (cn *conn) Commit() (err error) {
 	cn.LockReaderMutex()
 	defer cn.UnlockReaderMutex()
 	defer cn.closeTxn()
+	span := cn.startTrace(cn.txnCtx, TraceCommit, "", 0)
+	defer func() { span.end(nil, err) }()
 	if cn.getBad() {
 		return driver.ErrBadConn
 	}
@@ -335,9 +385,18 @@ func (cn *conn) Rollback() (err error) {
 	cn.LockReaderMutex()
 	defer cn.UnlockReaderMutex()
 	defer cn.closeTxn()
+	span := cn.startTrace(cn.txnCtx, TraceRollback, "", 0)
+	defer func() { span.end(nil, err) }()
 	if cn.getBad() {
 		return driver.ErrBadConn
 	}
+	if cn.inCopy {
+		// database/sql rolls back from another goroutine when the context of
+		// the transaction is done, and ROLLBACK cannot be sent while the
+		// server reads COPY data.  Closing the connection aborts both.
+		cn.setBad()
+		return driver.ErrBadConn
+	}
 	return cn.rollback()
 }
 
@@ -619,7 +678,7 @@ func (noRows) RowsAffected() (int64, error) {
 
 // Decides which column formats to use for a prepared statement.  The input is
 // an array of type oids, one element per result column.
-func decideColumnFormats(colTyps []fieldDesc, forceText bool) (colFmts []format, colFmtData []byte, err error) { // TODO: named return value
+func decideColumnFormats(ps *parameterStatus, colTyps []fieldDesc, forceText, binaryResults bool) (colFmts []format, colFmtData []byte, err error) { // TODO: named return value
 	if len(colTyps) == 0 {
 		return nil, colFmtDataAllText, nil
 	}
@@ -632,31 +691,13 @@ func decideColumnFormats(colTyps []fieldDesc, forceText bool) (colFmts []format,
 	allBinary := true
 	allText := true
 	for i, t := range colTyps {
-		switch t.OID {
-		// This is the list of types to use binary mode for when receiving them
-		// through a prepared statement.  If a type appears in this list, it
-		// must also be implemented in binaryDecode in encode.go.
-		case oid.T_byteawithoutorderwithequalcol:
-			fallthrough
-		case oid.T_byteawithoutordercol:
-			fallthrough
-		case oid.T__byteawithoutorderwithequalcol:
-			fallthrough
-		case oid.T__byteawithoutordercol:
-			fallthrough
-		case oid.T_bytea:
-			fallthrough
-		case oid.T_int8:
-			fallthrough
-		case oid.T_int4:
-			fallthrough
-		case oid.T_int2:
-			fallthrough
-		case oid.T_uuid:
+		// The list of types to use binary mode for when receiving them through
+		// a prepared statement is in binaryResultType.  If a type appears in
+		// that list, it must also be implemented in binaryDecode in encode.go.
+		if binaryResultType(ps, t.OID, binaryResults) {
 			colFmts[i] = formatBinary
 			allText = false
-
-		default:
+		} else {
 			allBinary = false
 		}
 	}
@@ -676,7 +717,7 @@ func decideColumnFormats(colTyps []fieldDesc, forceText bool) (colFmts []format,
 }
 
 func (cn *conn) prepareTo(q, stmtName string) (st *stmt, err error) {
-	st = &stmt{cn: cn, name: stmtName}
+	st = &stmt{cn: cn, name: stmtName, sql: q, resets: cn.stmtResets}
 
 	if cn.pgconn != nil {
 		var queryCstring *Cchar
@@ -727,7 +768,7 @@ func (cn *conn) prepareTo(q, stmtName string) (st *stmt, err error) {
 	if err != nil {
 		return nil, fmt.Errorf("cannot read statement describe response: %w", err)
 	}
-	st.colFmts, st.colFmtData, err = decideColumnFormats(st.colTyps, cn.disablePreparedBinaryResult) // response info only
+	st.colFmts, st.colFmtData, err = decideColumnFormats(&cn.parameterStatus, st.colTyps, cn.disablePreparedBinaryResult, cn.config != nil && cn.config.binaryResults) // response info only
 	if err != nil {
 		return nil, fmt.Errorf("cannot decide column formats %w", err)
 	}
@@ -752,22 +793,28 @@ func transferPlaceholder(query string) string {
 }
 
 func (cn *conn) Prepare(q string) (_ driver.Stmt, err error) {
+	return cn.prepareContext(context.Background(), q)
+}
+
+// prepareContext prepares q; ctx is only used to trace a COPY, which lasts
+// until the statement is closed.
+func (cn *conn) prepareContext(ctx context.Context, q string) (_ driver.Stmt, err error) {
 	cn.LockReaderMutex()
 	defer cn.UnlockReaderMutex()
-	return cn.prepare(q, true)
+	return cn.prepare(ctx, q, true)
 }
 
-func (cn *conn) prepare(q string, check_resend bool) (stmt driver.Stmt, err error) {
+func (cn *conn) prepare(ctx context.Context, q string, check_resend bool) (stmt driver.Stmt, err error) {
 	if cn.getBad() {
 		return nil, driver.ErrBadConn
 	}
 	if check_resend {
-		defer cn.prepareResend(q, &stmt, &err)
+		defer cn.prepareResend(ctx, q, &stmt, &err)
 	}
 	//defer cn.errRecover(&err)
 
 	if len(q) >= 4 && strings.EqualFold(q[:4], "COPY") {
-		s, err := cn.prepareCopyIn(q) // TODO: refactor error handle
+		s, err := cn.prepareCopyIn(ctx, q) // TODO: refactor error handle
 		if err == nil {
 			cn.inCopy = true
 		}
@@ -787,7 +834,7 @@ Resend function for conn.prepare.
 
 	Check error if we encountered a cache-out-of-date error, and resend the query if needed
 */
-func (cn *conn) prepareResend(q string, r_stmt *driver.Stmt, r_err *error) {
+func (cn *conn) prepareResend(ctx context.Context, q string, r_stmt *driver.Stmt, r_err *error) {
 	if r_err == nil || *r_err == nil || r_stmt == nil || cn.pgconn == nil || is_any_refresh_cache_on_error(cn.pgconn) == false {
 		return
 	}
@@ -798,7 +845,7 @@ func (cn *conn) prepareResend(q string, r_stmt *driver.Stmt, r_err *error) {
 		return
 	}
 
-	stmt, err := cn.prepare(q, false)
+	stmt, err := cn.prepare(ctx, q, false)
 	if stmt != nil {
 		if *r_stmt != nil {
 			(*r_stmt).Close()
@@ -822,6 +869,9 @@ func (cn *conn) Close() (err error) {
 		deletePointer(cn.cn_ptr)
 		cn.cn_ptr = nil
 	}()
+	if cn.onClose != nil {
+		cn.onCloseOnce.Do(cn.onClose)
+	}
 	if cn.pgconn != nil {
 		if cn.config.EnableAutoSendToken {
 			err := cn.clearEnclave()
@@ -883,12 +933,20 @@ func (cn *conn) query(query string, args []driver.Value, check_resend bool) (res
 		}
 		return res, nil
 	}
-	st, err := cn.prepareTo(query, "")
+	st, cached, err := cn.prepareCached(query)
 	if err != nil {
 		return nil, fmt.Errorf("cannot prepare with query %s: %w", query, err)
 	}
 
 	if err = st.exec(args, true); err != nil {
+		if stale, gone := isStaleStatementError(err); stale && cached {
+			// the schema changed under the cached statement; outside of a
+			// transaction nothing ran yet, so prepare it again
+			cn.invalidateCached(query, !gone)
+			if !cn.isInTransaction() {
+				return cn.query(query, args, false)
+			}
+		}
 		return nil, fmt.Errorf("cannot exec with value %v: %w", args, err)
 	}
 
@@ -913,6 +971,8 @@ func (cn *conn) queryResend(query string, args []driver.Value, r_rows **rows, r_
 		return
 	}
 
+	// the client logic cache was refreshed, so is the cached statement
+	cn.invalidateCached(query, true)
 	rows, err := cn.query(query, args, false)
 	if rows != nil {
 		if *r_rows != nil {
@@ -975,13 +1035,19 @@ func (cn *conn) exec(query string, args []driver.Value, check_resend bool) (res
 	}
 	// Use the unnamed statement to defer planning until bind
 	// time, or else value-based selectivity estimates cannot be
-	// used.
-	st, err := cn.prepareTo(query, "")
+	// used, unless the statement cache is enabled.
+	st, cached, err := cn.prepareCached(query)
 	if err != nil {
 		return nil, fmt.Errorf("cannot prepare query %s: %w", query, err)
 	}
 	r, err := st.Exec(args)
 	if err != nil {
+		if stale, gone := isStaleStatementError(err); stale && cached {
+			cn.invalidateCached(query, !gone)
+			if !cn.isInTransaction() {
+				return cn.exec(query, args, false)
+			}
+		}
 		return nil, fmt.Errorf("fail to exec: %w", err)
 	}
 	return r, err
@@ -1003,6 +1069,7 @@ func (cn *conn) execResend(query string, args []driver.Value, r_res *driver.Resu
 		return
 	}
 
+	cn.invalidateCached(query, true)
 	res, err := cn.exec(query, args, false)
 	if res != nil {
 		*r_res = res
@@ -1093,10 +1160,7 @@ func (cn *conn) recvMessage(r *readBuf) (byte, error) {
 
 	x := cn.scratch[:5]
 	if _, err := io.ReadFull(cn.buf, x); err != nil {
-		return 0, connErr{
-			msg: fmt.Sprintf("fail to read: %v", err),
-			err: driver.ErrBadConn, // for database/sql errors.Is and retry
-		}
+		return 0, cn.readError(err)
 	}
 
 	// read the type and length of the message that follows
@@ -1109,10 +1173,7 @@ func (cn *conn) recvMessage(r *readBuf) (byte, error) {
 		y = make([]byte, n)
 	}
 	if _, err := io.ReadFull(cn.buf, y); err != nil {
-		return 0, connErr{
-			msg: fmt.Sprintf("fail to read: %v", err),
-			err: driver.ErrBadConn, // for database/sql errors.Is and retry
-		}
+		return 0, cn.readError(err)
 	}
 	*r = y
 	return t, nil
@@ -1134,7 +1195,7 @@ func (cn *conn) recv() (t byte, r *readBuf, err error) {
 			return 0, nil, parseError(r, cn)
 		case 'N':
 			if n := cn.noticeHandler; n != nil {
-				n(parseError(r, cn))
+				n(parseNotice(r, cn))
 			}
 		case 'A':
 			if n := cn.notificationHandler; n != nil {
@@ -1170,12 +1231,13 @@ func (cn *conn) recv1Buf(r *readBuf) (byte, error) {
 			}
 		case 'N':
 			if n := cn.noticeHandler; n != nil {
-				n(parseError(r, cn))
+				n(parseNotice(r, cn))
 			}
 		case 'S': // ParameterStatus
 			if err := cn.processParameterStatus(r); err != nil {
 				return 0, fmt.Errorf("cannot process parameter status: %w", err)
 			}
+			cn.sessionChanged = true
 		default:
 			return t, nil
 		}
@@ -1359,11 +1421,15 @@ func (cn *conn) startup() error {
 func (cn *conn) auth(r *readBuf) error {
 	var decodePwdByte []byte
 	getPwdPlain := func() (string, error) { // TODO: refactor
-		if len(cn.config.Password) == 0 {
+		password := cn.config.Password
+		if cn.fallbackConfig != nil && len(cn.fallbackConfig.Password) != 0 {
+			password = cn.fallbackConfig.Password
+		}
+		if len(password) == 0 {
 			return "", errors.New("the server requested password-based authentication, but no password was provided")
 		}
 		var err error
-		decodePwdByte, err = base64.StdEncoding.DecodeString(cn.config.Password)
+		decodePwdByte, err = base64.StdEncoding.DecodeString(password)
 		if err != nil {
 			return "", fmt.Errorf("cannot decode string: %w", err)
 		}
@@ -1600,6 +1666,7 @@ func (cn *conn) CheckConnectServerMasterSlave() (bool, error) {
 			return true, nil
 		} else if cn.config.targetSessionAttrs == targetSessionAttrsPreferSlave {
 			cn.isMasterForPreferSlave = true
+			cn.masterSince = time.Now()
 			return true, nil
 		}
 	} else if !isMaster && (cn.config.targetSessionAttrs == targetSessionAttrsSlave ||
@@ -1826,6 +1893,9 @@ func (st *stmt) send_clientlogic_parameters(pgconn *PGconn, writer *writeBuf,
 }
 
 func (st *stmt) exec(v []driver.Value, check_retry bool) error {
+	if err := st.reprepare(); err != nil {
+		return err
+	}
 	if st.cn.pgconn != nil && check_retry {
 		defer st.exec_retry(v) //check & retry if we have client cache error
 	}
@@ -1902,12 +1972,46 @@ func (st *stmt) execSingle(v []driver.Value, check_retry bool) error {
 	w.byte(0)         // create a new unnamed portal
 	w.string(st.name) // use the existing prepared statement
 
+	if err := st.writeBindParams(w, v); err != nil {
+		return err
+	}
+
+	w.next('E') // EXECUTE
+	w.byte(0)   // unnamed portal
+	w.int32(0)  // unlimited number of rows
+
+	w.next('S') // SYNC
+	if err := cn.send(w); err != nil {
+		return fmt.Errorf("fail to send: %w", err)
+	}
+
+	if err := cn.readBindResponse(); err != nil {
+		return fmt.Errorf("cannot read bind response: %w", err)
+	}
+	return cn.postExecuteWorkaround()
+}
+
+// writeBindParams writes the parameter formats and values and the result
+// formats of a Bind message.
+func (st *stmt) writeBindParams(w *writeBuf, v []driver.Value) error {
+	cn := st.cn
 	if cn.binaryParameters {
-		if err := cn.sendBinaryParameters(st.name, w, v); err != nil {
+		if err := cn.sendBinaryParameters(st.name, w, v, st.paramTypes); err != nil {
 			return fmt.Errorf("cannot send binary parameters: %w", err)
 		}
 	} else {
-		w.int16(0)      // magic number for "all text parameters" otherwise it should be the same as the number of total parameters
+		var paramFormats []int
+		if cn.pgconn == nil {
+			paramFormats = numericParamFormats(v, st.paramTypes)
+		}
+		if len(paramFormats) == 0 {
+			w.int16(0) // magic number for "all text parameters" otherwise it should be the same as the number of total parameters
+		} else {
+			w.int16(len(paramFormats))
+			for _, f := range paramFormats {
+				w.int16(f)
+			}
+		}
 		w.int16(len(v)) // number of total parameters
 
 		if cn.pgconn == nil {
@@ -1915,7 +2019,13 @@ func (st *stmt) execSingle(v []driver.Value, check_retry bool) error {
 				if x == nil {
 					w.int32(-1)
 				} else {
-					b, err := encode(&cn.parameterStatus, x, st.paramTypes[i])
+					var b []byte
+					var err error
+					if len(paramFormats) > 0 && paramFormats[i] == 1 {
+						b, err = binaryEncodeParam(&cn.parameterStatus, x, paramFormats, i)
+					} else {
+						b, err = encode(&cn.parameterStatus, x, st.paramTypes[i])
+					}
 					if err != nil {
 						return fmt.Errorf("cannot encode: %w", err)
 					}
@@ -1944,20 +2054,7 @@ func (st *stmt) execSingle(v []driver.Value, check_retry bool) error {
 		}
 	}
 	w.bytes(st.colFmtData)
-
-	w.next('E') // EXECUTE
-	w.byte(0)   // unnamed portal
-	w.int32(0)  // unlimited number of rows
-
-	w.next('S') // SYNC
-	if err := cn.send(w); err != nil {
-		return fmt.Errorf("fail to send: %w", err)
-	}
-
-	if err := cn.readBindResponse(); err != nil {
-		return fmt.Errorf("cannot read bind response: %w", err)
-	}
-	return cn.postExecuteWorkaround()
+	return nil
 }
 
 func (st *stmt) exec_retry(v []driver.Value) error {
@@ -2104,6 +2201,7 @@ func (st *stmt) NumInput() int {
 // identifying only the command that was executed, e.g. "ALTER TABLE".  If the
 // command tag could not be parsed, parseComplete returns error.
 func (cn *conn) parseComplete(cmdTag string) (driver.Result, string, error) {
+	cn.noteCommandTag(cmdTag)
 	commandsWithAffectedRows := []string{
 		"SELECT ",
 		// INSERT is handled below
@@ -2167,14 +2265,16 @@ func md5s(s string) string {
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
-func (cn *conn) sendBinaryParameters(stmt_name string, b *writeBuf, args []driver.Value) error {
+// sendBinaryParameters writes args, sending []byte values in binary format.
+// Decimal values are sent in binary only to the parameters paramTyps reports
+// as numeric, paramTyps is nil if the statement was not described.
+func (cn *conn) sendBinaryParameters(stmt_name string, b *writeBuf, args []driver.Value, paramTyps []oid.Oid) error {
 	// Do one pass over the parameters to see if we're going to send any of
 	// them over in binary.  If we are, create a paramFormats array at the
 	// same time.
-	var paramFormats []int
+	paramFormats := numericParamFormats(args, paramTyps)
 	for i, x := range args {
-		_, ok := x.([]byte)
-		if ok {
+		if _, ok := x.([]byte); ok {
 			if len(paramFormats) == 0 {
 				paramFormats = make([]int, len(args))
 			}
@@ -2193,11 +2293,11 @@ func (cn *conn) sendBinaryParameters(stmt_name string, b *writeBuf, args []drive
 	b.int16(len(args))
 
 	if cn.pgconn == nil {
-		for _, x := range args {
+		for i, x := range args {
 			if x == nil {
 				b.int32(-1)
 			} else {
-				datum, err := binaryEncode(&cn.parameterStatus, x)
+				datum, err := binaryEncodeParam(&cn.parameterStatus, x, paramFormats, i)
 				if err != nil {
 					return fmt.Errorf("fail to binary encode: %w", err)
 				}
@@ -2207,11 +2307,11 @@ func (cn *conn) sendBinaryParameters(stmt_name string, b *writeBuf, args []drive
 		}
 	} else {
 		var values_clientlogic [][]byte
-		for _, x := range args {
+		for i, x := range args {
 			if x == nil {
 				values_clientlogic = append(values_clientlogic, nil)
 			} else {
-				datum, err := binaryEncode(&cn.parameterStatus, x)
+				datum, err := binaryEncodeParam(&cn.parameterStatus, x, paramFormats, i)
 				if err != nil {
 					return fmt.Errorf("fail to binary encode: %w", err)
 				}
@@ -2257,7 +2357,7 @@ func (cn *conn) sendBinaryModeQuery(q string, args []driver.Value) error {
 
 	b.next('B')
 	b.int16(0) // unnamed portal and statement
-	if err := cn.sendBinaryParameters("", b, args); err != nil {
+	if err := cn.sendBinaryParameters("", b, args, nil); err != nil {
 		return fmt.Errorf("cannot send binary parameter: %w", err)
 	}
 	b.bytes(colFmtDataAllText)
@@ -2300,6 +2400,12 @@ func (cn *conn) processParameterStatus(r *readBuf) error {
 			pgconn_setserverversion(cn.pgconn, (Cint)(server_version))
 		}
 
+	case "in_hot_standby":
+		cn.processHotStandby(val)
+
+	case "IntervalStyle":
+		cn.parameterStatus.intervalStyle = val
+
 	case "TimeZone":
 		cn.parameterStatus.currentLocation, err = time.LoadLocation(val)
 		if err != nil {
@@ -2323,6 +2429,9 @@ func (cn *conn) processParameterStatus(r *readBuf) error {
 
 func (cn *conn) processReadyForQuery(r *readBuf) {
 	cn.txnStatus = transactionStatus(r.byte())
+	if cn.txnStatus == txnStatusIdle {
+		cn.endStatementTimeoutTxn()
+	}
 	/* if the pgconn is initialized, we can assume the client logic was turned on */
 	if cn.pgconn != nil {
 		/**
@@ -19,15 +19,26 @@ func (cn *conn) QueryContext(ctx context.Context, query string, args []driver.Na
 	for i, nv := range args {
 		list[i] = nv.Value
 	}
+	span := cn.startTrace(ctx, TraceQuery, query, len(args))
 	finish := cn.watchCancel(ctx)
-	r, err := cn.query(query, list, true)
+	var r *rows
+	err := cn.applyStatementTimeout(ctx)
+	if err == nil {
+		if n := contextFetchSize(ctx); n > 0 {
+			r, err = cn.queryCursor(ctx, query, list, n)
+		} else {
+			r, err = cn.query(query, list, true)
+		}
+	}
 	if err != nil {
+		span.end(nil, err)
 		if finish != nil {
 			finish()
 		}
 		return nil, err
 	}
 	r.finish = finish
+	r.span = span
 	return r, nil
 }
 
@@ -42,7 +53,14 @@ func (cn *conn) ExecContext(ctx context.Context, query string, args []driver.Nam
 		defer finish()
 	}
 
-	return cn.Exec(query, list)
+	span := cn.startTrace(ctx, TraceExec, query, len(args))
+	if err := cn.applyStatementTimeout(ctx); err != nil {
+		span.end(nil, err)
+		return nil, err
+	}
+	res, err := cn.Exec(query, list)
+	span.end(res, err)
+	return res, err
 }
 
 // Implement the "ConnPrepareContext" interface
@@ -50,11 +68,22 @@ func (cn *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt,
 	if finish := cn.watchCancel(ctx); finish != nil {
 		defer finish()
 	}
-	return cn.Prepare(query)
+	span := cn.startTrace(ctx, TracePrepare, query, 0)
+	st, err := cn.prepareContext(ctx, query)
+	span.end(nil, err)
+	return st, err
 }
 
-// Implement the "ConnBeginTx" interface
+// Implement the "ConnBeginTx" interface.  Calling BeginTx while a
+// transaction is open starts a nested transaction in a savepoint.
 func (cn *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if cn.isInTransaction() {
+		span := cn.startTrace(ctx, TraceBegin, "", 0)
+		tx, err := cn.beginNestedTx(opts)
+		span.end(nil, err)
+		return tx, err
+	}
+
 	var mode string
 
 	switch sql.IsolationLevel(opts.Isolation) {
@@ -78,11 +107,14 @@ func (cn *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx,
 		mode += " READ WRITE"
 	}
 
+	span := cn.startTrace(ctx, TraceBegin, "", 0)
 	tx, err := cn.begin(mode)
+	span.end(nil, err)
 	if err != nil {
 		return nil, err
 	}
 	cn.txnFinish = cn.watchCancel(ctx)
+	cn.txnCtx = ctx
 	return tx, nil
 }
 
@@ -100,6 +132,7 @@ func (cn *conn) Ping(ctx context.Context) error {
 
 func (cn *conn) watchCancel(ctx context.Context) func() {
 	if done := ctx.Done(); done != nil {
+		clearDeadline := cn.watchDeadline(ctx)
 		finished := make(chan struct{}, 1)
 		go func() {
 			select {
@@ -129,6 +162,7 @@ func (cn *conn) watchCancel(ctx context.Context) func() {
 			}
 		}()
 		return func() {
+			clearDeadline()
 			select {
 			case <-finished:
 				cn.setBad()
@@ -160,9 +194,11 @@ func (cn *conn) cancel(ctx context.Context) error {
 			c:   c,
 			bad: bad,
 		}
-		err = can.startTLS(cn.fallbackConfig.TLSConfig)
-		if err != nil {
-			return fmt.Errorf("cannot start TLS: %w", err)
+		if cn.fallbackConfig.TLSConfig != nil {
+			err = can.startTLS(cn.fallbackConfig.TLSConfig)
+			if err != nil {
+				return fmt.Errorf("cannot start TLS: %w", err)
+			}
 		}
 
 		w := can.writeBuf(0)
@@ -190,15 +226,26 @@ func (st *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (dri
 	for i, nv := range args {
 		list[i] = nv.Value
 	}
+	span := st.cn.startTrace(ctx, TraceQuery, st.sql, len(args))
 	finish := st.watchCancel(ctx)
-	r, err := st.query(list)
+	var r *rows
+	err := st.cn.applyStatementTimeout(ctx)
+	if err == nil {
+		if n := contextFetchSize(ctx); n > 0 {
+			r, err = st.queryCursor(ctx, list, n)
+		} else {
+			r, err = st.query(list)
+		}
+	}
 	if err != nil {
+		span.end(nil, err)
 		if finish != nil {
 			finish()
 		}
 		return nil, err
 	}
 	r.finish = finish
+	r.span = span
 	return r, nil
 }
 
@@ -213,12 +260,20 @@ func (st *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driv
 		defer finish()
 	}
 
-	return st.Exec(list)
+	span := st.cn.startTrace(ctx, TraceExec, st.sql, len(args))
+	if err := st.cn.applyStatementTimeout(ctx); err != nil {
+		span.end(nil, err)
+		return nil, err
+	}
+	res, err := st.Exec(list)
+	span.end(res, err)
+	return res, err
 }
 
 // watchCancel is implemented on stmt in order to not mark the parent conn as bad
 func (st *stmt) watchCancel(ctx context.Context) func() {
 	if done := ctx.Done(); done != nil {
+		clearDeadline := st.cn.watchDeadline(ctx)
 		finished := make(chan struct{})
 		go func() {
 			select {
@@ -238,6 +293,7 @@ func (st *stmt) watchCancel(ctx context.Context) func() {
 			}
 		}()
 		return func() {
+			clearDeadline()
 			select {
 			case <-finished:
 			case finished <- struct{}{}:
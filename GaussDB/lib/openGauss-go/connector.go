@@ -14,8 +14,10 @@ import (
 	"os"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -158,7 +160,7 @@ func NewConnector(dsn string) (*Connector, error) {
 
 	// load balancer from balance policy
 	switch balPol {
-	case balanceRoundRobin, balanceLeastConn:
+	case balanceRoundRobin:
 		balancer = &roundRobbinBalancer{
 			startIdx:        1,
 			idxLock:         &sync.Mutex{},
@@ -176,6 +178,12 @@ func NewConnector(dsn string) (*Connector, error) {
 		}
 	case balanceShuffle:
 		balancer = &shuffleBalancer{}
+	case balanceLeastConn:
+		balancer = &leastConnBalancer{
+			connsLock:       &sync.Mutex{},
+			conns:           make(map[string]int),
+			shuffleBalancer: &shuffleBalancer{},
+		}
 	default:
 	}
 
@@ -233,7 +241,15 @@ func (c *Connector) open(ctx context.Context) (cn *conn, err error) {
 	if !c.config.createdByParseConfig {
 		return nil, errors.New("config must be created by ParseConfig")
 	}
-	return c.dialer.dial(ctx, c.config)
+	span := startTrace(ctx, c.config, TraceStartData{Type: TraceConnect})
+	cn, err = c.dialer.dial(ctx, c.config)
+	if span != nil {
+		if cn != nil {
+			span.data.Node = cn.node()
+		}
+		span.end(nil, err)
+	}
+	return cn, err
 }
 
 type connectorDialer interface {
@@ -258,6 +274,7 @@ func (s *singleDialer) dial(ctx context.Context, config *Config) (cn *conn, err
 			Host:      config.Host,
 			Port:      config.Port,
 			TLSConfig: config.TLSConfig,
+			Password:  config.hostPassword,
 		},
 	}
 	fallbackConfigs = append(fallbackConfigs, config.Fallbacks...)
@@ -336,11 +353,14 @@ func (s *singleDialer) dial(ctx context.Context, config *Config) (cn *conn, err
 }
 
 func connectFallbackConfig(ctx context.Context, config *Config, fallbackConfig *FallbackConfig) (cn *conn, err error) {
+	bad := &atomic.Value{}
+	bad.Store(false)
 	cn = &conn{
 		config:         config,
 		logLevel:       config.LogLevel,
 		logger:         config.Logger,
 		fallbackConfig: fallbackConfig,
+		bad:            bad,
 	}
 	cn.log(ctx, LogLevelInfo, fmt.Sprintf(
 		"Dialing server: (%v:%v)",
@@ -461,6 +481,7 @@ func expandWithIPs(ctx context.Context, lookupFn LookupFunc, fallbacks []*Fallba
 				Host:      fb.Host,
 				Port:      fb.Port,
 				TLSConfig: fb.TLSConfig,
+				Password:  fb.Password,
 			})
 
 			continue
@@ -476,6 +497,7 @@ func expandWithIPs(ctx context.Context, lookupFn LookupFunc, fallbacks []*Fallba
 				Host:      ip,
 				Port:      fb.Port,
 				TLSConfig: fb.TLSConfig,
+				Password:  fb.Password,
 			})
 		}
 	}
@@ -489,6 +511,9 @@ type distributeDialer struct {
 	cnsLock               *sync.RWMutex
 	coordinateNodes       []coordinateNode
 	cnsBalancer           cnsBalancer
+	// nodes which stopped responding, with the time until which they are
+	// not dialed, see evict
+	evicted map[string]time.Time
 
 	tlsCfgs []*tls.Config
 	dialer  Dialer
@@ -530,6 +555,7 @@ func (d *distributeDialer) dial(ctx context.Context, cfg *Config) (*conn, error)
 			bal.urlCNs = cns
 		}
 	}
+	cns = d.withoutEvicted(cns)
 	if balancer := d.cnsBalancer.balance; balancer != nil {
 		roundIdx := d.cnsBalancer.balance(cns)
 		if len(cns) > 0 && d.logLevel >= LogLevelDebug {
@@ -597,6 +623,11 @@ func (d *distributeDialer) dial(ctx context.Context, cfg *Config) (*conn, error)
 		cfg.Log(context.Background(), LogLevelDebug,
 			fmt.Sprintf("find instance: (%v:%v)", cNode.ip, cNode.port),
 			map[string]interface{}{})
+		if tracker, ok := d.cnsBalancer.(connTracker); ok {
+			cn.onClose = tracker.track(cNode)
+		}
+		node := cNode
+		cn.evictNode = func() { d.evict(node) }
 		break
 	}
 	if err != nil {
@@ -707,11 +738,17 @@ func connectCNodeConfig(ctx context.Context, cfg *Config, cNode coordinateNode)
 		Port:      cNode.port,
 		TLSConfig: cNode.TLSConfig,
 	}
+	if cfg.passfile != nil {
+		bckCfg.Password = findPassfilePassword(cfg.passfile, cNode.ip, cNode.port, cfg.Database, cfg.User)
+	}
+	bad := &atomic.Value{}
+	bad.Store(false)
 	cn := &conn{
 		config:         cfg,
 		logLevel:       cfg.LogLevel,
 		logger:         cfg.Logger,
 		fallbackConfig: bckCfg,
+		bad:            bad,
 	}
 	cn.log(ctx, LogLevelInfo,
 		fmt.Sprintf("Dialing server: (%v:%v)", bckCfg.Host, bckCfg.Port),
@@ -843,6 +880,63 @@ func (r *roundRobbinBalancer) balance(cns []coordinateNode) int {
 	return roundIdx
 }
 
+// connTracker is implemented by balancers which need to know the live
+// connections of a Connector.  track is called for every new connection and
+// returns the function called when the connection is closed.
+type connTracker interface {
+	track(cNode coordinateNode) (release func())
+}
+
+// leastConnBalancer orders the coordinate nodes by the number of live
+// connections the Connector has to them, fewest first.  Nodes with the same
+// number of connections are shuffled.
+type leastConnBalancer struct {
+	connsLock *sync.Mutex
+	conns     map[string]int
+	*shuffleBalancer
+}
+
+func (l *leastConnBalancer) balance(cns []coordinateNode) int {
+	if len(cns) < 2 {
+		return 0
+	}
+	l.shuffleBalancer.balance(cns)
+	counts := make([]int, len(cns))
+	l.connsLock.Lock()
+	for i := range cns {
+		counts[i] = l.conns[fmt.Sprintf("%s:%d", cns[i].ip, cns[i].port)]
+	}
+	l.connsLock.Unlock()
+	sort.Stable(nodesByConns{cns: cns, counts: counts})
+	return 0
+}
+
+func (l *leastConnBalancer) track(cNode coordinateNode) func() {
+	key := fmt.Sprintf("%s:%d", cNode.ip, cNode.port)
+	l.connsLock.Lock()
+	l.conns[key]++
+	l.connsLock.Unlock()
+	return func() {
+		l.connsLock.Lock()
+		if l.conns[key]--; l.conns[key] <= 0 {
+			delete(l.conns, key)
+		}
+		l.connsLock.Unlock()
+	}
+}
+
+type nodesByConns struct {
+	cns    []coordinateNode
+	counts []int
+}
+
+func (n nodesByConns) Len() int           { return len(n.cns) }
+func (n nodesByConns) Less(i, j int) bool { return n.counts[i] < n.counts[j] }
+func (n nodesByConns) Swap(i, j int) {
+	n.cns[i], n.cns[j] = n.cns[j], n.cns[i]
+	n.counts[i], n.counts[j] = n.counts[j], n.counts[i]
+}
+
 type shuffleBalancer struct{}
 
 func (s *shuffleBalancer) balance(cns []coordinateNode) int {
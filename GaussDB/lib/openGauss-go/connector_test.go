@@ -0,0 +1,89 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+func TestLeastConnBalancer(t *testing.T) {
+	l := &leastConnBalancer{connsLock: &sync.Mutex{}, conns: map[string]int{}, shuffleBalancer: &shuffleBalancer{}}
+	a := coordinateNode{ip: "10.0.0.1", port: 8000}
+	b := coordinateNode{ip: "10.0.0.2", port: 8000}
+	c := coordinateNode{ip: "10.0.0.3", port: 8000}
+
+	releaseA1 := l.track(a)
+	releaseA2 := l.track(a)
+	l.track(b)
+	for i := 0; i < 10; i++ {
+		cns := []coordinateNode{a, b, c}
+		l.balance(cns)
+		if cns[0] != c || cns[1] != b || cns[2] != a {
+			t.Fatalf("got order %v, want fewest connections first", cns)
+		}
+	}
+	releaseA1()
+	releaseA2()
+	if l.conns["10.0.0.1:8000"] != 0 {
+		t.Fatalf("got %d connections to a after releasing both", l.conns["10.0.0.1:8000"])
+	}
+}
+
+func TestConnCloseReleasesOnce(t *testing.T) {
+	_, db, done := openTestDB(t, pqtest.NewScript())
+	defer done()
+
+	var released int32
+	err := withDriverConn(t, db, func(c driver.Conn) error {
+		cn := c.(*conn)
+		cn.onClose = func() { atomic.AddInt32(&released, 1) }
+		// as the finish func of watchCancel does while database/sql closes
+		// the connection
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = cn.Close()
+			}()
+		}
+		wg.Wait()
+		return driver.ErrBadConn
+	})
+	if err != driver.ErrBadConn {
+		t.Fatal(err)
+	}
+	db.Close()
+	if n := atomic.LoadInt32(&released); n != 1 {
+		t.Fatalf("onClose called %d times, want 1", n)
+	}
+}
+
+func TestConnectCNodePassfile(t *testing.T) {
+	srv := pqtest.NewUnstartedServer(pqtest.NewScript())
+	srv.Auth = pqtest.AuthMD5
+	srv.User = "gauss"
+	srv.Password = "Test@123"
+	srv.Start()
+	defer srv.Close()
+
+	// the coordinator node is only known from the CN list, not from the
+	// connection string
+	passfile, remove := writePassfile(t, fmt.Sprintf("db1.example.com:5432:postgres:gauss:other\n"+
+		"%s:%d:postgres:gauss:%s\n", srv.Host(), srv.Port(), srv.Password))
+	defer remove()
+	config, _, err := ParseConfig("host=db1.example.com user=gauss dbname=postgres sslmode=disable passfile=" + passfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn, err := connectCNodeConfig(context.Background(), config, coordinateNode{ip: srv.Host(), port: srv.Port()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn.Close()
+}
@@ -1,19 +1,25 @@
 package pq
 
 import (
+	"context"
 	"database/sql/driver"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"runtime"
 	"sync"
+	"time"
 	"unsafe"
 )
 
 var (
 	errCopyInClosed               = errors.New("pq: copyin statement has already been closed")
-	errBinaryCopyNotSupported     = errors.New("pq: only text format supported for COPY")
-	errCopyToNotSupported         = errors.New("pq: COPY TO is not supported")
+	errBinaryCopyNotSupported     = errors.New("pq: binary COPY is not supported with client encryption")
+	errCopyFormatMismatch         = errors.New("pq: server COPY format does not match the statement")
+	errCopyToNotSupported         = errors.New("pq: COPY TO is not supported by Prepare, use CopyTo")
+	errCopyFromNotSupported       = errors.New("pq: COPY FROM is not supported by CopyTo, use CopyIn")
+	errNotCopyTo                  = errors.New("pq: CopyTo requires a COPY ... TO STDOUT statement")
 	errCopyNotSupportedOutsideTxn = errors.New("pq: COPY is only allowed inside a transaction")
 	errCopyInProgress             = errors.New("pq: COPY in progress")
 )
@@ -46,6 +52,214 @@ func CopyInSchema(schema, table string, columns ...string) string {
 	return stmt
 }
 
+// CopyInBinary creates a COPY FROM statement which can be prepared with
+// Tx.Prepare().  The rows are sent in the binary COPY format, with each value
+// encoded for the type of its target column instead of being escaped as text.
+// The target table should be visible in search_path.
+func CopyInBinary(table string, columns ...string) string {
+	return CopyIn(table, columns...) + copyBinaryOption
+}
+
+// CopyInSchemaBinary creates a binary COPY FROM statement which can be
+// prepared with Tx.Prepare().
+func CopyInSchemaBinary(schema, table string, columns ...string) string {
+	return CopyInSchema(schema, table, columns...) + copyBinaryOption
+}
+
+// CopyOut creates a COPY TO statement which can be run with CopyTo.  The
+// source table should be visible in search_path.  If no columns are given,
+// all columns of the table are copied.
+func CopyOut(table string, columns ...string) string {
+	return "COPY " + QuoteIdentifier(table) + copyColumnList(columns) + " TO STDOUT"
+}
+
+// CopyOutSchema creates a COPY TO statement which can be run with CopyTo.
+func CopyOutSchema(schema, table string, columns ...string) string {
+	return "COPY " + QuoteIdentifier(schema) + "." + QuoteIdentifier(table) + copyColumnList(columns) + " TO STDOUT"
+}
+
+// CopyOutCSV is like CopyOut, but the server sends the rows in CSV format
+// with a header line.  Append " WITH CSV HEADER" to the result of
+// CopyOutSchema to get the same for a schema-qualified table.
+func CopyOutCSV(table string, columns ...string) string {
+	return CopyOut(table, columns...) + " WITH CSV HEADER"
+}
+
+func copyColumnList(columns []string) string {
+	if len(columns) == 0 {
+		return ""
+	}
+	list := " ("
+	for i, col := range columns {
+		if i != 0 {
+			list += ", "
+		}
+		list += QuoteIdentifier(col)
+	}
+	return list + ")"
+}
+
+// CopyTo runs query, which must be a COPY ... TO STDOUT statement, on the
+// connection c and streams the data sent by the server into w as it arrives.
+// The data is written exactly as the server formats it, so the format (text
+// or CSV) is chosen by the statement.  CopyTo returns the number of rows
+// copied.
+//
+// c must be a connection of this driver, e.g. the one passed to the function
+// given to sql.Conn.Raw.  Unlike CopyIn, COPY TO does not need an explicit
+// transaction.  If ctx is done before the COPY completes, a CancelRequest is
+// sent to the server and the connection is discarded, as with QueryContext.
+// If w returns an error the COPY is cancelled as well and that error is
+// returned once the server has acknowledged the cancellation; if the COPY
+// completes before the cancellation reaches the server, the connection is
+// discarded, so that the cancellation cannot hit the next statement.
+func CopyTo(ctx context.Context, c driver.Conn, w io.Writer, query string) (int64, error) {
+	cn, ok := c.(*conn)
+	if !ok {
+		return 0, fmt.Errorf("pq: CopyTo requires a pq connection, got %T", c)
+	}
+	cn.LockReaderMutex()
+	defer cn.UnlockReaderMutex()
+	span := cn.startTrace(ctx, TraceCopy, query, 0)
+	n, err := cn.copyOut(ctx, w, query)
+	span.endRows(n, err)
+	return n, err
+}
+
+func (cn *conn) copyOut(ctx context.Context, w io.Writer, q string) (int64, error) {
+	if cn.getBad() {
+		return 0, driver.ErrBadConn
+	}
+	if cn.inCopy {
+		return 0, errCopyInProgress
+	}
+	if finish := cn.watchCancel(ctx); finish != nil {
+		defer finish()
+	}
+
+	if cn.pgconn != nil {
+		var (
+			queryCstring *Cchar
+			err          error
+		)
+		runtime.LockOSThread()
+		q, queryCstring, err = cn.replaceQuery("", q)
+		defer Cfree(unsafe.Pointer(queryCstring))
+		if err != nil {
+			runtime.UnlockOSThread()
+			return 0, fmt.Errorf("cannot replace query: %w", err)
+		}
+	}
+
+	b := cn.writeBuf('Q')
+	b.string(q)
+	if err := cn.send(b); err != nil {
+		if cn.pgconn != nil {
+			runtime.UnlockOSThread()
+		}
+		return 0, fmt.Errorf("fail to send: %w", err)
+	}
+	if cn.pgconn != nil {
+		runtime.UnlockOSThread()
+	}
+
+	var (
+		res     driver.Result
+		copyErr error
+		// set once a CancelRequest was sent, until the server reports the
+		// cancellation
+		cancelPending bool
+	)
+	for {
+		t, r, err := cn.recv1()
+		if err != nil {
+			cn.setBad()
+			return 0, fmt.Errorf("cannot recv from conn: %w", err)
+		}
+		switch t {
+		case 'H': // CopyOutResponse
+			cn.inCopy = true
+		case 'd': // CopyData
+			if copyErr != nil {
+				// the COPY is being cancelled, drop the remaining data
+				continue
+			}
+			if _, copyErr = w.Write(*r); copyErr != nil {
+				copyErr = fmt.Errorf("cannot write copy data: %w", copyErr)
+				if err := cn.cancelCopyOut(); err != nil {
+					// we have no other way to stop the server; drop the connection
+					cn.setBad()
+					return 0, copyErr
+				}
+				cancelPending = true
+			}
+		case 'c': // CopyDone
+			cn.inCopy = false
+		case 'C': // CommandComplete
+			s, err := r.string()
+			if err != nil {
+				cn.setBad()
+				return 0, fmt.Errorf("cannot get string from read buf: %w", err)
+			}
+			res, _, err = cn.parseComplete(s)
+			if err != nil && copyErr == nil {
+				// keep reading up to ReadyForQuery, so that the connection
+				// can be used again
+				copyErr = fmt.Errorf("cannot parse complete: %w", err)
+			}
+		case 'G': // CopyInResponse
+			b := cn.writeBuf('f')
+			b.string(errCopyFromNotSupported.Error())
+			if err := cn.send(b); err != nil {
+				cn.setBad()
+				return 0, fmt.Errorf("fail to send: %w", err)
+			}
+			copyErr = errCopyFromNotSupported
+		case 'T', 'D', 'I':
+			if copyErr == nil {
+				copyErr = errNotCopyTo
+			}
+		case 'E': // ErrorResponse
+			cn.inCopy = false
+			pgErr := parseError(r, cn)
+			if pgErr.Code == CodeQueryCanceled {
+				cancelPending = false
+			}
+			if copyErr == nil {
+				copyErr = pgErr
+			}
+		case 'Z': // ReadyForQuery
+			cn.inCopy = false
+			cn.processReadyForQuery(r)
+			if cancelPending {
+				// The COPY completed before the CancelRequest reached the
+				// server, which may still cancel the next statement.
+				cn.setBad()
+			}
+			if copyErr != nil {
+				return 0, copyErr
+			}
+			if res == nil {
+				return 0, errUnexpectedReady
+			}
+			return res.RowsAffected()
+		default:
+			cn.setBad()
+			return 0, fmt.Errorf("unknown response for copy query: %q", t)
+		}
+	}
+}
+
+// cancelCopyOut asks the server to abort the running COPY TO.  The server
+// answers with an ErrorResponse which copyOut reads before returning.  If the
+// COPY completes first, the CancelRequest is still pending and copyOut
+// discards the connection.
+func (cn *conn) cancelCopyOut() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	return cn.cancel(ctx)
+}
+
 type copyin struct {
 	cn      *conn
 	buffer  []byte
@@ -53,6 +267,14 @@ type copyin struct {
 	done    chan bool
 	driver.Result
 
+	// binary is set for binary COPY, colTyps then holds the types of the
+	// target columns in COPY order
+	binary  bool
+	colTyps []fieldDesc
+
+	// trace event ended by Close
+	span *traceSpan
+
 	closed bool
 
 	sync.Mutex // guards err
@@ -61,10 +283,12 @@ type copyin struct {
 
 const ciBufferSize = 64 * 1024
 
+const copyBinaryOption = " WITH (FORMAT 'binary')"
+
 // flush buffer before the buffer is filled up and needs reallocation
 const ciBufferFlushSize = 63 * 1024
 
-func (cn *conn) prepareCopyIn(q string) (_ driver.Stmt, err error) { // TODO: named return value
+func (cn *conn) prepareCopyIn(ctx context.Context, q string) (_ driver.Stmt, err error) { // TODO: named return value
 	if !cn.isInTransaction() {
 		return nil, errCopyNotSupportedOutsideTxn
 	}
@@ -78,6 +302,26 @@ func (cn *conn) prepareCopyIn(q string) (_ driver.Stmt, err error) { // TODO: na
 	// add CopyData identifier + 4 bytes for message length
 	ci.buffer = append(ci.buffer, 'd', 0, 0, 0, 0)
 
+	span := cn.startTrace(ctx, TraceCopy, q, 0)
+	defer func() {
+		if err != nil {
+			span.end(nil, err)
+		}
+	}()
+
+	if colsQuery, ok := binaryCopyColumnsQuery(q); ok {
+		if cn.pgconn != nil {
+			return nil, errBinaryCopyNotSupported
+		}
+		st, err := cn.prepareTo(colsQuery, "")
+		if err != nil {
+			return nil, fmt.Errorf("cannot describe binary copy columns: %w", err)
+		}
+		ci.binary = true
+		ci.colTyps = st.colTyps
+		ci.buffer = append(ci.buffer, copyBinaryHeader...)
+	}
+
 	if cn.pgconn != nil {
 		var queryCstring *Cchar
 		runtime.LockOSThread()
@@ -108,17 +352,18 @@ func (cn *conn) prepareCopyIn(q string) (_ driver.Stmt, err error) { // TODO: na
 
 awaitCopyInResponse:
 	for {
-		t, r, err := cn.recv1()
-		if err != nil {
+		t, r, recvErr := cn.recv1()
+		if recvErr != nil {
 			cn.setBad()
-			return nil, fmt.Errorf("cannot recv from conn: %w", err)
+			return nil, fmt.Errorf("cannot recv from conn: %w", recvErr)
 		}
 		switch t {
 		case 'G': // CopyInResponse
-			if r.byte() != 0 {
-				err = errBinaryCopyNotSupported
+			if (r.byte() != 0) != ci.binary {
+				err = errCopyFormatMismatch
 				break awaitCopyInResponse
 			}
+			ci.span = span
 			go ci.resploop()
 			return ci, nil
 		case 'H': // CopyOutResponse
@@ -142,18 +387,20 @@ awaitCopyInResponse:
 	// something went wrong, abort COPY before we return
 	b = cn.writeBuf('f')
 	b.string(err.Error())
-	if err = cn.send(b); err != nil {
-		return nil, fmt.Errorf("fail to send: %w", err)
+	if sendErr := cn.send(b); sendErr != nil {
+		return nil, fmt.Errorf("fail to send: %w", sendErr)
 	}
 
 	for {
-		t, r, err := cn.recv1()
-		if err != nil {
+		t, r, recvErr := cn.recv1()
+		if recvErr != nil {
 			cn.setBad()
-			return nil, fmt.Errorf("cannot recv from conn: %w", err)
+			return nil, fmt.Errorf("cannot recv from conn: %w", recvErr)
 		}
 		switch t {
-		case 'c', 'C', 'E':
+		case 'd', 'c', 'C', 'E':
+			// the data of a COPY TO, which the server sends in full as it
+			// ignores the CopyFail
 		case 'Z':
 			// correctly aborted, we're done
 			cn.processReadyForQuery(r)
@@ -221,7 +468,7 @@ func (ci *copyin) resploop() error {
 			ci.setResult(res)
 		case 'N':
 			if n := ci.cn.noticeHandler; n != nil {
-				n(parseError(&r, ci.cn))
+				n(parseNotice(&r, ci.cn))
 			}
 		case 'Z':
 			ci.cn.processReadyForQuery(&r)
@@ -321,19 +568,25 @@ func (ci *copyin) Exec(v []driver.Value) (r driver.Result, err error) {
 		return ci.getResult(), fmt.Errorf("\"COPY FROM STDIN\" requires the given parameters")
 	}
 
-	numValues := len(v)
-	for i, value := range v {
-		ci.buffer, err = appendEncodedText(&ci.cn.parameterStatus, ci.buffer, value)
+	if ci.binary {
+		ci.buffer, err = ci.appendBinaryRow(ci.buffer, v)
 		if err != nil {
-			return nil, fmt.Errorf("cannot append encoded test: %w", err)
+			return nil, err
 		}
-		if i < numValues-1 {
-			ci.buffer = append(ci.buffer, '\t')
+	} else {
+		numValues := len(v)
+		for i, value := range v {
+			ci.buffer, err = appendEncodedText(&ci.cn.parameterStatus, ci.buffer, value)
+			if err != nil {
+				return nil, fmt.Errorf("cannot append encoded test: %w", err)
+			}
+			if i < numValues-1 {
+				ci.buffer = append(ci.buffer, '\t')
+			}
 		}
+		ci.buffer = append(ci.buffer, '\n')
 	}
 
-	ci.buffer = append(ci.buffer, '\n')
-
 	if len(ci.buffer) > ciBufferFlushSize {
 		if err = ci.flush(ci.buffer); err != nil {
 			return nil, fmt.Errorf("fail to flash: %w", err)
@@ -350,11 +603,22 @@ func (ci *copyin) Close() (err error) {
 		return nil
 	}
 	ci.closed = true
+	defer func() {
+		if err != nil {
+			ci.span.end(nil, err)
+		} else {
+			ci.span.end(ci.getResult(), nil)
+		}
+	}()
 
 	if ci.isBad() {
 		return driver.ErrBadConn
 	}
 
+	if ci.binary {
+		// file trailer
+		ci.buffer = appendInt16(ci.buffer, -1)
+	}
 	if len(ci.buffer) > 0 {
 		if err = ci.flush(ci.buffer); err != nil {
 			return fmt.Errorf("fail to flash: %w", err)
@@ -0,0 +1,460 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/oid"
+)
+
+// copyBinaryHeader is the signature, flags field and header extension length
+// that start a binary COPY stream.
+var copyBinaryHeader = []byte("PGCOPY\n\377\r\n\000\000\000\000\000\000\000\000\000")
+
+// postgresEpoch is the origin of the binary date and timestamp formats,
+// 2000-01-01 00:00:00 UTC, in Unix seconds.
+const postgresEpoch = 946684800
+
+const (
+	numericPos = 0x0000
+	numericNeg = 0x4000
+	numericNaN = 0xC000
+)
+
+// binaryCopyColumnsQuery inspects a COPY FROM STDIN statement and, if it asks
+// for the binary format, returns a query selecting the target columns so that
+// their types can be described before the COPY starts.
+func binaryCopyColumnsQuery(q string) (string, bool) {
+	from, lparen, rparen := -1, -1, -1
+	depth := 0
+	quoted := false
+scan:
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			if depth == 0 && lparen < 0 {
+				lparen = i
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 && rparen < 0 {
+				rparen = i
+			}
+		case depth == 0 && i > 0 && i+5 <= len(q) && isCopySpace(q[i-1]) &&
+			strings.EqualFold(q[i:i+4], "from") && (i+4 == len(q) || isCopySpace(q[i+4])):
+			from = i
+			break scan
+		}
+	}
+	if from < 0 || !copyOptionsBinary(q[from+4:]) {
+		return "", false
+	}
+
+	head := strings.TrimSpace(q[:from])
+	if len(head) < 5 || !strings.EqualFold(head[:4], "copy") || !isCopySpace(head[4]) {
+		return "", false
+	}
+	if lparen < 0 {
+		return "SELECT * FROM " + strings.TrimSpace(head[5:]) + " LIMIT 0", true
+	}
+	if rparen < lparen {
+		return "", false
+	}
+	start := len(q) - len(strings.TrimLeft(q, " \t\r\n"))
+	table := strings.TrimSpace(q[start+5 : lparen])
+	return "SELECT " + q[lparen+1:rparen] + " FROM " + table + " LIMIT 0", true
+}
+
+// copyOptionsBinary reports whether the part of a COPY statement following
+// FROM asks for the binary format, with the FORMAT option or the BINARY
+// keyword of the old syntax.  Quoted strings, such as the file name or a NULL
+// string, and comments are skipped.
+func copyOptionsBinary(opts string) bool {
+	prev := "" // the word before the current token, to find FORMAT's value
+	for i := 0; i < len(opts); {
+		c := opts[i]
+		switch {
+		case isCopySpace(c):
+			i++
+		case strings.HasPrefix(opts[i:], "--"):
+			if end := strings.IndexByte(opts[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(opts)
+			}
+		case strings.HasPrefix(opts[i:], "/*"):
+			if end := strings.Index(opts[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(opts)
+			}
+		case c == '(' || c == ')' || c == ',':
+			prev = ""
+			i++
+		case c == '\'' || c == '"':
+			value, n := copyQuoted(opts[i:], c)
+			if prev == "FORMAT" && strings.EqualFold(value, "binary") {
+				return true
+			}
+			prev = ""
+			i += n
+		default:
+			j := i + 1
+			for j < len(opts) && !isCopyWordEnd(opts[j:]) {
+				j++
+			}
+			word := strings.ToUpper(opts[i:j])
+			if word == "BINARY" {
+				return true
+			}
+			prev = word
+			i = j
+		}
+	}
+	return false
+}
+
+// copyQuoted returns the content of the string or identifier starting with
+// the quote at s[0], and the number of bytes it takes in s.  A doubled quote
+// stands for the quote itself.
+func copyQuoted(s string, quote byte) (string, int) {
+	var value []byte
+	for i := 1; i < len(s); i++ {
+		if s[i] != quote {
+			value = append(value, s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			value = append(value, quote)
+			i++
+			continue
+		}
+		return string(value), i + 1
+	}
+	return string(value), len(s)
+}
+
+// isCopyWordEnd reports whether s starts with a character ending a word of a
+// COPY statement.
+func isCopyWordEnd(s string) bool {
+	return isCopySpace(s[0]) || strings.IndexByte("(),'\"", s[0]) >= 0 ||
+		strings.HasPrefix(s, "--") || strings.HasPrefix(s, "/*")
+}
+
+func isCopySpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// appendBinaryRow encodes one tuple of a binary COPY stream and appends it to
+// buf.  Every value is encoded in the binary format of the column it is
+// copied into.
+func (ci *copyin) appendBinaryRow(buf []byte, v []driver.Value) ([]byte, error) {
+	if len(v) != len(ci.colTyps) {
+		return nil, fmt.Errorf("pq: binary COPY expects %d values, got %d", len(ci.colTyps), len(v))
+	}
+
+	buf = appendInt16(buf, int16(len(v)))
+	for i, value := range v {
+		if value == nil {
+			buf = appendInt32(buf, -1)
+			continue
+		}
+		lenPos := len(buf)
+		buf = append(buf, 0, 0, 0, 0)
+		var err error
+		buf, err = appendEncodedBinary(&ci.cn.parameterStatus, buf, value, ci.colTyps[i].OID)
+		if err != nil {
+			return nil, fmt.Errorf("pq: cannot encode column %d: %w", i+1, err)
+		}
+		binary.BigEndian.PutUint32(buf[lenPos:], uint32(len(buf)-lenPos-4))
+	}
+	return buf, nil
+}
+
+// appendEncodedBinary encodes x in the binary format of the type typ as
+// required by binary COPY and appends it to buf.
+func appendEncodedBinary(parameterStatus *parameterStatus, buf []byte, x interface{}, typ oid.Oid) ([]byte, error) {
+	switch typ {
+	case oid.T_bool:
+		b, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as bool", x)
+		}
+		if b {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case oid.T_int1, oid.T_int2, oid.T_int4, oid.T_int8:
+		return appendBinaryInt(buf, x, typ)
+	case oid.T_float4, oid.T_float8:
+		f, err := binaryFloat(x)
+		if err != nil {
+			return nil, err
+		}
+		if typ == oid.T_float4 {
+			return appendInt32(buf, int32(math.Float32bits(float32(f)))), nil
+		}
+		return appendInt64(buf, int64(math.Float64bits(f))), nil
+	case oid.T_numeric:
+		s, err := binaryNumericText(x)
+		if err != nil {
+			return nil, err
+		}
+		return appendNumericBinary(buf, s)
+	case oid.T_timestamp, oid.T_smalldatetime:
+		t, ok := x.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as %s", x, oid.TypeName[typ])
+		}
+		return appendInt64(buf, timestampMicros(wallClockUTC(t))), nil
+	case oid.T_timestamptz:
+		t, ok := x.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as timestamptz", x)
+		}
+		return appendInt64(buf, timestampMicros(t)), nil
+	case oid.T_date:
+		t, ok := x.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as date", x)
+		}
+		secs := wallClockUTC(t).Unix() - postgresEpoch
+		days := secs / 86400
+		if secs%86400 < 0 {
+			days--
+		}
+		return appendInt32(buf, int32(days)), nil
+	case oid.T_bytea:
+		switch v := x.(type) {
+		case []byte:
+			return append(buf, v...), nil
+		case string:
+			return append(buf, v...), nil
+		}
+		return nil, fmt.Errorf("cannot encode %T as bytea", x)
+	case oid.T_uuid:
+		return appendUUIDBinary(buf, x)
+	case oid.T_text, oid.T_varchar, oid.T_bpchar, oid.T_name, oid.T_nvarchar2, oid.T_unknown:
+		switch v := x.(type) {
+		case []byte:
+			return append(buf, v...), nil
+		case string:
+			return append(buf, v...), nil
+		}
+		text, err := encode(parameterStatus, x, typ)
+		if err != nil {
+			return nil, err
+		}
+		return append(buf, text...), nil
+	default:
+		return nil, fmt.Errorf("binary COPY does not support column type %d", typ)
+	}
+}
+
+func appendBinaryInt(buf []byte, x interface{}, typ oid.Oid) ([]byte, error) {
+	var n int64
+	switch v := x.(type) {
+	case int64:
+		n = v
+	case string:
+		var err error
+		if n, err = strconv.ParseInt(strings.TrimSpace(v), 10, 64); err != nil {
+			return nil, err
+		}
+	case []byte:
+		var err error
+		if n, err = strconv.ParseInt(strings.TrimSpace(string(v)), 10, 64); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("cannot encode %T as %s", x, oid.TypeName[typ])
+	}
+
+	switch typ {
+	case oid.T_int1:
+		if n < 0 || n > math.MaxUint8 {
+			return nil, fmt.Errorf("value %d out of range for tinyint", n)
+		}
+		return append(buf, byte(n)), nil
+	case oid.T_int2:
+		if n < math.MinInt16 || n > math.MaxInt16 {
+			return nil, fmt.Errorf("value %d out of range for smallint", n)
+		}
+		return appendInt16(buf, int16(n)), nil
+	case oid.T_int4:
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return nil, fmt.Errorf("value %d out of range for integer", n)
+		}
+		return appendInt32(buf, int32(n)), nil
+	}
+	return appendInt64(buf, n), nil
+}
+
+func binaryFloat(x interface{}) (float64, error) {
+	switch v := x.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case []byte:
+		return strconv.ParseFloat(strings.TrimSpace(string(v)), 64)
+	}
+	return 0, fmt.Errorf("cannot encode %T as float", x)
+}
+
+func binaryNumericText(x interface{}) (string, error) {
+	switch v := x.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		if math.IsInf(v, 0) {
+			return "", fmt.Errorf("cannot encode %v as numeric", v)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case string:
+		return strings.TrimSpace(v), nil
+	case []byte:
+		return strings.TrimSpace(string(v)), nil
+	case decimalDecompose:
+		s, err := decimalText(v)
+		return string(s), err
+	}
+	return "", fmt.Errorf("cannot encode %T as numeric", x)
+}
+
+// appendNumericBinary appends the binary format of the decimal number s:
+// the number of base-10000 digits, the weight of the first digit, the sign,
+// the display scale and the digits themselves.
+func appendNumericBinary(buf []byte, s string) ([]byte, error) {
+	if strings.EqualFold(s, "NaN") {
+		buf = appendInt16(buf, 0)
+		buf = appendInt16(buf, 0)
+		nan := uint16(numericNaN)
+		buf = appendInt16(buf, int16(nan))
+		return appendInt16(buf, 0), nil
+	}
+
+	sign := numericPos
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign = numericNeg
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	if intPart == "" && fracPart == "" {
+		return nil, fmt.Errorf("invalid numeric value %q", s)
+	}
+	for _, part := range []string{intPart, fracPart} {
+		for i := 0; i < len(part); i++ {
+			if part[i] < '0' || part[i] > '9' {
+				return nil, fmt.Errorf("invalid numeric value %q", s)
+			}
+		}
+	}
+	dscale := len(fracPart)
+
+	// align both parts on base-10000 digit boundaries
+	if pad := len(intPart) % 4; pad != 0 {
+		intPart = strings.Repeat("0", 4-pad) + intPart
+	}
+	if pad := len(fracPart) % 4; pad != 0 {
+		fracPart += strings.Repeat("0", 4-pad)
+	}
+	all := intPart + fracPart
+	digits := make([]int16, 0, len(all)/4)
+	for i := 0; i < len(all); i += 4 {
+		d, _ := strconv.Atoi(all[i : i+4])
+		digits = append(digits, int16(d))
+	}
+	weight := len(intPart)/4 - 1
+	for len(digits) > 0 && digits[0] == 0 {
+		digits = digits[1:]
+		weight--
+	}
+	for len(digits) > 0 && digits[len(digits)-1] == 0 {
+		digits = digits[:len(digits)-1]
+	}
+	if len(digits) == 0 {
+		weight = 0
+		sign = numericPos
+	}
+
+	buf = appendInt16(buf, int16(len(digits)))
+	buf = appendInt16(buf, int16(weight))
+	buf = appendInt16(buf, int16(sign))
+	buf = appendInt16(buf, int16(dscale))
+	for _, d := range digits {
+		buf = appendInt16(buf, d)
+	}
+	return buf, nil
+}
+
+// appendUUIDBinary appends the 16 bytes of a uuid given either in its
+// binary or in its text format.
+func appendUUIDBinary(buf []byte, x interface{}) ([]byte, error) {
+	var src []byte
+	switch v := x.(type) {
+	case []byte:
+		if len(v) == 16 {
+			return append(buf, v...), nil
+		}
+		src = v
+	case string:
+		src = []byte(v)
+	default:
+		return nil, fmt.Errorf("cannot encode %T as uuid", x)
+	}
+
+	text := strings.Replace(strings.Trim(string(src), "{}"), "-", "", -1)
+	if len(text) != 32 {
+		return nil, fmt.Errorf("pq: unable to encode uuid; bad length: %d", len(src))
+	}
+	dst := make([]byte, 16)
+	if _, err := hex.Decode(dst, []byte(text)); err != nil {
+		return nil, fmt.Errorf("pq: unable to encode uuid: %w", err)
+	}
+	return append(buf, dst...), nil
+}
+
+// wallClockUTC returns the wall clock of t as a UTC time, which is how values
+// for columns without a time zone are sent.
+func wallClockUTC(t time.Time) time.Time {
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+	return time.Date(year, month, day, hour, min, sec, t.Nanosecond(), time.UTC)
+}
+
+func timestampMicros(t time.Time) int64 {
+	return (t.Unix()-postgresEpoch)*1000000 + int64(t.Nanosecond()/1000)
+}
+
+func appendInt16(buf []byte, n int16) []byte {
+	return append(buf, byte(n>>8), byte(n))
+}
+
+func appendInt32(buf []byte, n int32) []byte {
+	return append(buf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendInt64(buf []byte, n int64) []byte {
+	return append(buf, byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32),
+		byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
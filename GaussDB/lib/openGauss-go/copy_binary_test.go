@@ -0,0 +1,114 @@
+package pq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+func TestBinaryCopyColumnsQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want string
+	}{
+		{CopyInBinary("items", "id", "name"), `SELECT "id", "name" FROM "items" LIMIT 0`},
+		{`COPY items FROM STDIN WITH (FORMAT binary)`, `SELECT * FROM items LIMIT 0`},
+		{`copy items (id) from stdin (format "BINARY", freeze)`, `SELECT id FROM items LIMIT 0`},
+		{`COPY items FROM STDIN BINARY`, `SELECT * FROM items LIMIT 0`},
+		{`COPY items FROM STDIN WITH BINARY OIDS`, `SELECT * FROM items LIMIT 0`},
+		{`COPY items FROM STDIN`, ""},
+		{`COPY items FROM STDIN WITH (FORMAT csv, NULL 'binary')`, ""},
+		{`COPY items FROM '/data/binary.dat'`, ""},
+		{`COPY items FROM STDIN WITH (FORMAT 'text', DELIMITER '|') -- binary`, ""},
+		{`COPY "binary" FROM STDIN`, ""},
+		{`COPY items ("binary") FROM STDIN`, ""},
+		{`COPY items TO STDOUT (FORMAT binary)`, ""},
+	}
+	for _, tt := range tests {
+		got, ok := binaryCopyColumnsQuery(tt.q)
+		if ok != (tt.want != "") || got != tt.want {
+			t.Errorf("binaryCopyColumnsQuery(%q) = %q, %v, want %q", tt.q, got, ok, tt.want)
+		}
+	}
+}
+
+// binaryCopyScript answers the description of the target columns and the
+// binary COPY itself, whose data is sent to copied.
+func binaryCopyScript(copyBinary bool, copied chan<- []byte) *pqtest.Script {
+	cols := []pqtest.Column{{Name: "id", OID: 23}, {Name: "name", OID: 25}}
+	return pqtest.NewScript().
+		On(`SELECT "id", "name" FROM "items" LIMIT 0`, &pqtest.Result{Columns: cols}).
+		On(CopyInBinary("items", "id", "name"), &pqtest.Result{
+			Columns:    cols,
+			CopyBinary: copyBinary,
+			CopyIn: func(data []byte) *pqtest.Result {
+				copied <- data
+				return &pqtest.Result{Tag: "COPY 2"}
+			},
+		})
+}
+
+func TestCopyInBinary(t *testing.T) {
+	copied := make(chan []byte, 1)
+	_, db, done := openTestDB(t, binaryCopyScript(true, copied))
+	defer done()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(CopyInBinary("items", "id", "name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][]interface{}{{1, "apple"}, {2, nil}} {
+		if _, err := stmt.Exec(row...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stmt.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var want bytes.Buffer
+	want.Write(copyBinaryHeader)
+	put := func(v interface{}) { binary.Write(&want, binary.BigEndian, v) }
+	put(int16(2))
+	put(int32(4))
+	put(int32(1))
+	put(int32(5))
+	want.WriteString("apple")
+	put(int16(2))
+	put(int32(4))
+	put(int32(2))
+	put(int32(-1))
+	put(int16(-1))
+	if got := <-copied; !bytes.Equal(got, want.Bytes()) {
+		t.Fatalf("server received\n%q\nwant\n%q", got, want.Bytes())
+	}
+}
+
+func TestCopyInBinaryFormatMismatch(t *testing.T) {
+	copied := make(chan []byte, 1)
+	script := binaryCopyScript(false, copied)
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Prepare(CopyInBinary("items", "id", "name")); err != errCopyFormatMismatch {
+		t.Fatalf("got error %v, want %v", err, errCopyFormatMismatch)
+	}
+	// the COPY was aborted with CopyFail
+	select {
+	case data := <-copied:
+		t.Fatalf("COPY completed with %q", data)
+	default:
+	}
+}
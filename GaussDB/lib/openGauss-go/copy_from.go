@@ -0,0 +1,176 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DefaultCopyFromBatchSize is the number of rows CopyFrom loads per
+// transaction when CopyFromOptions.BatchSize is not set.
+const DefaultCopyFromBatchSize = 10000
+
+// RowSource is the row iterator read by CopyFrom.
+type RowSource interface {
+	// Next advances to the next row.  It returns false when there are no
+	// more rows or an error stopped the iteration.
+	Next() bool
+	// Values returns the values of the current row, in the order of the
+	// columns passed to CopyFrom.
+	Values() ([]interface{}, error)
+	// Err returns the error, if any, that stopped the iteration.
+	Err() error
+}
+
+// CopyFromOptions controls a CopyFrom load.
+type CopyFromOptions struct {
+	// Schema qualifies the target table.  If empty the table should be
+	// visible in search_path.
+	Schema string
+	// BatchSize is the number of rows copied and committed per transaction.
+	// Zero means DefaultCopyFromBatchSize.
+	BatchSize int
+	// Binary selects the binary COPY format, see CopyInBinary.
+	Binary bool
+	// Progress, if set, is called after every committed batch with the
+	// total number of rows copied so far.
+	Progress func(rowsCopied int64)
+}
+
+// CopyFrom loads the rows of src into table using COPY FROM STDIN.  The rows
+// are copied in batches of opts.BatchSize, each in its own transaction which
+// is committed before the next batch starts, so a failed or cancelled load
+// keeps every batch committed before the failure.  A batch is only started
+// once src has a row for it.  It returns the number of rows committed.
+//
+// The transactions run on ctx.  When it is done, or src fails, the current
+// batch is rolled back and the error is returned.
+func CopyFrom(ctx context.Context, db *sql.DB, table string, columns []string, src RowSource, opts *CopyFromOptions) (int64, error) {
+	if opts == nil {
+		opts = &CopyFromOptions{}
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultCopyFromBatchSize
+	}
+
+	var query string
+	switch {
+	case opts.Schema != "" && opts.Binary:
+		query = CopyInSchemaBinary(opts.Schema, table, columns...)
+	case opts.Schema != "":
+		query = CopyInSchema(opts.Schema, table, columns...)
+	case opts.Binary:
+		query = CopyInBinary(table, columns...)
+	default:
+		query = CopyIn(table, columns...)
+	}
+
+	var rowsCopied int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return rowsCopied, err
+		}
+		if !src.Next() {
+			break
+		}
+		n, err := copyFromBatch(ctx, db, query, src, batchSize, rowsCopied)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return rowsCopied, ctxErr
+			}
+			return rowsCopied, err
+		}
+		rowsCopied += int64(n)
+		if opts.Progress != nil {
+			opts.Progress(rowsCopied)
+		}
+	}
+	if err := src.Err(); err != nil {
+		return rowsCopied, fmt.Errorf("cannot read row %d: %w", rowsCopied+1, err)
+	}
+	return rowsCopied, nil
+}
+
+// copyFromBatch copies up to batchSize rows of src in one transaction,
+// starting with the current row of src, and returns the number of rows
+// committed.  copied is the number of rows read from src before the batch,
+// to number the rows in errors.
+func copyFromBatch(ctx context.Context, db *sql.DB, query string, src RowSource, batchSize int, copied int64) (n int, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("cannot prepare copy: %w", err)
+	}
+	// Close ends the COPY; after an error the transaction is rolled back
+	// whatever the server made of the rows sent so far.
+	defer func() {
+		if err != nil {
+			_ = stmt.Close()
+		}
+	}()
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return 0, err
+		}
+		var values []interface{}
+		if values, err = src.Values(); err != nil {
+			return 0, fmt.Errorf("cannot read row %d: %w", copied+int64(n)+1, err)
+		}
+		if _, err = stmt.Exec(values...); err != nil {
+			return 0, fmt.Errorf("cannot copy row %d: %w", copied+int64(n)+1, err)
+		}
+		n++
+		if n == batchSize {
+			break
+		}
+		if !src.Next() {
+			if err = src.Err(); err != nil {
+				return 0, fmt.Errorf("cannot read row %d: %w", copied+int64(n)+1, err)
+			}
+			break
+		}
+	}
+
+	// Close flushes the buffered rows and ends the COPY
+	if err = stmt.Close(); err != nil {
+		return 0, fmt.Errorf("cannot finish copy: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("cannot commit copy: %w", err)
+	}
+	return n, nil
+}
+
+// CopyFromRows returns a RowSource reading the given rows.
+func CopyFromRows(rows [][]interface{}) RowSource {
+	return &copyFromRows{rows: rows, idx: -1}
+}
+
+type copyFromRows struct {
+	rows [][]interface{}
+	idx  int
+}
+
+func (r *copyFromRows) Next() bool {
+	r.idx++
+	return r.idx < len(r.rows)
+}
+
+func (r *copyFromRows) Values() ([]interface{}, error) {
+	return r.rows[r.idx], nil
+}
+
+func (r *copyFromRows) Err() error {
+	return nil
+}
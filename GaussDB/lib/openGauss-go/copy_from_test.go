@@ -0,0 +1,215 @@
+package pq
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+// copyFromScript answers the COPY of CopyFrom into items, collecting the
+// data of every COPY.
+type copyFromScript struct {
+	*pqtest.Script
+
+	lock   sync.Mutex
+	copies []string
+}
+
+func newCopyFromScript() *copyFromScript {
+	s := &copyFromScript{Script: pqtest.NewScript()}
+	s.On(CopyIn("items", "id", "name"), &pqtest.Result{
+		Columns: []pqtest.Column{{Name: "id", OID: 23}, {Name: "name", OID: 25}},
+		CopyIn: func(data []byte) *pqtest.Result {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			s.copies = append(s.copies, string(data))
+			return &pqtest.Result{Tag: "COPY " + strconv.Itoa(strings.Count(string(data), "\n"))}
+		},
+	})
+	return s
+}
+
+func (s *copyFromScript) Copies() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.copies...)
+}
+
+// statements returns the statements received, with the COPY shortened to
+// its first word.
+func (s *copyFromScript) statements() string {
+	var stmts []string
+	for _, q := range s.Received() {
+		stmts = append(stmts, firstStatementWord(q))
+	}
+	return strings.Join(stmts, " ")
+}
+
+func firstStatementWord(q string) string {
+	if i := strings.IndexByte(q, ' '); i >= 0 {
+		return q[:i]
+	}
+	return q
+}
+
+func itemRows(n int) [][]interface{} {
+	rows := make([][]interface{}, n)
+	for i := range rows {
+		rows[i] = []interface{}{i + 1, "item"}
+	}
+	return rows
+}
+
+func TestCopyFromBatches(t *testing.T) {
+	tests := []struct {
+		rows       int
+		batchSize  int
+		copies     int
+		progress   []int64
+		statements string
+	}{
+		{5, 2, 3, []int64{2, 4, 5}, "BEGIN COPY COMMIT BEGIN COPY COMMIT BEGIN COPY COMMIT"},
+		// no empty transaction after the last full batch
+		{4, 2, 2, []int64{2, 4}, "BEGIN COPY COMMIT BEGIN COPY COMMIT"},
+		{0, 2, 0, nil, ""},
+	}
+	for _, tt := range tests {
+		script := newCopyFromScript()
+		_, db, done := openTestDB(t, script)
+
+		var progress []int64
+		n, err := CopyFrom(context.Background(), db, "items", []string{"id", "name"}, CopyFromRows(itemRows(tt.rows)),
+			&CopyFromOptions{BatchSize: tt.batchSize, Progress: func(rows int64) { progress = append(progress, rows) }})
+		done()
+		if err != nil {
+			t.Fatalf("%d rows: %v", tt.rows, err)
+		}
+		if n != int64(tt.rows) {
+			t.Errorf("%d rows: copied %d", tt.rows, n)
+		}
+		if copies := script.Copies(); len(copies) != tt.copies {
+			t.Errorf("%d rows: got %d COPY statements, want %d", tt.rows, len(copies), tt.copies)
+		}
+		if len(progress) != len(tt.progress) {
+			t.Errorf("%d rows: progress %v, want %v", tt.rows, progress, tt.progress)
+		}
+		for i := range progress {
+			if i < len(tt.progress) && progress[i] != tt.progress[i] {
+				t.Errorf("%d rows: progress %v, want %v", tt.rows, progress, tt.progress)
+				break
+			}
+		}
+		if got := script.statements(); got != tt.statements {
+			t.Errorf("%d rows: statements %q, want %q", tt.rows, got, tt.statements)
+		}
+	}
+}
+
+// failingSource returns the rows of CopyFromRows, then fails.
+type failingSource struct {
+	RowSource
+	err error
+}
+
+func (s *failingSource) Err() error {
+	return s.err
+}
+
+func TestCopyFromSourceError(t *testing.T) {
+	script := newCopyFromScript()
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	readErr := errors.New("truncated file")
+	src := &failingSource{RowSource: CopyFromRows(itemRows(4)), err: readErr}
+	n, err := CopyFrom(context.Background(), db, "items", []string{"id", "name"}, src, &CopyFromOptions{BatchSize: 3})
+	if !errors.Is(err, readErr) {
+		t.Fatalf("got error %v, want the error of the source", err)
+	}
+	if !strings.Contains(err.Error(), "row 5") {
+		t.Errorf("error %q does not name row 5", err)
+	}
+	if n != 3 {
+		t.Errorf("copied %d rows, want the 3 rows of the first batch", n)
+	}
+	// the partial second batch is rolled back
+	if got, want := script.statements(), "BEGIN COPY COMMIT BEGIN COPY ROLLBACK"; got != want {
+		t.Errorf("statements %q, want %q", got, want)
+	}
+}
+
+// valuesErrorSource fails to return the values of row n.
+type valuesErrorSource struct {
+	RowSource
+	row, n int
+}
+
+func (s *valuesErrorSource) Next() bool {
+	s.row++
+	return s.RowSource.Next()
+}
+
+func (s *valuesErrorSource) Values() ([]interface{}, error) {
+	if s.row == s.n {
+		return nil, errors.New("bad value")
+	}
+	return s.RowSource.Values()
+}
+
+func TestCopyFromValuesError(t *testing.T) {
+	script := newCopyFromScript()
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	src := &valuesErrorSource{RowSource: CopyFromRows(itemRows(4)), n: 2}
+	n, err := CopyFrom(context.Background(), db, "items", []string{"id", "name"}, src, &CopyFromOptions{BatchSize: 3})
+	if err == nil || !strings.Contains(err.Error(), "row 2") {
+		t.Fatalf("got error %v, want one naming row 2", err)
+	}
+	if n != 0 {
+		t.Errorf("copied %d rows, want 0", n)
+	}
+	if got, want := script.statements(), "BEGIN COPY ROLLBACK"; got != want {
+		t.Errorf("statements %q, want %q", got, want)
+	}
+}
+
+// cancelingSource cancels a context once row n has been read.
+type cancelingSource struct {
+	RowSource
+	row, n int
+	cancel func()
+}
+
+func (s *cancelingSource) Next() bool {
+	s.row++
+	if s.row == s.n {
+		s.cancel()
+	}
+	return s.RowSource.Next()
+}
+
+func TestCopyFromContextCanceled(t *testing.T) {
+	script := newCopyFromScript()
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src := &cancelingSource{RowSource: CopyFromRows(itemRows(6)), n: 3, cancel: cancel}
+	n, err := CopyFrom(ctx, db, "items", []string{"id", "name"}, src, &CopyFromOptions{BatchSize: 2})
+	if err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if n != 2 {
+		t.Errorf("copied %d rows, want the 2 rows of the first batch", n)
+	}
+	if copies := script.Copies(); len(copies) != 1 {
+		t.Errorf("got %d completed COPY statements, want 1", len(copies))
+	}
+}
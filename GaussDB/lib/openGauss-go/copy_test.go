@@ -0,0 +1,207 @@
+package pq
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"testing"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+// withDriverConn runs f on a driver connection of db.
+func withDriverConn(t *testing.T, db *sql.DB, f func(c driver.Conn) error) error {
+	t.Helper()
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	return c.Raw(func(dc interface{}) error {
+		return f(dc.(driver.Conn))
+	})
+}
+
+// connPID returns the backend process ID of a driver connection of db, to
+// tell whether a connection was reused.
+func connPID(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var pid int
+	if err := withDriverConn(t, db, func(c driver.Conn) error {
+		pid = c.(*conn).processID
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return pid
+}
+
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestCopyTo(t *testing.T) {
+	script := pqtest.NewScript().On(`COPY "items" ("id", "name") TO STDOUT`, &pqtest.Result{
+		Columns: []pqtest.Column{{Name: "id", OID: 23}, {Name: "name", OID: 25}},
+		CopyOut: [][]byte{[]byte("1\tapple\n"), []byte("2\tpear\n")},
+		Tag:     "COPY 2",
+	})
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	var buf bytes.Buffer
+	var n int64
+	err := withDriverConn(t, db, func(c driver.Conn) (err error) {
+		n, err = CopyTo(context.Background(), c, &buf, CopyOut("items", "id", "name"))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d rows, want 2", n)
+	}
+	if buf.String() != "1\tapple\n2\tpear\n" {
+		t.Errorf("got data %q", buf.String())
+	}
+}
+
+func TestCopyToErrors(t *testing.T) {
+	script := pqtest.NewScript().
+		On("COPY missing TO STDOUT", &pqtest.Result{Err: pqtest.NewError("42P01", `relation "missing" does not exist`)}).
+		On("COPY items FROM STDIN", &pqtest.Result{CopyIn: func([]byte) *pqtest.Result { return nil }}).
+		On("select 1", int4Result("?column?", 1))
+	_, db, done := openTestDB(t, script)
+	defer done()
+	db.SetMaxOpenConns(1)
+
+	tests := []struct {
+		query string
+		check func(err error) bool
+	}{
+		{"COPY missing TO STDOUT", func(err error) bool {
+			var pgErr *Error
+			return errors.As(err, &pgErr) && pgErr.Code == "42P01"
+		}},
+		{"COPY items FROM STDIN", func(err error) bool { return err == errCopyFromNotSupported }},
+		{"select 1", func(err error) bool { return err == errNotCopyTo }},
+	}
+	pid := connPID(t, db)
+	for _, tt := range tests {
+		err := withDriverConn(t, db, func(c driver.Conn) error {
+			_, err := CopyTo(context.Background(), c, &bytes.Buffer{}, tt.query)
+			return err
+		})
+		if !tt.check(err) {
+			t.Errorf("%s: unexpected error %v", tt.query, err)
+		}
+		// the error was read up to ReadyForQuery, the connection is reused
+		if got := connPID(t, db); got != pid {
+			t.Errorf("%s: connection was replaced", tt.query)
+		}
+	}
+}
+
+// writeLimitConn fails the writes after the first n.
+type writeLimitConn struct {
+	net.Conn
+	n int
+}
+
+func (c *writeLimitConn) Write(p []byte) (int, error) {
+	if c.n <= 0 {
+		return 0, errors.New("connection reset")
+	}
+	c.n--
+	return c.Conn.Write(p)
+}
+
+func TestCopyToCopyFailSendError(t *testing.T) {
+	script := pqtest.NewScript().On("COPY items FROM STDIN", &pqtest.Result{CopyIn: func([]byte) *pqtest.Result { return nil }})
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	err := withDriverConn(t, db, func(c driver.Conn) error {
+		cn := c.(*conn)
+		// the query is sent, the CopyFail answering CopyInResponse is not
+		cn.c = &writeLimitConn{Conn: cn.c, n: 1}
+		if _, err := CopyTo(context.Background(), c, &bytes.Buffer{}, "COPY items FROM STDIN"); err == nil {
+			t.Error("expected an error sending CopyFail")
+		}
+		if !cn.getBad() {
+			t.Error("connection left in COPY IN was not marked bad")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyToWriterError(t *testing.T) {
+	script := pqtest.NewScript().On("COPY items TO STDOUT", &pqtest.Result{
+		CopyOut: [][]byte{[]byte("1\n"), []byte("2\n")},
+		Tag:     "COPY 2",
+	})
+	_, db, done := openTestDB(t, script)
+	defer done()
+	db.SetMaxOpenConns(1)
+
+	pid := connPID(t, db)
+	writeErr := errors.New("disk full")
+	err := withDriverConn(t, db, func(c driver.Conn) error {
+		_, err := CopyTo(context.Background(), c, failingWriter{writeErr}, "COPY items TO STDOUT")
+		return err
+	})
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("got error %v, want the error of the writer", err)
+	}
+	// the COPY completed before the server saw the CancelRequest, so the
+	// connection must not run another statement
+	if got := connPID(t, db); got == pid {
+		t.Fatal("connection with a pending CancelRequest was reused")
+	}
+}
+
+func TestCopyToBadCommandTag(t *testing.T) {
+	script := pqtest.NewScript().On("COPY items TO STDOUT", &pqtest.Result{
+		CopyOut: [][]byte{[]byte("1\n")},
+		Tag:     "COPY many",
+	})
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	err := withDriverConn(t, db, func(c driver.Conn) error {
+		_, err := CopyTo(context.Background(), c, &bytes.Buffer{}, "COPY items TO STDOUT")
+		if err == nil {
+			t.Error("expected an error for the command tag")
+		}
+		if !c.(*conn).getBad() {
+			t.Error("connection was not marked bad")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyInPrepareCopyTo(t *testing.T) {
+	script := pqtest.NewScript().On("COPY items TO STDOUT", &pqtest.Result{CopyOut: [][]byte{[]byte("1\n")}})
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Prepare("COPY items TO STDOUT"); err != errCopyToNotSupported {
+		t.Fatalf("got error %v, want %v", err, errCopyToNotSupported)
+	}
+}
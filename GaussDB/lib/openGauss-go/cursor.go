@@ -0,0 +1,152 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+)
+
+type fetchSizeKey struct{}
+
+// WithFetchSize returns a context making the queries run with it fetch their
+// rows n at a time.  The rows are read from a portal on the server with
+// Execute messages limited to n rows, instead of being sent all at once, so
+// the memory used by the client for a huge result set is bounded.  n <= 0
+// turns the cursor mode off.
+//
+// The portal lives until the rows are closed, and the connection can not be
+// used for anything else in the meantime.  Closing the rows early closes the
+// portal without fetching the remaining rows.  When the context is done
+// while the rows are read, the portal is closed and the context error is
+// returned by the next fetch.
+func WithFetchSize(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, fetchSizeKey{}, n)
+}
+
+func contextFetchSize(ctx context.Context) int {
+	n, _ := ctx.Value(fetchSizeKey{}).(int)
+	return n
+}
+
+// rowsCursor is the state of rows fetched from a portal in batches.
+type rowsCursor struct {
+	ctx       context.Context
+	fetchSize int
+	// closing is set by rows.Close to close the portal at the next batch
+	closing bool
+	// synced is set once Sync has been sent, after which the server sends
+	// ReadyForQuery
+	synced bool
+	// err is returned once ReadyForQuery is received
+	err error
+}
+
+func (cn *conn) queryCursor(ctx context.Context, query string, args []driver.Value, fetchSize int) (*rows, error) {
+	if cn.getBad() {
+		return nil, driver.ErrBadConn
+	}
+	if cn.inCopy {
+		return nil, errCopyInProgress
+	}
+	st, _, err := cn.prepareCached(query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prepare with query %s: %w", query, err)
+	}
+	return st.queryCursor(ctx, args, fetchSize)
+}
+
+// queryCursor binds v to the unnamed portal and fetches the first fetchSize
+// rows.  Flush is sent instead of Sync, which would close the portal outside
+// of a transaction.
+func (st *stmt) queryCursor(ctx context.Context, v []driver.Value, fetchSize int) (*rows, error) {
+	cn := st.cn
+	if cn.getBad() {
+		return nil, driver.ErrBadConn
+	}
+	if len(v) != len(st.paramTypes) {
+		return nil, fmt.Errorf("got %d parameters but the statement requires %d", len(v), len(st.paramTypes))
+	}
+	if err := st.reprepare(); err != nil {
+		return nil, err
+	}
+
+	w := cn.writeBuf('B')
+	w.byte(0) // unnamed portal
+	w.string(st.name)
+	if err := st.writeBindParams(w, v); err != nil {
+		return nil, err
+	}
+	w.next('E')
+	w.byte(0)
+	w.int32(fetchSize)
+	w.next('H') // FLUSH
+	if err := cn.send(w); err != nil {
+		return nil, fmt.Errorf("fail to send: %w", err)
+	}
+
+	t, r, err := cn.recv1()
+	if err != nil {
+		cn.setBad()
+		return nil, fmt.Errorf("cannot recv from conn: %w", err)
+	}
+	switch t {
+	case '2': // BindComplete
+	case 'E':
+		err = parseError(r, cn)
+		if serr := cn.send(cn.writeBuf('S')); serr != nil {
+			return nil, fmt.Errorf("fail to send: %w", serr)
+		}
+		if rerr := cn.readReadyForQuery(); rerr != nil {
+			return nil, fmt.Errorf("cannot read ready for query: %w", rerr)
+		}
+		return nil, fmt.Errorf("got error from database: %w", err)
+	default:
+		cn.setBad()
+		return nil, fmt.Errorf("unexpected Bind response %q", t)
+	}
+
+	return &rows{
+		cn:         cn,
+		rowsHeader: st.rowsHeader,
+		cursor:     &rowsCursor{ctx: ctx, fetchSize: fetchSize},
+	}, nil
+}
+
+// fetchMore asks for the next batch of rows after PortalSuspended, or closes
+// the portal if the rows are being closed or the context is done.
+func (rs *rows) fetchMore() error {
+	c, cn := rs.cursor, rs.cn
+	var w *writeBuf
+	if err := c.ctx.Err(); c.closing || err != nil {
+		c.err = err
+		w = cn.writeBuf('C') // CLOSE
+		w.byte('P')
+		w.string("")
+		w.next('S')
+		c.synced = true
+	} else {
+		w = cn.writeBuf('E')
+		w.byte(0)
+		w.int32(c.fetchSize)
+		w.next('H')
+	}
+	if err := cn.send(w); err != nil {
+		cn.setBad()
+		return fmt.Errorf("fail to send: %w", err)
+	}
+	return nil
+}
+
+// endCursor sends the Sync ending the query once the portal is exhausted or
+// failed.
+func (rs *rows) endCursor() error {
+	if rs.cursor.synced {
+		return nil
+	}
+	rs.cursor.synced = true
+	if err := rs.cn.send(rs.cn.writeBuf('S')); err != nil {
+		rs.cn.setBad()
+		return fmt.Errorf("fail to send: %w", err)
+	}
+	return nil
+}
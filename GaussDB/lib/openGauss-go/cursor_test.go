@@ -0,0 +1,183 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+const cursorQuery = "select n from big where n > $1"
+
+func cursorScript(rows int) *pqtest.Script {
+	values := make([]int, rows)
+	for i := range values {
+		values[i] = i + 1
+	}
+	return pqtest.NewScript().
+		On(cursorQuery, int4Result("n", values...)).
+		On("select failed where n > $1", &pqtest.Result{
+			Columns: []pqtest.Column{{Name: "n", OID: 23}},
+			Err:     pqtest.NewError("22012", "division by zero"),
+		}).
+		On("select 1", int4Result("?column?", 1))
+}
+
+// scanInts reads the int column of rows, and closes them.
+func scanInts(rows *sql.Rows, limit int) ([]int, error) {
+	defer rows.Close()
+	var got []int
+	for (limit <= 0 || len(got) < limit) && rows.Next() {
+		var n int
+		if err := rows.Scan(&n); err != nil {
+			return got, err
+		}
+		got = append(got, n)
+	}
+	return got, rows.Err()
+}
+
+// checkConnUsable checks that the single connection of db still runs
+// statements, and returns its backend process ID.
+func checkConnUsable(t *testing.T, db *sql.DB, name string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("select 1").Scan(&n); err != nil {
+		t.Fatalf("%s: connection not usable: %v", name, err)
+	}
+	return connPID(t, db)
+}
+
+func TestCursorFetchSize(t *testing.T) {
+	_, db, done := openTestDB(t, cursorScript(10))
+	defer done()
+	db.SetMaxOpenConns(1)
+	pid := connPID(t, db)
+
+	st, err := db.Prepare(cursorQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	for _, fetchSize := range []int{1, 3, 10, 20, 0} {
+		for _, prepared := range []bool{false, true} {
+			name := fmt.Sprintf("fetch size %d prepared=%v", fetchSize, prepared)
+			ctx := WithFetchSize(context.Background(), fetchSize)
+			var rows *sql.Rows
+			if prepared {
+				rows, err = st.QueryContext(ctx, 0)
+			} else {
+				rows, err = db.QueryContext(ctx, cursorQuery, 0)
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			got, err := scanInts(rows, 0)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if len(got) != 10 || got[0] != 1 || got[9] != 10 {
+				t.Errorf("%s: got rows %v", name, got)
+			}
+			if checkConnUsable(t, db, name) != pid {
+				t.Errorf("%s: connection was replaced", name)
+			}
+		}
+	}
+}
+
+func TestCursorInTransaction(t *testing.T) {
+	_, db, done := openTestDB(t, cursorScript(7))
+	defer done()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(WithFetchSize(context.Background(), 2), cursorQuery, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := scanInts(rows, 0); err != nil || len(got) != 7 {
+		t.Fatalf("got rows %v, error %v", got, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCursorCloseEarly(t *testing.T) {
+	script := cursorScript(100)
+	_, db, done := openTestDB(t, script)
+	defer done()
+	db.SetMaxOpenConns(1)
+	pid := connPID(t, db)
+
+	rows, err := db.QueryContext(WithFetchSize(context.Background(), 10), cursorQuery, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := scanInts(rows, 15); err != nil || len(got) != 15 {
+		t.Fatalf("got rows %v, error %v", got, err)
+	}
+	if checkConnUsable(t, db, "closed early") != pid {
+		t.Error("connection was replaced after closing the rows early")
+	}
+}
+
+func TestCursorContextCanceled(t *testing.T) {
+	_, db, done := openTestDB(t, cursorScript(100))
+	defer done()
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rows, err := db.QueryContext(WithFetchSize(ctx, 10), cursorQuery, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for rows.Next() {
+		if n++; n == 5 {
+			cancel()
+		}
+	}
+	if err := rows.Err(); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	rows.Close()
+	if n >= 100 {
+		t.Errorf("read all %d rows after the context was canceled", n)
+	}
+	// like any statement interrupted by its context, the connection is
+	// closed and the next statement dials a new one
+	checkConnUsable(t, db, "canceled")
+}
+
+func TestCursorError(t *testing.T) {
+	_, db, done := openTestDB(t, cursorScript(1))
+	defer done()
+	db.SetMaxOpenConns(1)
+	pid := connPID(t, db)
+
+	ctx := WithFetchSize(context.Background(), 10)
+	rows, err := db.QueryContext(ctx, "select failed where n > $1", 0)
+	if err == nil {
+		_, err = scanInts(rows, 0)
+	}
+	var pqErr *Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "22012" {
+		t.Fatalf("got error %v, want the error of the server", err)
+	}
+	// a statement which fails to prepare
+	if _, err := db.QueryContext(ctx, "select missing where n > $1", 0); err == nil {
+		t.Fatal("expected the statement to fail")
+	}
+	if checkConnUsable(t, db, "failed") != pid {
+		t.Error("connection was replaced after the error")
+	}
+}
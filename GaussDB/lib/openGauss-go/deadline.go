@@ -0,0 +1,157 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// deadlineReadGrace is how long after the deadline of a context the server
+// has to answer, once the statement is canceled, before it is considered
+// dead.
+const deadlineReadGrace = 5 * time.Second
+
+// watchDeadline sets a read deadline on the socket shortly after the deadline
+// of ctx, so that a read from a server which stopped responding fails instead
+// of blocking forever.  The returned function restores the previous deadline,
+// e.g. the one of the enclosing transaction.
+func (cn *conn) watchDeadline(ctx context.Context) func() {
+	deadline, ok := ctx.Deadline()
+	if !ok || cn.c == nil {
+		return func() {}
+	}
+	deadline = deadline.Add(deadlineReadGrace)
+	prev := cn.readDeadline
+	if !prev.IsZero() && prev.Before(deadline) {
+		return func() {}
+	}
+	cn.setReadDeadline(deadline)
+	return func() { cn.setReadDeadline(prev) }
+}
+
+func (cn *conn) setReadDeadline(t time.Time) {
+	cn.readDeadline = t
+	// fails only once the connection is closed
+	_ = cn.c.SetReadDeadline(t)
+}
+
+// readError returns the error for a failed read from the server.  A timeout
+// means the read deadline set by watchDeadline passed: the node is evicted
+// from the coordinate nodes the connector dials.
+func (cn *conn) readError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		cn.setBad()
+		cn.log(context.Background(), LogLevelWarn, "server not responding", map[string]interface{}{"error": err.Error()})
+		if cn.evictNode != nil {
+			cn.evictNode()
+		}
+	}
+	return connErr{
+		msg: fmt.Sprintf("fail to read: %v", err),
+		err: driver.ErrBadConn, // for database/sql errors.Is and retry
+	}
+}
+
+func (cn *conn) applyStatementTimeout(ctx context.Context) error {
+	cn.LockReaderMutex()
+	defer cn.UnlockReaderMutex()
+	return cn.statementTimeout(ctx)
+}
+
+// statementTimeout sets statement_timeout to the time left until the deadline
+// of ctx, so that the server stops the statement by itself, or resets it for
+// a context without a deadline after it was set.  It does nothing unless
+// Config.DeadlineStatementTimeout is set.
+func (cn *conn) statementTimeout(ctx context.Context) error {
+	if !cn.config.DeadlineStatementTimeout || cn.getBad() || cn.inCopy || cn.txnStatus == txnStatusInFailedTransaction {
+		return nil
+	}
+	var q string
+	deadline, ok := ctx.Deadline()
+	switch {
+	case ok:
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ms := time.Until(deadline).Milliseconds()
+		if ms < 1 {
+			ms = 1
+		}
+		q = fmt.Sprintf("SET statement_timeout = %d", ms)
+	case cn.stmtTimeoutSet:
+		q = "RESET statement_timeout"
+	default:
+		return nil
+	}
+
+	// not a change of the session to reset, see Config.ResetSessionQuery
+	changed := cn.sessionChanged
+	_, _, err := cn.simpleExec(q)
+	cn.sessionChanged = changed
+	if err != nil {
+		return fmt.Errorf("cannot set statement timeout: %w", err)
+	}
+	cn.stmtTimeoutSet = ok
+	if cn.isInTransaction() {
+		// rolling the transaction back undoes the change
+		cn.stmtTimeoutInTxn = true
+	}
+	return nil
+}
+
+// endStatementTimeoutTxn is called when a transaction ends.  The value of
+// statement_timeout is not known any more if it was changed in the
+// transaction, so it is reset by the next statement without a deadline.
+func (cn *conn) endStatementTimeoutTxn() {
+	if cn.stmtTimeoutInTxn {
+		cn.stmtTimeoutSet = true
+		cn.stmtTimeoutInTxn = false
+	}
+}
+
+// evictedNodeTimeout is how long a coordinate node which stopped responding
+// is not dialed.
+const evictedNodeTimeout = 30 * time.Second
+
+// evict stops dialing cNode for evictedNodeTimeout.
+func (d *distributeDialer) evict(cNode coordinateNode) {
+	key := net.JoinHostPort(cNode.ip, strconv.Itoa(int(cNode.port)))
+	d.cnsLock.Lock()
+	if d.evicted == nil {
+		d.evicted = make(map[string]time.Time)
+	}
+	d.evicted[key] = time.Now().Add(evictedNodeTimeout)
+	d.cnsLock.Unlock()
+	d.Log(context.Background(), LogLevelWarn, fmt.Sprintf("evicting CN %v for %v", key, evictedNodeTimeout), map[string]interface{}{})
+}
+
+// withoutEvicted returns the nodes of cns which are not evicted, or all of
+// them if every node is.
+func (d *distributeDialer) withoutEvicted(cns []coordinateNode) []coordinateNode {
+	now := time.Now()
+	d.cnsLock.Lock()
+	defer d.cnsLock.Unlock()
+	if len(d.evicted) == 0 {
+		return cns
+	}
+	kept := make([]coordinateNode, 0, len(cns))
+	for _, cNode := range cns {
+		key := net.JoinHostPort(cNode.ip, strconv.Itoa(int(cNode.port)))
+		if until, ok := d.evicted[key]; ok {
+			if now.Before(until) {
+				continue
+			}
+			delete(d.evicted, key)
+		}
+		kept = append(kept, cNode)
+	}
+	if len(kept) == 0 {
+		return cns
+	}
+	return kept
+}
@@ -0,0 +1,130 @@
+package pq
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+func deadlineScript() *pqtest.Script {
+	return pqtest.NewScript().
+		OnPrefix("SET statement_timeout = ", &pqtest.Result{Tag: "SET"}).
+		On("RESET statement_timeout", &pqtest.Result{Tag: "RESET"}).
+		On(discardAll, &pqtest.Result{Tag: discardAll}).
+		On("select 1", int4Result("?column?", 1))
+}
+
+// timeoutStatements returns the statements received, with the values of
+// statement_timeout left out.
+func timeoutStatements(script *pqtest.Script) string {
+	var stmts []string
+	for _, q := range script.Received() {
+		if strings.HasPrefix(q, "SET statement_timeout = ") {
+			q = "SET statement_timeout"
+		}
+		stmts = append(stmts, q)
+	}
+	return strings.Join(stmts, ";")
+}
+
+func TestDeadlineStatementTimeout(t *testing.T) {
+	script := deadlineScript()
+	_, db, done := openTestDB(t, script, withDSN("deadline_statement_timeout=yes reset_session_query='DISCARD ALL'"), withMaxOpenConns(1))
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	query := func(ctx context.Context) {
+		t.Helper()
+		var n int
+		if err := db.QueryRowContext(ctx, "select 1").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	query(ctx)
+	query(context.Background())
+	query(context.Background())
+	// the timeout of a transaction ends with it
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ExecContext(ctx, "select 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	query(context.Background())
+
+	want := "SET statement_timeout;select 1;RESET statement_timeout;select 1;select 1;" +
+		"BEGIN READ WRITE;SET statement_timeout;select 1;ROLLBACK;RESET statement_timeout;select 1"
+	if got := timeoutStatements(script); got != want {
+		t.Errorf("statements\n%s\nwant\n%s", got, want)
+	}
+	// setting the timeout is not a change of the session to reset
+	if n := countReceived(script, discardAll); n != 0 {
+		t.Errorf("session reset %d times", n)
+	}
+
+	for _, q := range script.Received() {
+		if !strings.HasPrefix(q, "SET statement_timeout = ") {
+			continue
+		}
+		ms := strings.TrimPrefix(q, "SET statement_timeout = ")
+		if d, err := time.ParseDuration(ms + "ms"); err != nil || d <= 0 || d > time.Minute {
+			t.Errorf("statement timeout %q, want the time left until the deadline", ms)
+		}
+	}
+}
+
+func TestDeadlineStatementTimeoutDisabled(t *testing.T) {
+	script := deadlineScript()
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var n int
+	if err := db.QueryRowContext(ctx, "select 1").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if got := timeoutStatements(script); got != "select 1" {
+		t.Errorf("got statements %q without deadline_statement_timeout", got)
+	}
+}
+
+func TestWatchDeadline(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	cn := &conn{c: client}
+
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	restore := cn.watchDeadline(ctx)
+	if want := deadline.Add(deadlineReadGrace); !cn.readDeadline.Equal(want) {
+		t.Fatalf("read deadline %v, want %v", cn.readDeadline, want)
+	}
+	// a later deadline of a statement does not extend the one of the
+	// transaction
+	later, cancelLater := context.WithDeadline(context.Background(), deadline.Add(time.Hour))
+	defer cancelLater()
+	cn.watchDeadline(later)()
+	if want := deadline.Add(deadlineReadGrace); !cn.readDeadline.Equal(want) {
+		t.Fatalf("read deadline %v after a later deadline, want %v", cn.readDeadline, want)
+	}
+	restore()
+	if !cn.readDeadline.IsZero() {
+		t.Fatalf("read deadline %v not restored", cn.readDeadline)
+	}
+	cn.watchDeadline(context.Background())()
+	if !cn.readDeadline.IsZero() {
+		t.Fatalf("read deadline %v set without a context deadline", cn.readDeadline)
+	}
+}
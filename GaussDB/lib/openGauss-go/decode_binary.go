@@ -0,0 +1,478 @@
+package pq
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/oid"
+)
+
+// Binary receive functions for the types listed in decideColumnFormats.  The
+// decoded values are the same as textDecode returns for the text format of
+// the type, so switching formats does not change what is scanned:
+// numeric, interval and arrays decode to their text representation.
+
+const (
+	numericPosInf = 0xD000
+	numericNegInf = 0xF000
+	numericDigits = 4 // decimal digits per base 10000 digit
+)
+
+var errBinaryTooShort = errors.New("binary value too short")
+
+// binaryResultType reports whether values of typ are received in binary
+// format, see decideColumnFormats.  The types decoded in this file are only
+// received in binary with the binary_results option.
+func binaryResultType(ps *parameterStatus, typ oid.Oid, binaryResults bool) bool {
+	switch typ {
+	case oid.T_byteawithoutorderwithequalcol, oid.T_byteawithoutordercol,
+		oid.T__byteawithoutorderwithequalcol, oid.T__byteawithoutordercol,
+		oid.T_bytea, oid.T_int8, oid.T_int4, oid.T_int2, oid.T_uuid:
+		return true
+	}
+	if !binaryResults {
+		return false
+	}
+	switch typ {
+	case oid.T_float4, oid.T_float8, oid.T_bool, oid.T_numeric,
+		oid.T_date, oid.T_time, oid.T_timestamp, oid.T_timestamptz:
+		return true
+	case oid.T__bool, oid.T__int2, oid.T__int4, oid.T__int8, oid.T__float4,
+		oid.T__float8, oid.T__numeric, oid.T__date, oid.T__time,
+		oid.T__timestamp, oid.T__timestamptz:
+		return true
+	case oid.T_interval, oid.T__interval:
+		// decoded to the postgres IntervalStyle only
+		return ps == nil || ps.intervalStyle == "" || ps.intervalStyle == "postgres"
+	default:
+		return false
+	}
+}
+
+func binaryDecodeFloat(s []byte, typ oid.Oid) (float64, error) {
+	if typ == oid.T_float4 {
+		if len(s) != 4 {
+			return 0, errBinaryTooShort
+		}
+		f := math.Float32frombits(binary.BigEndian.Uint32(s))
+		if math.IsInf(float64(f), 0) || math.IsNaN(float64(f)) {
+			return float64(f), nil
+		}
+		// go through the shortest decimal representation, so that the
+		// result is the same as parsing the text format
+		return strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+	}
+	if len(s) != 8 {
+		return 0, errBinaryTooShort
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(s)), nil
+}
+
+func binaryDecodeBool(s []byte) (bool, error) {
+	if len(s) != 1 {
+		return false, errBinaryTooShort
+	}
+	return s[0] != 0, nil
+}
+
+// binaryDecodeTimestamp decodes timestamp, timestamptz and date values.
+// Infinite values are handled as parseTs does.
+func binaryDecodeTimestamp(ps *parameterStatus, s []byte, typ oid.Oid) (interface{}, error) {
+	t, infinite, err := binaryTimestamp(ps, s, typ)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case infinite > 0 && infinityTsEnabled:
+		return infinityTsPositive, nil
+	case infinite > 0:
+		return []byte("infinity"), nil
+	case infinite < 0 && infinityTsEnabled:
+		return infinityTsNegative, nil
+	case infinite < 0:
+		return []byte("-infinity"), nil
+	}
+	return t, nil
+}
+
+// binaryTimestamp decodes a timestamp, timestamptz or date value.  infinite
+// is 1 for infinity and -1 for -infinity, t is not set then.  timestamptz
+// values are in the session time zone if it is known and in UTC otherwise,
+// other values are in UTC.
+func binaryTimestamp(ps *parameterStatus, s []byte, typ oid.Oid) (t time.Time, infinite int, err error) {
+	if typ == oid.T_date {
+		if len(s) != 4 {
+			return t, 0, errBinaryTooShort
+		}
+		days := int32(binary.BigEndian.Uint32(s))
+		switch days {
+		case math.MaxInt32:
+			return t, 1, nil
+		case math.MinInt32:
+			return t, -1, nil
+		}
+		t = time.Unix(postgresEpoch, 0).UTC().AddDate(0, 0, int(days))
+	} else {
+		if len(s) != 8 {
+			return t, 0, errBinaryTooShort
+		}
+		micros := int64(binary.BigEndian.Uint64(s))
+		switch micros {
+		case math.MaxInt64:
+			return t, 1, nil
+		case math.MinInt64:
+			return t, -1, nil
+		}
+		t = time.Unix(postgresEpoch+micros/1000000, (micros%1000000)*1000)
+	}
+
+	if typ == oid.T_timestamptz && ps != nil && ps.currentLocation != nil {
+		return t.In(ps.currentLocation), 0, nil
+	}
+	return t.In(globalLocationCache.getLocation(0)), 0, nil
+}
+
+func binaryDecodeTime(s []byte) (time.Time, error) {
+	if len(s) != 8 {
+		return time.Time{}, errBinaryTooShort
+	}
+	micros := int64(binary.BigEndian.Uint64(s))
+	return time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(micros) * time.Microsecond), nil
+}
+
+// binaryDecodeNumeric returns the text representation of a numeric value, as
+// the server sends it in text format.
+func binaryDecodeNumeric(s []byte) ([]byte, error) {
+	if len(s) < 8 {
+		return nil, errBinaryTooShort
+	}
+	ndigits := int(binary.BigEndian.Uint16(s))
+	weight := int(int16(binary.BigEndian.Uint16(s[2:])))
+	sign := binary.BigEndian.Uint16(s[4:])
+	dscale := int(binary.BigEndian.Uint16(s[6:]))
+	if len(s) < 8+2*ndigits {
+		return nil, errBinaryTooShort
+	}
+	switch sign {
+	case numericNaN:
+		return []byte("NaN"), nil
+	case numericPosInf:
+		return []byte("Infinity"), nil
+	case numericNegInf:
+		return []byte("-Infinity"), nil
+	}
+	digit := func(i int) int {
+		if i < 0 || i >= ndigits {
+			return 0
+		}
+		return int(binary.BigEndian.Uint16(s[8+2*i:]))
+	}
+
+	buf := make([]byte, 0, (weight+2)*numericDigits+dscale+2)
+	if sign == numericNeg {
+		buf = append(buf, '-')
+	}
+	if weight < 0 {
+		buf = append(buf, '0')
+	} else {
+		buf = strconv.AppendInt(buf, int64(digit(0)), 10)
+		for i := 1; i <= weight; i++ {
+			buf = appendNumericDigit(buf, digit(i))
+		}
+	}
+	if dscale > 0 {
+		buf = append(buf, '.')
+		end := len(buf) + dscale
+		for i := weight + 1; len(buf) < end; i++ {
+			buf = appendNumericDigit(buf, digit(i))
+		}
+		buf = buf[:end]
+	}
+	return buf, nil
+}
+
+// appendNumericDigit appends a base 10000 digit as four decimal digits.
+func appendNumericDigit(buf []byte, d int) []byte {
+	return append(buf, byte('0'+d/1000), byte('0'+d/100%10), byte('0'+d/10%10), byte('0'+d%10))
+}
+
+// binaryDecodeInterval returns the text representation of an interval value
+// in the postgres IntervalStyle.
+func binaryDecodeInterval(s []byte) ([]byte, error) {
+	if len(s) != 16 {
+		return nil, errBinaryTooShort
+	}
+	micros := int64(binary.BigEndian.Uint64(s))
+	days := int64(int32(binary.BigEndian.Uint32(s[8:])))
+	months := int64(int32(binary.BigEndian.Uint32(s[12:])))
+
+	var (
+		buf      []byte
+		isZero   = true
+		isBefore = false
+	)
+	addPart := func(value int64, unit string) {
+		if value == 0 {
+			return
+		}
+		if !isZero {
+			buf = append(buf, ' ')
+		}
+		if isBefore && value > 0 {
+			buf = append(buf, '+')
+		}
+		buf = strconv.AppendInt(buf, value, 10)
+		buf = append(buf, ' ')
+		buf = append(buf, unit...)
+		if value != 1 {
+			buf = append(buf, 's')
+		}
+		isBefore = value < 0
+		isZero = false
+	}
+	addPart(months/12, "year")
+	addPart(months%12, "mon")
+	addPart(days, "day")
+
+	if isZero || micros != 0 {
+		if !isZero {
+			buf = append(buf, ' ')
+		}
+		if micros < 0 {
+			buf = append(buf, '-')
+			micros = -micros
+		} else if isBefore {
+			buf = append(buf, '+')
+		}
+		hours := micros / 3600000000
+		micros -= hours * 3600000000
+		minutes := micros / 60000000
+		micros -= minutes * 60000000
+		buf = appendTwoDigits(buf, hours)
+		buf = append(buf, ':')
+		buf = appendTwoDigits(buf, minutes)
+		buf = append(buf, ':')
+		buf = appendSeconds(buf, micros)
+	}
+	return buf, nil
+}
+
+func appendTwoDigits(buf []byte, n int64) []byte {
+	if n < 10 {
+		buf = append(buf, '0')
+	}
+	return strconv.AppendInt(buf, n, 10)
+}
+
+// appendSeconds appends micros as seconds with up to six fractional digits
+// and without trailing zeros.
+func appendSeconds(buf []byte, micros int64) []byte {
+	buf = appendTwoDigits(buf, micros/1000000)
+	frac := micros % 1000000
+	if frac == 0 {
+		return buf
+	}
+	digits := strconv.FormatInt(frac+1000000, 10)[1:]
+	return append(append(buf, '.'), strings.TrimRight(digits, "0")...)
+}
+
+// binaryDecodeArray returns the text representation of an array value, as
+// the server sends it in text format.
+func binaryDecodeArray(ps *parameterStatus, s []byte) ([]byte, error) {
+	if len(s) < 12 {
+		return nil, errBinaryTooShort
+	}
+	ndim := int(int32(binary.BigEndian.Uint32(s)))
+	elemType := oid.Oid(binary.BigEndian.Uint32(s[8:]))
+	s = s[12:]
+	if ndim == 0 {
+		return []byte("{}"), nil
+	}
+	if ndim < 0 || len(s) < 8*ndim {
+		return nil, errBinaryTooShort
+	}
+
+	dims := make([]int, ndim)
+	var buf []byte
+	hasBounds := false
+	for i := range dims {
+		dims[i] = int(int32(binary.BigEndian.Uint32(s[8*i:])))
+		if binary.BigEndian.Uint32(s[8*i+4:]) != 1 {
+			hasBounds = true
+		}
+	}
+	if hasBounds {
+		for i := range dims {
+			lbound := int64(int32(binary.BigEndian.Uint32(s[8*i+4:])))
+			buf = append(buf, '[')
+			buf = strconv.AppendInt(buf, lbound, 10)
+			buf = append(buf, ':')
+			buf = strconv.AppendInt(buf, lbound+int64(dims[i])-1, 10)
+			buf = append(buf, ']')
+		}
+		buf = append(buf, '=')
+	}
+	s = s[8*ndim:]
+
+	var err error
+	buf, s, err = appendArrayDim(ps, buf, s, dims, elemType)
+	if err != nil {
+		return nil, err
+	}
+	if len(s) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes in binary array", len(s))
+	}
+	return buf, nil
+}
+
+func appendArrayDim(ps *parameterStatus, buf, s []byte, dims []int, elemType oid.Oid) ([]byte, []byte, error) {
+	buf = append(buf, '{')
+	for i := 0; i < dims[0]; i++ {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		if len(dims) > 1 {
+			var err error
+			buf, s, err = appendArrayDim(ps, buf, s, dims[1:], elemType)
+			if err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		if len(s) < 4 {
+			return nil, nil, errBinaryTooShort
+		}
+		n := int(int32(binary.BigEndian.Uint32(s)))
+		s = s[4:]
+		if n < 0 {
+			buf = append(buf, "NULL"...)
+			continue
+		}
+		if len(s) < n {
+			return nil, nil, errBinaryTooShort
+		}
+		elem, err := binaryArrayElementText(ps, s[:n], elemType)
+		if err != nil {
+			return nil, nil, err
+		}
+		s = s[n:]
+		buf = appendArrayElementText(buf, elem)
+	}
+	return append(buf, '}'), s, nil
+}
+
+// binaryArrayElementText returns the text representation of an array
+// element.
+func binaryArrayElementText(ps *parameterStatus, s []byte, typ oid.Oid) ([]byte, error) {
+	switch typ {
+	case oid.T_bool:
+		b, err := binaryDecodeBool(s)
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			return []byte("t"), nil
+		}
+		return []byte("f"), nil
+	case oid.T_int2, oid.T_int4, oid.T_int8:
+		v, err := binaryDecode(ps, s, typ)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, v.(int64), 10), nil
+	case oid.T_float4, oid.T_float8:
+		f, err := binaryDecodeFloat(s, typ)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case math.IsNaN(f):
+			return []byte("NaN"), nil
+		case math.IsInf(f, 1):
+			return []byte("Infinity"), nil
+		case math.IsInf(f, -1):
+			return []byte("-Infinity"), nil
+		}
+		return strconv.AppendFloat(nil, f, 'g', -1, 64), nil
+	case oid.T_numeric:
+		return binaryDecodeNumeric(s)
+	case oid.T_interval:
+		return binaryDecodeInterval(s)
+	case oid.T_time:
+		t, err := binaryDecodeTime(s)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(t.Format("15:04:05.999999")), nil
+	case oid.T_date, oid.T_timestamp, oid.T_timestamptz:
+		t, infinite, err := binaryTimestamp(ps, s, typ)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case infinite > 0:
+			return []byte("infinity"), nil
+		case infinite < 0:
+			return []byte("-infinity"), nil
+		}
+		return formatArrayTs(t, typ), nil
+	default:
+		return nil, fmt.Errorf("don't know how to decode binary array element of type %d", uint32(typ))
+	}
+}
+
+// formatArrayTs formats a date or timestamp the way the server does with the
+// ISO DateStyle.
+func formatArrayTs(t time.Time, typ oid.Oid) []byte {
+	bc := false
+	if t.Year() <= 0 {
+		t = t.AddDate((-t.Year())*2+1, 0, 0)
+		bc = true
+	}
+	var b []byte
+	switch typ {
+	case oid.T_date:
+		b = []byte(t.Format("2006-01-02"))
+	case oid.T_timestamp:
+		b = []byte(t.Format("2006-01-02 15:04:05.999999"))
+	default:
+		b = []byte(t.Format("2006-01-02 15:04:05.999999-07"))
+		_, offset := t.Zone()
+		if offset < 0 {
+			offset = -offset
+		}
+		if rem := offset % 3600; rem != 0 {
+			b = append(b, ':')
+			b = appendTwoDigits(b, int64(rem/60))
+			if rem%60 != 0 {
+				b = append(b, ':')
+				b = appendTwoDigits(b, int64(rem%60))
+			}
+		}
+	}
+	if bc {
+		b = append(b, " BC"...)
+	}
+	return b
+}
+
+// appendArrayElementText appends an array element, quoted only where the
+// server quotes it.
+func appendArrayElementText(buf, elem []byte) []byte {
+	if len(elem) == 0 || strings.EqualFold(string(elem), "NULL") {
+		return appendArrayQuotedBytes(buf, elem)
+	}
+	for _, c := range elem {
+		switch c {
+		case '{', '}', ',', '"', '\\', ' ', '\t', '\n', '\r', '\v', '\f':
+			return appendArrayQuotedBytes(buf, elem)
+		}
+	}
+	return append(buf, elem...)
+}
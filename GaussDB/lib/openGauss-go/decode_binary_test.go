@@ -0,0 +1,161 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/oid"
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+const binaryResultsQuery = "select * from samples where id = $1"
+
+var binaryResultsColumns = []pqtest.Column{
+	{Name: "f8", OID: uint32(oid.T_float8)},
+	{Name: "f4", OID: uint32(oid.T_float4)},
+	{Name: "b", OID: uint32(oid.T_bool)},
+	{Name: "d", OID: uint32(oid.T_date)},
+	{Name: "ts", OID: uint32(oid.T_timestamp)},
+	{Name: "tstz", OID: uint32(oid.T_timestamptz)},
+	{Name: "t", OID: uint32(oid.T_time)},
+	{Name: "n", OID: uint32(oid.T_numeric)},
+	{Name: "i", OID: uint32(oid.T_int4)},
+}
+
+// queryBinaryResults returns the values of the sample row, and the formats
+// its columns were received in.
+func queryBinaryResults(t *testing.T, options string) ([]driver.Value, []format) {
+	t.Helper()
+	script := pqtest.NewScript().On(binaryResultsQuery, &pqtest.Result{
+		Columns: binaryResultsColumns,
+		Rows: [][][]byte{pqtest.Row("1.5", "0.1", "t", "2024-02-29", "2024-02-29 12:34:56.789",
+			"2024-02-29 12:34:56.5+00", "12:34:56.5", "-1234.5600", "42")},
+	})
+	_, db, done := openTestDB(t, script, withDSN(options))
+	defer done()
+
+	values := make([]driver.Value, len(binaryResultsColumns))
+	var formats []format
+	err := withDriverConn(t, db, func(c driver.Conn) error {
+		st, err := c.Prepare(binaryResultsQuery)
+		if err != nil {
+			return err
+		}
+		defer st.Close()
+		formats = st.(*stmt).colFmts
+		rows, err := st.Query([]driver.Value{int64(1)})
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		return rows.Next(values)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values, formats
+}
+
+func TestBinaryResults(t *testing.T) {
+	text, textFormats := queryBinaryResults(t, "")
+	binary, binaryFormats := queryBinaryResults(t, "binary_results=yes")
+
+	for i, col := range binaryResultsColumns {
+		wantText := col.OID != uint32(oid.T_int4)
+		if (textFormats[i] == formatText) != wantText {
+			t.Errorf("%s: received in format %d without binary_results", col.Name, textFormats[i])
+		}
+		if binaryFormats[i] != formatBinary {
+			t.Errorf("%s: received in format %d with binary_results", col.Name, binaryFormats[i])
+		}
+		// decoded to the same values as in text format
+		if tt, ok := text[i].(time.Time); ok {
+			if bt, ok := binary[i].(time.Time); !ok || !bt.Equal(tt) {
+				t.Errorf("%s: got %v in binary, %v in text", col.Name, binary[i], text[i])
+			}
+			continue
+		}
+		if !reflect.DeepEqual(text[i], binary[i]) {
+			t.Errorf("%s: got %#v in binary, %#v in text", col.Name, binary[i], text[i])
+		}
+	}
+}
+
+func int32Binary(n int32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(n))
+	return b
+}
+
+func int64Binary(n int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(n))
+	return b
+}
+
+func concatBinary(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func intervalBinary(micros int64, days, months int32) []byte {
+	return concatBinary(int64Binary(micros), int32Binary(days), int32Binary(months))
+}
+
+func TestBinaryDecodeTextRepresentation(t *testing.T) {
+	int4Array := concatBinary(int32Binary(1), int32Binary(1), int32Binary(int32(oid.T_int4)),
+		int32Binary(3), int32Binary(1),
+		int32Binary(4), int32Binary(1), int32Binary(-1), int32Binary(4), int32Binary(3))
+	tests := []struct {
+		typ  oid.Oid
+		in   []byte
+		want string
+	}{
+		{oid.T_interval, intervalBinary((4*3600+5*60+6)*1000000+500000, 3, 14), "1 year 2 mons 3 days 04:05:06.5"},
+		{oid.T_interval, intervalBinary(-1000000, 0, 0), "-00:00:01"},
+		{oid.T_interval, intervalBinary(0, 0, 0), "00:00:00"},
+		{oid.T__int4, int4Array, "{1,NULL,3}"},
+		{oid.T__int4, concatBinary(int32Binary(0), int32Binary(0), int32Binary(int32(oid.T_int4))), "{}"},
+	}
+	for _, tt := range tests {
+		got, err := binaryDecode(&parameterStatus{}, tt.in, tt.typ)
+		if err != nil {
+			t.Errorf("%d %q: %v", tt.typ, tt.want, err)
+			continue
+		}
+		if b, ok := got.([]byte); !ok || string(b) != tt.want {
+			t.Errorf("%d: got %#v, want %q", tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestBinaryDecodeErrors(t *testing.T) {
+	tests := []struct {
+		typ oid.Oid
+		in  []byte
+	}{
+		{oid.T_float8, []byte{1, 2, 3}},
+		{oid.T_float4, []byte{1, 2}},
+		{oid.T_bool, nil},
+		{oid.T_timestamp, []byte{1, 2, 3, 4}},
+		{oid.T_date, []byte{1}},
+		{oid.T_interval, intervalBinary(0, 0, 0)[:12]},
+		{oid.T_numeric, []byte{0, 1}},
+		// an element longer than the value
+		{oid.T__int4, concatBinary(int32Binary(1), int32Binary(0), int32Binary(int32(oid.T_int4)),
+			int32Binary(1), int32Binary(1), int32Binary(8), int32Binary(1))},
+		// a truncated header
+		{oid.T__int4, int32Binary(1)},
+	}
+	for _, tt := range tests {
+		if got, err := binaryDecode(&parameterStatus{}, tt.in, tt.typ); err == nil {
+			t.Errorf("%d %v: got %#v, want an error", tt.typ, tt.in, got)
+		}
+	}
+}
@@ -5,6 +5,7 @@ package pq
 import (
 	"os"
 	"os/user"
+	"path/filepath"
 )
 
 func defaultSettings() map[string]string {
@@ -19,6 +20,8 @@ func defaultSettings() map[string]string {
 	user, err := user.Current()
 	if err == nil {
 		settings["user"] = user.Username
+		settings["passfile"] = filepath.Join(user.HomeDir, ".pgpass")
+		settings["servicefile"] = filepath.Join(user.HomeDir, ".pg_service.conf")
 	}
 
 	settings["min_read_buffer_size"] = "8192"
@@ -1,7 +1,9 @@
 package pq
 
 import (
+	"os"
 	"os/user"
+	"path/filepath"
 	"strings"
 )
 
@@ -24,6 +26,9 @@ func defaultSettings() map[string]string {
 		}
 
 		settings["user"] = username
+		appData := os.Getenv("APPDATA")
+		settings["passfile"] = filepath.Join(appData, "postgresql", "pgpass.conf")
+		settings["servicefile"] = filepath.Join(user.HomeDir, ".pg_service.conf")
 	}
 
 	settings["min_read_buffer_size"] = "8192"
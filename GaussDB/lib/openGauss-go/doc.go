@@ -77,6 +77,26 @@ pq does not support the LastInsertId() method of the Result type in database/sql
 To return the identifier of an INSERT (or UPDATE or DELETE), use the Postgres
 RETURNING clause with a standard Query or QueryRow call.
 
+Queries with arguments are prepared as unnamed statements on every call.
+Setting statement_cache_capacity to a positive number keeps that many named
+prepared statements per connection, keyed by the query text, and reuses them.
+A cached statement whose plan is invalidated by a schema change is prepared
+again.
+
+Queries run with a context returned by pq.WithFetchSize read their rows in
+batches from a server-side portal, so huge result sets do not have to fit in
+memory at once:
+
+	rows, err := db.QueryContext(pq.WithFetchSize(ctx, 1000), "SELECT * FROM big")
+
+When the context of a query is done, the query is canceled with a cancel
+request.  If the context has a deadline, a server which still has not
+answered 5 seconds after it is considered dead: the connection is closed and
+its coordinate node is not dialed for 30 seconds.  With the
+deadline_statement_timeout=yes connection option, statement_timeout is also
+set to the time left before every statement run with a deadline, so that the
+server stops the statement by itself.
+
 For additional instructions on querying see the documentation for the database/sql package.
 
 Data Types
@@ -97,12 +117,61 @@ This package returns the following types for values from the PostgreSQL backend:
 
 All other types are returned directly from the backend as []byte values in text format.
 
+Numeric values can be scanned into pq.Numeric, which keeps their exact value
+and scale, and which is reported as the scan type of numeric columns.
+pq.Numeric parameters are sent in binary format to numeric parameters.
+
+Results of prepared statements are received in binary format for the bytea,
+integer and uuid types.  When the binary_results connection option is enabled, the
+floating-point, boolean, date/time, numeric and interval types, and arrays of
+these and of the integer types, are received in binary format too.  They are
+decoded to the same values as in text format, so numeric, interval and array
+values are still returned as []byte holding their text representation.
+Intervals are received in binary only while IntervalStyle is postgres, and
+timestamptz values are in the session time zone, or UTC if the time zone is
+not known to Go.  Set the disable_prepared_binary_result connection option to
+receive all results in text format.
+
 
 Errors
 
 pq may return errors of type *pq.Error which can be interrogated for error details.
 See the pq.Error type for details.
 
+Common conditions can be tested without comparing codes, with errors.Is and
+sentinels such as pq.ErrUniqueViolation, or with predicates such as
+pq.IsSerializationFailure and pq.IsConnectionFailure.  pq.IsRetryable reports
+whether running a failed transaction again may succeed; pq.RunInTx runs a
+function in a transaction and retries it on such errors.
+
+Savepoints
+
+Beginning a transaction on a connection which is already in a transaction,
+e.g. by calling BeginTx twice on the same sql.Conn, starts a nested
+transaction in a savepoint.  Committing the nested transaction releases the
+savepoint, and rolling it back undoes only what was done in it, so a failed
+row of a batch can be skipped without losing the enclosing transaction.
+Nested transactions can not set an isolation level or read-only mode.
+
+The transactions of this driver also implement pq.SavepointTx, with
+Savepoint, RollbackTo and Release methods, which can be called through
+sql.Conn.Raw.
+
+Session reset
+
+A connection returned to the pool keeps the settings, temporary tables and
+other session state of the code which used it.  The reset_session_query
+connection option, e.g. reset_session_query='DISCARD ALL', is run when the
+connection is returned to the pool after a statement changed the session
+state: a SET, RESET, LISTEN, PREPARE, DECLARE CURSOR, CREATE TABLE, CREATE
+VIEW, CREATE SEQUENCE or LOAD statement, or any statement after which the
+server reported a changed parameter.  The run-time parameters of the
+connection string are set again after the reset, and statements prepared on
+the connection are prepared again when DISCARD ALL deallocated them.  A
+connection whose reset fails, or which is returned in a transaction, is
+closed instead of being reused.  The same applies to the connections of a
+pq.Pool.
+
 Bulk imports
 
 You can perform bulk imports by preparing a statement returned by pq.CopyIn (or
@@ -117,6 +186,38 @@ failed.
 CopyIn uses COPY FROM internally. It is not possible to COPY outside of an
 explicit transaction in pq.
 
+Statements returned by pq.CopyInBinary (or pq.CopyInSchemaBinary) use the
+binary COPY format instead. The types of the target columns are looked up
+when the statement is prepared, and every value is encoded directly in the
+binary format of its column, which avoids escaping large loads as text.
+Integer, float, numeric, bool, date/timestamp, bytea, uuid and character
+columns are supported. Binary COPY is not available with client encryption.
+
+CopyFrom wraps this in a single call: it reads rows from a RowSource and
+copies them in batches, committing a transaction per batch, reporting progress
+through an optional callback and stopping when the context is done:
+
+	n, err := pq.CopyFrom(ctx, db, "settlement", []string{"id", "amount"},
+		pq.CopyFromRows(rows), &pq.CopyFromOptions{BatchSize: 50000})
+
+Bulk exports
+
+Tables and query results can be exported with CopyTo, which runs a
+COPY ... TO STDOUT statement (see pq.CopyOut, pq.CopyOutSchema and
+pq.CopyOutCSV) and writes the data to an io.Writer as it is received from the
+server, without buffering the whole result in memory:
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var n int64
+	err = conn.Raw(func(driverConn interface{}) error {
+		n, err = pq.CopyTo(ctx, driverConn.(driver.Conn), w, pq.CopyOutCSV("settlement"))
+		return err
+	})
+
 Notifications
 
 PostgreSQL supports a simple publish/subscribe model over database
@@ -144,6 +245,13 @@ The channel name in both Listen and Unlisten is case sensitive, and can contain
 any characters legal in an identifier. Note that the channel name will be truncated to 63
 bytes by the PostgreSQL server.
 
+When notifications from several channels are consumed by independent workers,
+use a Subscriber instead.  Subscriber.Listen returns a Go channel per
+notification channel, each with its own buffer size and overflow policy, and
+the Subscriber opens its connection through a Connector, so that
+reconnections are balanced over the coordinator nodes and every channel is
+listened to again after a reconnect.
+
 
 Kerberos Support
 
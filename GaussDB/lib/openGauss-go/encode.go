@@ -29,6 +29,19 @@ func binaryEncode(parameterStatus *parameterStatus, x interface{}) ([]byte, erro
 	}
 }
 
+// binaryEncodeParam encodes parameter i of a Bind message in the format of
+// paramFormats, the binary numeric format for decimal values sent in binary.
+func binaryEncodeParam(parameterStatus *parameterStatus, x interface{}, paramFormats []int, i int) ([]byte, error) {
+	if d, ok := x.(decimalDecompose); ok && i < len(paramFormats) && paramFormats[i] == 1 {
+		s, err := decimalText(d)
+		if err != nil {
+			return nil, err
+		}
+		return appendNumericBinary(nil, string(s))
+	}
+	return binaryEncode(parameterStatus, x)
+}
+
 func encode(parameterStatus *parameterStatus, x interface{}, pgtypOid oid.Oid) ([]byte, error) {
 	switch v := x.(type) {
 	case int64:
@@ -51,6 +64,8 @@ func encode(parameterStatus *parameterStatus, x interface{}, pgtypOid oid.Oid) (
 		return strconv.AppendBool(nil, v), nil
 	case time.Time:
 		return formatTs(v), nil
+	case decimalDecompose:
+		return decimalText(v)
 
 	default:
 		return nil, fmt.Errorf("encode: unknown type for %T", v)
@@ -149,6 +164,22 @@ func binaryDecode(parameterStatus *parameterStatus, s []byte, typ oid.Oid) (inte
 			return nil, fmt.Errorf("cannot decode UUID binary: %w", err)
 		}
 		return b, nil
+	case oid.T_float4, oid.T_float8:
+		return binaryDecodeFloat(s, typ)
+	case oid.T_bool:
+		return binaryDecodeBool(s)
+	case oid.T_date, oid.T_timestamp, oid.T_timestamptz:
+		return binaryDecodeTimestamp(parameterStatus, s, typ)
+	case oid.T_time:
+		return binaryDecodeTime(s)
+	case oid.T_interval:
+		return binaryDecodeInterval(s)
+	case oid.T_numeric:
+		return binaryDecodeNumeric(s)
+	case oid.T__bool, oid.T__int2, oid.T__int4, oid.T__int8, oid.T__float4,
+		oid.T__float8, oid.T__numeric, oid.T__date, oid.T__time,
+		oid.T__timestamp, oid.T__timestamptz, oid.T__interval:
+		return binaryDecodeArray(parameterStatus, s)
 
 	default:
 		return nil, fmt.Errorf("don't know how to decode binary parameter of type %d", uint32(typ))
@@ -201,6 +232,12 @@ func appendEncodedText(parameterStatus *parameterStatus, buf []byte, x interface
 		return strconv.AppendBool(buf, v), nil
 	case time.Time:
 		return append(buf, formatTs(v)...), nil
+	case decimalDecompose:
+		s, err := decimalText(v)
+		if err != nil {
+			return nil, err
+		}
+		return append(buf, s...), nil
 	case nil:
 		return append(buf, "\\N"...), nil
 	default:
@@ -359,9 +359,25 @@ type Error struct {
 	Line             string
 	Routine          string
 	err              error
+
+	// switchover is set when the error made the driver detect a switchover
+	// of the primary, see checkSwitchoverError.
+	switchover bool
 }
 
 func parseError(r *readBuf, cn *conn) *Error { // TODO: return error
+	err := parseErrorFields(r, cn)
+	cn.checkSwitchoverError(err)
+	return err
+}
+
+// parseNotice parses a NoticeResponse, which has the fields of an
+// ErrorResponse.
+func parseNotice(r *readBuf, cn *conn) *Error {
+	return parseErrorFields(r, cn)
+}
+
+func parseErrorFields(r *readBuf, cn *conn) *Error {
 	err := new(Error)
 	var cl_refresh_params *CLRefreshParams
 	var client_logic *PGClientLogic
@@ -429,7 +445,7 @@ func parseError(r *readBuf, cn *conn) *Error { // TODO: return error
 		case 't':
 			err.Table = msg
 		case 'c':
-			if msg == "26913" { // error msg from db when cn is shutting down
+			if msg == internalCodeCNShutdown {
 				err.err = driver.ErrBadConn
 			}
 			err.Column = msg
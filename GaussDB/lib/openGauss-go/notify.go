@@ -105,9 +105,12 @@ func newDialListenerConn(_ Dialer, name string, c chan<- *Notification) (*Listen
 	if err != nil {
 		return nil, err
 	}
+	return newListenerConn(cn.(*conn), c), nil
+}
 
+func newListenerConn(cn *conn, c chan<- *Notification) *ListenerConn {
 	l := &ListenerConn{
-		cn:               cn.(*conn),
+		cn:               cn,
 		notificationChan: c,
 		connState:        connStateIdle,
 		replyChan:        make(chan message, 2),
@@ -115,7 +118,7 @@ func newDialListenerConn(_ Dialer, name string, c chan<- *Notification) (*Listen
 
 	go l.listenerConnMain()
 
-	return l, nil
+	return l
 }
 
 // We can only allow one goroutine at a time to be running a query on the
@@ -215,7 +218,7 @@ func (l *ListenerConn) listenerConnLoop() (err error) {
 			// ignore
 		case 'N':
 			if n := l.cn.noticeHandler; n != nil {
-				n(parseError(r, l.cn))
+				n(parseNotice(r, l.cn))
 			}
 		default:
 			return fmt.Errorf("unexpected message %q from server in listenerConnLoop", t)
@@ -676,12 +679,31 @@ func (l *Listener) disconnectCleanup() error {
 // Synchronize the list of channels we want to be listening on with the server
 // after the connection has been established.
 func (l *Listener) resync(cn *ListenerConn, notificationChan <-chan *Notification) error {
+	channels := make([]string, 0, len(l.channels))
+	for channel := range l.channels {
+		channels = append(channels, channel)
+	}
+	return resyncListenerConn(cn, notificationChan, channels, nil)
+}
+
+// resyncListenerConn issues a LISTEN for every channel of listen, then an
+// UNLISTEN for every channel of unlisten, on a freshly established
+// ListenerConn.
+func resyncListenerConn(cn *ListenerConn, notificationChan <-chan *Notification, listen, unlisten []string) error {
+	queries := make([]string, 0, len(listen)+len(unlisten))
+	for _, channel := range listen {
+		queries = append(queries, "LISTEN "+QuoteIdentifier(channel))
+	}
+	for _, channel := range unlisten {
+		queries = append(queries, "UNLISTEN "+QuoteIdentifier(channel))
+	}
+
 	doneChan := make(chan error)
 	go func(notificationChan <-chan *Notification) {
-		for channel := range l.channels {
+		for _, q := range queries {
 			// If we got a response, return that error to our caller as it's
 			// going to be more descriptive than cn.Err().
-			gotResponse, err := cn.Listen(channel)
+			gotResponse, err := cn.ExecSimpleQuery(q)
 			if gotResponse && err != nil {
 				doneChan <- err
 				return
@@ -0,0 +1,468 @@
+package pq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var errSubscriberClosed = errors.New("pq: Subscriber has been closed")
+
+// DefaultSubscriptionBufferSize is the capacity of a subscription channel
+// when SubscriptionOptions.BufferSize is not set.
+const DefaultSubscriptionBufferSize = 32
+
+// OverflowPolicy decides what a Subscriber does with a notification for a
+// subscription whose channel is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until the subscriber receives from its channel.
+	// While it waits no other notification is dispatched, so a slow
+	// subscriber eventually holds back the server connection.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropNewest discards the notification that does not fit.
+	OverflowDropNewest
+
+	// OverflowDropOldest discards the oldest buffered notification to make
+	// room for the new one.
+	OverflowDropOldest
+)
+
+// SubscriptionOptions controls a single subscription.
+type SubscriptionOptions struct {
+	// BufferSize is the capacity of the subscription channel.  Zero means
+	// DefaultSubscriptionBufferSize.
+	BufferSize int
+	// Overflow is applied when the subscription channel is full.
+	Overflow OverflowPolicy
+}
+
+type subscription struct {
+	c        chan *Notification
+	done     chan struct{}
+	overflow OverflowPolicy
+}
+
+// deliver sends n on the subscription channel according to its overflow
+// policy.  Only the dispatching goroutine sends on the channel.
+func (sub *subscription) deliver(n *Notification) {
+	switch sub.overflow {
+	case OverflowDropNewest:
+		select {
+		case sub.c <- n:
+		default:
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case sub.c <- n:
+				return
+			default:
+			}
+			select {
+			case <-sub.c:
+			default:
+			}
+		}
+	default:
+		select {
+		case sub.c <- n:
+		case <-sub.done:
+		}
+	}
+}
+
+// Subscriber fans out notifications from a dedicated LISTEN connection to one
+// Go channel per notification channel.
+//
+// The connection is opened through a Connector, so in distributed mode every
+// (re)connection is balanced over the coordinator nodes known to the
+// Connector.  After the connection has been lost the Subscriber reconnects
+// and issues LISTEN again for every subscription; as notifications might have
+// been lost meanwhile, a nil *Notification is then delivered to every
+// subscription.
+//
+// Subscriber can safely be used from concurrently running goroutines.
+type Subscriber struct {
+	connector            *Connector
+	minReconnectInterval time.Duration
+	maxReconnectInterval time.Duration
+	eventCallback        EventCallbackType
+
+	lock     sync.Mutex
+	isClosed bool
+	cn       *ListenerConn
+	subs     map[string]*subscription
+
+	// held by the dispatching goroutine while delivering a notification, so
+	// that subscription channels are never closed while being sent on
+	dispatchLock sync.Mutex
+
+	// held while a subscription is added, and while UNLISTEN is issued for
+	// subscriptions removed without one (a cancelled Listen, UnlistenAll),
+	// so that the UNLISTEN cannot drop the LISTEN of a newer subscription.
+	// It is not s.lock, which the dispatching goroutine needs to keep
+	// reading the responses of the connection.
+	unlistenLock sync.Mutex
+}
+
+// NewSubscriber creates a Subscriber which opens its connection with c.  The
+// reconnect intervals and the event callback have the same meaning as for
+// NewListener.
+func NewSubscriber(c *Connector,
+	minReconnectInterval time.Duration,
+	maxReconnectInterval time.Duration,
+	eventCallback EventCallbackType) *Subscriber {
+
+	s := &Subscriber{
+		connector:            c,
+		minReconnectInterval: minReconnectInterval,
+		maxReconnectInterval: maxReconnectInterval,
+		eventCallback:        eventCallback,
+		subs:                 make(map[string]*subscription),
+	}
+
+	go s.subscriberMain()
+
+	return s
+}
+
+// Listen subscribes to a notification channel and returns the Go channel its
+// notifications are delivered on.  opts may be nil to use the defaults.
+//
+// If the Subscriber is connected, Listen waits for the server to acknowledge
+// the LISTEN, or for ctx to be done, in which case the subscription is
+// removed again.  Otherwise the LISTEN is issued once the connection has
+// been (re-)established.
+//
+// The returned channel is closed by Unlisten, UnlistenAll and Close.  The
+// channel name is case-sensitive.
+func (s *Subscriber) Listen(ctx context.Context, channel string, opts *SubscriptionOptions) (<-chan *Notification, error) {
+	if opts == nil {
+		opts = &SubscriptionOptions{}
+	}
+	size := opts.BufferSize
+	if size <= 0 {
+		size = DefaultSubscriptionBufferSize
+	}
+
+	s.unlistenLock.Lock()
+	s.lock.Lock()
+	if s.isClosed {
+		s.lock.Unlock()
+		s.unlistenLock.Unlock()
+		return nil, errSubscriberClosed
+	}
+	if _, exists := s.subs[channel]; exists {
+		s.lock.Unlock()
+		s.unlistenLock.Unlock()
+		return nil, ErrChannelAlreadyOpen
+	}
+	sub := &subscription{
+		c:        make(chan *Notification, size),
+		done:     make(chan struct{}),
+		overflow: opts.Overflow,
+	}
+	s.subs[channel] = sub
+	cn := s.cn
+	s.lock.Unlock()
+	s.unlistenLock.Unlock()
+
+	if cn == nil {
+		return sub.c, nil
+	}
+
+	type listenResult struct {
+		gotResponse bool
+		err         error
+	}
+	resultChan := make(chan listenResult, 1)
+	go func() {
+		gotResponse, err := cn.Listen(channel)
+		resultChan <- listenResult{gotResponse, err}
+	}()
+
+	select {
+	case r := <-resultChan:
+		// As for Listener.Listen, only errors returned by the server are
+		// reported; a lost connection is taken care of by the resync.
+		if r.gotResponse && r.err != nil {
+			s.remove(channel, sub)
+			return nil, r.err
+		}
+		return sub.c, nil
+	case <-ctx.Done():
+		s.remove(channel, sub)
+		// The LISTEN cannot be taken back before the server has answered
+		// it.  Only UNLISTEN if the channel has not been subscribed to
+		// again meanwhile.
+		go func() {
+			if r := <-resultChan; r.err != nil {
+				return
+			}
+			s.unlistenLock.Lock()
+			defer s.unlistenLock.Unlock()
+			s.lock.Lock()
+			_, resubscribed := s.subs[channel]
+			s.lock.Unlock()
+			if !resubscribed {
+				_, _ = cn.Unlisten(channel)
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// Unlisten removes the subscription to a notification channel and closes its
+// Go channel.  Returns ErrChannelNotOpen if there is no such subscription.
+func (s *Subscriber) Unlisten(channel string) error {
+	s.lock.Lock()
+	if s.isClosed {
+		s.lock.Unlock()
+		return errSubscriberClosed
+	}
+	sub, exists := s.subs[channel]
+	if !exists {
+		s.lock.Unlock()
+		return ErrChannelNotOpen
+	}
+	cn := s.cn
+	s.lock.Unlock()
+
+	if cn != nil {
+		gotResponse, err := cn.Unlisten(channel)
+		if gotResponse && err != nil {
+			return err
+		}
+	}
+	s.remove(channel, sub)
+	return nil
+}
+
+// UnlistenAll removes every subscription and closes their Go channels.
+func (s *Subscriber) UnlistenAll() error {
+	// subscriptions added after the UNLISTEN * must not be removed
+	s.unlistenLock.Lock()
+	defer s.unlistenLock.Unlock()
+
+	s.lock.Lock()
+	if s.isClosed {
+		s.lock.Unlock()
+		return errSubscriberClosed
+	}
+	cn := s.cn
+	s.lock.Unlock()
+
+	if cn != nil {
+		gotResponse, err := cn.UnlistenAll()
+		if gotResponse && err != nil {
+			return err
+		}
+	}
+
+	s.lock.Lock()
+	subs := s.subs
+	s.subs = make(map[string]*subscription)
+	s.lock.Unlock()
+	s.closeSubscriptions(subs)
+	return nil
+}
+
+// Close disconnects the Subscriber from the database, shuts it down and
+// closes the Go channels of every subscription.
+func (s *Subscriber) Close() error {
+	s.lock.Lock()
+	if s.isClosed {
+		s.lock.Unlock()
+		return errSubscriberClosed
+	}
+	s.isClosed = true
+	if s.cn != nil {
+		s.cn.Close()
+	}
+	subs := s.subs
+	s.subs = make(map[string]*subscription)
+	s.lock.Unlock()
+
+	s.closeSubscriptions(subs)
+	return nil
+}
+
+// remove drops sub if it is still the subscription registered for channel and
+// closes its Go channel.
+func (s *Subscriber) remove(channel string, sub *subscription) {
+	s.lock.Lock()
+	if s.subs[channel] != sub {
+		s.lock.Unlock()
+		return
+	}
+	delete(s.subs, channel)
+	s.lock.Unlock()
+
+	s.closeSubscriptions(map[string]*subscription{channel: sub})
+}
+
+func (s *Subscriber) closeSubscriptions(subs map[string]*subscription) {
+	// wake up a dispatcher blocked on one of these subscriptions before
+	// waiting for it to finish
+	for _, sub := range subs {
+		close(sub.done)
+	}
+	s.dispatchLock.Lock()
+	for _, sub := range subs {
+		close(sub.c)
+	}
+	s.dispatchLock.Unlock()
+}
+
+func (s *Subscriber) closed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.isClosed
+}
+
+func (s *Subscriber) emitEvent(event ListenerEventType, err error) {
+	if s.eventCallback != nil {
+		s.eventCallback(event, err)
+	}
+}
+
+// connect opens a connection and LISTENs for every subscription.  s.lock is
+// not held while waiting for the server, so subscriptions can be added and
+// removed meanwhile; connect catches up with them before making the
+// connection the current one.
+func (s *Subscriber) connect() (<-chan *Notification, error) {
+	cn, err := s.connector.open(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	notificationChan := make(chan *Notification, 32)
+	lc := newListenerConn(cn, notificationChan)
+
+	listening := make(map[string]bool)
+	for {
+		s.lock.Lock()
+		if s.isClosed {
+			s.lock.Unlock()
+			lc.Close()
+			return nil, errSubscriberClosed
+		}
+		var listen, unlisten []string
+		for channel := range s.subs {
+			if !listening[channel] {
+				listen = append(listen, channel)
+			}
+		}
+		for channel := range listening {
+			if _, ok := s.subs[channel]; !ok {
+				unlisten = append(unlisten, channel)
+			}
+		}
+		if len(listen) == 0 && len(unlisten) == 0 {
+			s.cn = lc
+			s.lock.Unlock()
+			return notificationChan, nil
+		}
+		s.lock.Unlock()
+
+		if err = resyncListenerConn(lc, notificationChan, listen, unlisten); err != nil {
+			lc.Close()
+			return nil, err
+		}
+		for _, channel := range listen {
+			listening[channel] = true
+		}
+		for _, channel := range unlisten {
+			delete(listening, channel)
+		}
+	}
+}
+
+// dispatch delivers n to the subscription of its channel, or a nil
+// notification to every subscription when n is nil.
+func (s *Subscriber) dispatch(n *Notification) {
+	s.dispatchLock.Lock()
+	defer s.dispatchLock.Unlock()
+
+	s.lock.Lock()
+	var subs []*subscription
+	if n == nil {
+		for _, sub := range s.subs {
+			subs = append(subs, sub)
+		}
+	} else if sub, ok := s.subs[n.Channel]; ok {
+		subs = append(subs, sub)
+	}
+	s.lock.Unlock()
+
+	for _, sub := range subs {
+		select {
+		case <-sub.done:
+			// removed since it was looked up
+		default:
+			sub.deliver(n)
+		}
+	}
+}
+
+// Main logic here: maintain a connection to the server when possible, dispatch
+// notifications and emit events.
+func (s *Subscriber) subscriberMain() {
+	var nextReconnect time.Time
+
+	reconnectInterval := s.minReconnectInterval
+	for {
+		var (
+			notificationChan <-chan *Notification
+			err              error
+		)
+		for {
+			notificationChan, err = s.connect()
+			if err == nil {
+				break
+			}
+
+			if s.closed() {
+				return
+			}
+			s.emitEvent(ListenerEventConnectionAttemptFailed, err)
+
+			time.Sleep(reconnectInterval)
+			reconnectInterval *= 2
+			if reconnectInterval > s.maxReconnectInterval {
+				reconnectInterval = s.maxReconnectInterval
+			}
+		}
+
+		if nextReconnect.IsZero() {
+			s.emitEvent(ListenerEventConnected, nil)
+		} else {
+			s.emitEvent(ListenerEventReconnected, nil)
+			s.dispatch(nil)
+		}
+
+		reconnectInterval = s.minReconnectInterval
+		nextReconnect = time.Now().Add(reconnectInterval)
+
+		for n := range notificationChan {
+			s.dispatch(n)
+		}
+
+		s.lock.Lock()
+		err = s.cn.Err()
+		s.cn.Close()
+		s.cn = nil
+		s.lock.Unlock()
+
+		if s.closed() {
+			return
+		}
+		s.emitEvent(ListenerEventDisconnected, err)
+
+		time.Sleep(time.Until(nextReconnect))
+	}
+}
@@ -0,0 +1,239 @@
+package pq
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+// listenScript answers LISTEN and UNLISTEN for every channel, after the
+// rules of script.
+func listenScript(script *pqtest.Script) *pqtest.Script {
+	return script.
+		OnPrefix("LISTEN ", &pqtest.Result{Tag: "LISTEN"}).
+		OnPrefix("UNLISTEN ", &pqtest.Result{Tag: "UNLISTEN"})
+}
+
+// openTestSubscriber starts a pqtest server answering with h and a
+// Subscriber connected to it, whose events are sent on the returned
+// channel.
+func openTestSubscriber(t *testing.T, h pqtest.Handler) (*pqtest.Server, *Subscriber, <-chan ListenerEventType, func()) {
+	t.Helper()
+	srv := pqtest.NewServer(h)
+	c, err := NewConnector(srv.DSN())
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	events := make(chan ListenerEventType, 16)
+	s := NewSubscriber(c, 10*time.Millisecond, 100*time.Millisecond, func(ev ListenerEventType, err error) {
+		events <- ev
+	})
+	return srv, s, events, func() {
+		s.Close()
+		srv.Close()
+	}
+}
+
+func waitEvent(t *testing.T, events <-chan ListenerEventType, want ListenerEventType) {
+	t.Helper()
+	for {
+		select {
+		case ev := <-events:
+			if ev == want {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for event %d", want)
+		}
+	}
+}
+
+func receiveNotification(t *testing.T, c <-chan *Notification) *Notification {
+	t.Helper()
+	select {
+	case n, ok := <-c:
+		if !ok {
+			t.Fatal("subscription channel closed")
+		}
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a notification")
+	}
+	return nil
+}
+
+// waitReceived waits for the server to receive q.
+func waitReceived(t *testing.T, script *pqtest.Script, q string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if countReceived(script, q) > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server did not receive %s", q)
+}
+
+func countReceived(script *pqtest.Script, q string) int {
+	n := 0
+	for _, r := range script.Received() {
+		if r == q {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSubscriber(t *testing.T) {
+	script := listenScript(pqtest.NewScript().
+		On(`LISTEN "denied"`, &pqtest.Result{Err: pqtest.NewError("42501", "permission denied")}))
+	srv, s, events, done := openTestSubscriber(t, script)
+	defer done()
+	waitEvent(t, events, ListenerEventConnected)
+
+	ctx := context.Background()
+	jobs, err := s.Listen(ctx, "jobs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Listen(ctx, "jobs", nil); err != ErrChannelAlreadyOpen {
+		t.Fatalf("got error %v, want %v", err, ErrChannelAlreadyOpen)
+	}
+	if _, err := s.Listen(ctx, "denied", nil); err == nil {
+		t.Fatal("expected the error of the server")
+	}
+
+	srv.Notify("jobs", "1")
+	srv.Notify("other", "x")
+	srv.Notify("jobs", "2")
+	for _, want := range []string{"1", "2"} {
+		if n := receiveNotification(t, jobs); n == nil || n.Extra != want {
+			t.Fatalf("got notification %+v, want payload %q", n, want)
+		}
+	}
+
+	if err := s.Unlisten("jobs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-jobs; ok {
+		t.Fatal("subscription channel not closed by Unlisten")
+	}
+	if countReceived(script, `UNLISTEN "jobs"`) != 1 {
+		t.Fatalf("UNLISTEN not sent, received %q", script.Received())
+	}
+	if err := s.Unlisten("jobs"); err != ErrChannelNotOpen {
+		t.Fatalf("got error %v, want %v", err, ErrChannelNotOpen)
+	}
+}
+
+func TestSubscriberListenCanceled(t *testing.T) {
+	script := listenScript(pqtest.NewScript()).
+		Once(`LISTEN "jobs"`, &pqtest.Result{Tag: "LISTEN", Delay: 200 * time.Millisecond}).
+		Once(`LISTEN "other"`, &pqtest.Result{Tag: "LISTEN", Delay: 200 * time.Millisecond})
+	srv, s, events, done := openTestSubscriber(t, script)
+	defer done()
+	waitEvent(t, events, ListenerEventConnected)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.Listen(ctx, "jobs", nil); err != context.DeadlineExceeded {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	// subscribed again before the first LISTEN completed: its UNLISTEN must
+	// not drop the new subscription
+	jobs, err := s.Listen(context.Background(), "jobs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Listen(ctx, "other", nil); err != context.DeadlineExceeded {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	// not subscribed again: the LISTEN is taken back
+	waitReceived(t, script, `UNLISTEN "other"`)
+
+	if n := countReceived(script, `UNLISTEN "jobs"`); n != 0 {
+		t.Fatalf("cancelled Listen sent UNLISTEN for the new subscription")
+	}
+	srv.Notify("jobs", "1")
+	if n := receiveNotification(t, jobs); n == nil || n.Extra != "1" {
+		t.Fatalf("got notification %+v", n)
+	}
+}
+
+func TestSubscriberResync(t *testing.T) {
+	script := listenScript(pqtest.NewScript())
+	var (
+		lock      sync.Mutex
+		listens   int
+		resyncing = make(chan struct{})
+		release   = make(chan struct{})
+	)
+	// block the LISTEN of the resync after the first reconnection
+	h := pqtest.HandlerFunc(func(q *pqtest.Query) *pqtest.Result {
+		if q.SQL == `LISTEN "a"` {
+			lock.Lock()
+			listens++
+			n := listens
+			lock.Unlock()
+			if n == 2 {
+				close(resyncing)
+				<-release
+			}
+		}
+		return script.Handle(q)
+	})
+	srv, s, events, done := openTestSubscriber(t, h)
+	defer done()
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+	waitEvent(t, events, ListenerEventConnected)
+
+	if _, err := s.Listen(context.Background(), "a", nil); err != nil {
+		t.Fatal(err)
+	}
+	srv.CloseClientConnections()
+	<-resyncing
+
+	// subscriptions change while the subscriber is waiting for the server
+	listened := make(chan error, 1)
+	var b <-chan *Notification
+	go func() {
+		var err error
+		b, err = s.Listen(context.Background(), "b", nil)
+		if err == nil {
+			err = s.Unlisten("a")
+		}
+		listened <- err
+	}()
+	select {
+	case err := <-listened:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Listen blocked while the subscriber was reconnecting")
+	}
+	close(release)
+	waitEvent(t, events, ListenerEventReconnected)
+
+	if n := receiveNotification(t, b); n != nil {
+		t.Fatalf("got notification %+v, want nil after reconnecting", n)
+	}
+	if countReceived(script, `LISTEN "b"`) != 1 || countReceived(script, `UNLISTEN "a"`) != 1 {
+		t.Fatalf("subscriptions not synchronized, received %q", script.Received())
+	}
+	srv.Notify("b", "1")
+	if n := receiveNotification(t, b); n == nil || n.Extra != "1" {
+		t.Fatalf("got notification %+v", n)
+	}
+}
@@ -0,0 +1,250 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/oid"
+)
+
+// decimalDecompose is the interface database/sql accepts as a driver.Value
+// for decimal numbers.
+type decimalDecompose interface {
+	Decompose(buf []byte) (form byte, negative bool, coefficient []byte, exponent int32)
+}
+
+// The forms of decimalDecompose.
+const (
+	decimalFinite   byte = 0
+	decimalInfinite byte = 1
+	decimalNaN      byte = 2
+)
+
+// Numeric represents an exact numeric value that may be null.  Its value is
+// Int * 10^Exp, so the scale of the value is kept: 1.50 is stored as 150 and
+// -2.  Numeric implements the sql.Scanner interface so it can be used as a
+// scan destination, and the driver.Valuer interface.  Numeric parameters are
+// sent in binary format where the parameter is known to be numeric, and in
+// text format otherwise.
+//
+// Numeric also implements the Decompose and Compose methods database/sql uses
+// for decimal types.
+type Numeric struct {
+	Int   *big.Int
+	Exp   int32
+	NaN   bool
+	Valid bool // Valid is true if the value is not NULL
+}
+
+// ParseNumeric parses a numeric value in the text format of the server, such
+// as 123.4500, -1e-3 or NaN.
+func ParseNumeric(s string) (Numeric, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "NaN") {
+		return Numeric{NaN: true, Valid: true}, nil
+	}
+
+	mantissa, exp := s, int64(0)
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		mantissa = s[:i]
+		exp, err = strconv.ParseInt(s[i+1:], 10, 32)
+		if err != nil {
+			return Numeric{}, fmt.Errorf("pq: invalid numeric value %q", s)
+		}
+	}
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		exp -= int64(len(mantissa) - i - 1)
+		mantissa = mantissa[:i] + mantissa[i+1:]
+	}
+	digits := strings.TrimLeft(mantissa, "+-")
+	if digits == "" || len(mantissa)-len(digits) > 1 || strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }) >= 0 {
+		return Numeric{}, fmt.Errorf("pq: invalid numeric value %q", s)
+	}
+	if exp < -1<<31 || exp > 1<<31-1 {
+		return Numeric{}, fmt.Errorf("pq: numeric value %q out of range", s)
+	}
+
+	n, ok := new(big.Int).SetString(mantissa, 10)
+	if !ok {
+		return Numeric{}, fmt.Errorf("pq: invalid numeric value %q", s)
+	}
+	return Numeric{Int: n, Exp: int32(exp), Valid: true}, nil
+}
+
+// Scan implements the Scanner interface.
+func (n *Numeric) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		*n = Numeric{}
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		*n = Numeric{Int: big.NewInt(v), Valid: true}
+		return nil
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Errorf("pq: cannot convert %T to Numeric", value)
+	}
+	parsed, err := ParseNumeric(s)
+	if err != nil {
+		return err
+	}
+	*n = parsed
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (n Numeric) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n, nil
+}
+
+// CheckNamedValue implements the driver.NamedValueChecker interface.
+// database/sql passes values implementing Decompose to the driver without
+// calling their Value method, so a null Numeric is converted to NULL here.
+func (cn *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	switch v := nv.Value.(type) {
+	case Numeric:
+		nv.Value, _ = v.Value()
+		return nil
+	case *Numeric:
+		if v == nil {
+			nv.Value = nil
+			return nil
+		}
+		nv.Value, _ = v.Value()
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+// String returns the value in the text format of the server, or NULL.
+func (n Numeric) String() string {
+	switch {
+	case !n.Valid:
+		return "NULL"
+	case n.NaN:
+		return "NaN"
+	}
+	return string(appendDecimalText(nil, n.sign() < 0, n.abs().String(), n.Exp))
+}
+
+// Float64 returns the nearest float64 value, NaN for NaN and 0 for NULL.
+func (n Numeric) Float64() float64 {
+	if !n.Valid {
+		return 0
+	}
+	f, _ := strconv.ParseFloat(n.String(), 64)
+	return f
+}
+
+// Decompose returns the value as a coefficient and an exponent, as used by
+// database/sql for decimal types.  buf is used for the coefficient if it is
+// large enough.
+func (n Numeric) Decompose(buf []byte) (form byte, negative bool, coefficient []byte, exponent int32) {
+	if n.NaN {
+		return decimalNaN, false, nil, 0
+	}
+	coefficient = n.abs().Bytes()
+	if cap(buf) >= len(coefficient) {
+		coefficient = append(buf[:0], coefficient...)
+	}
+	return decimalFinite, n.sign() < 0, coefficient, n.Exp
+}
+
+// Compose sets the value from a coefficient and an exponent, as used by
+// database/sql for decimal types.
+func (n *Numeric) Compose(form byte, negative bool, coefficient []byte, exponent int32) error {
+	switch form {
+	case decimalFinite:
+		i := new(big.Int).SetBytes(coefficient)
+		if negative {
+			i.Neg(i)
+		}
+		*n = Numeric{Int: i, Exp: exponent, Valid: true}
+		return nil
+	case decimalNaN:
+		*n = Numeric{NaN: true, Valid: true}
+		return nil
+	case decimalInfinite:
+		return errors.New("pq: numeric does not support infinity")
+	default:
+		return fmt.Errorf("pq: unknown decimal form %d", form)
+	}
+}
+
+func (n Numeric) sign() int {
+	if n.Int == nil {
+		return 0
+	}
+	return n.Int.Sign()
+}
+
+func (n Numeric) abs() *big.Int {
+	if n.Int == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Abs(n.Int)
+}
+
+// decimalText returns the text format of a decimal value given to the driver.
+func decimalText(d decimalDecompose) ([]byte, error) {
+	form, negative, coefficient, exponent := d.Decompose(nil)
+	switch form {
+	case decimalFinite:
+		return appendDecimalText(nil, negative, new(big.Int).SetBytes(coefficient).String(), exponent), nil
+	case decimalNaN:
+		return []byte("NaN"), nil
+	default:
+		return nil, fmt.Errorf("pq: cannot encode decimal form %d as numeric", form)
+	}
+}
+
+// numericParamFormats returns the format codes to send args with, binary for
+// decimal values of numeric parameters, or nil if all are sent as text.
+func numericParamFormats(args []driver.Value, paramTyps []oid.Oid) []int {
+	var paramFormats []int
+	for i, x := range args {
+		if _, ok := x.(decimalDecompose); ok && i < len(paramTyps) && paramTyps[i] == oid.T_numeric {
+			if paramFormats == nil {
+				paramFormats = make([]int, len(args))
+			}
+			paramFormats[i] = 1
+		}
+	}
+	return paramFormats
+}
+
+// appendDecimalText appends digits * 10^exp in plain notation, with -exp
+// fractional digits when exp is negative.
+func appendDecimalText(buf []byte, negative bool, digits string, exp int32) []byte {
+	if negative && strings.Trim(digits, "0") != "" {
+		buf = append(buf, '-')
+	}
+	if exp >= 0 {
+		buf = append(buf, digits...)
+		if digits != "0" {
+			buf = append(buf, strings.Repeat("0", int(exp))...)
+		}
+		return buf
+	}
+	scale := int(-exp)
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	buf = append(buf, digits[:len(digits)-scale]...)
+	buf = append(buf, '.')
+	return append(buf, digits[len(digits)-scale:]...)
+}
@@ -0,0 +1,253 @@
+package pq
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sync"
+	"testing"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/oid"
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+// argRecorder answers "select $1" with a parameter of type paramType and
+// records the argument received.
+type argRecorder struct {
+	paramType oid.Oid
+
+	lock   sync.Mutex
+	arg    []byte
+	format int16
+}
+
+func (r *argRecorder) Handle(q *pqtest.Query) *pqtest.Result {
+	if q.SQL != "select $1" {
+		return &pqtest.Result{Err: pqtest.NewError("42601", "unexpected statement")}
+	}
+	res := &pqtest.Result{
+		Columns:    []pqtest.Column{{Name: "v", OID: uint32(oid.T_text)}},
+		ParamTypes: []uint32{uint32(r.paramType)},
+	}
+	if !q.Describe {
+		r.lock.Lock()
+		r.arg, r.format = q.Args[0], 0
+		if len(q.ArgFormats) > 0 {
+			r.format = q.ArgFormats[len(q.ArgFormats)-1]
+		}
+		r.lock.Unlock()
+		res.Rows = [][][]byte{pqtest.Row("ok")}
+	}
+	return res
+}
+
+func TestNumericParamFormat(t *testing.T) {
+	value, err := ParseNumeric("12.50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	numericBinary, err := appendNumericBinary(nil, "12.50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		options   string
+		prepare   bool
+		paramType oid.Oid
+		binary    bool
+	}{
+		{"", true, oid.T_numeric, true},
+		{"", true, oid.T_float8, false},
+		{"binary_parameters=yes", true, oid.T_numeric, true},
+		{"binary_parameters=yes", true, oid.T_float8, false},
+		{"binary_parameters=yes", true, oid.T_text, false},
+		// the parameter types of unprepared statements are not known
+		{"binary_parameters=yes", false, oid.T_numeric, false},
+	}
+	for _, tt := range tests {
+		name := fmt.Sprintf("%q prepare=%v %d", tt.options, tt.prepare, tt.paramType)
+		rec := &argRecorder{paramType: tt.paramType}
+		_, db, done := openTestDB(t, rec, withDSN(tt.options))
+
+		var got string
+		var err error
+		if tt.prepare {
+			var st *sql.Stmt
+			if st, err = db.Prepare("select $1"); err == nil {
+				err = st.QueryRow(value).Scan(&got)
+				st.Close()
+			}
+		} else {
+			err = db.QueryRow("select $1", value).Scan(&got)
+		}
+		done()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		rec.lock.Lock()
+		arg, format := rec.arg, rec.format
+		rec.lock.Unlock()
+		if tt.binary {
+			if format != 1 || string(arg) != string(numericBinary) {
+				t.Errorf("%s: got %v in format %d, want the binary numeric %v", name, arg, format, numericBinary)
+			}
+		} else if format != 0 || string(arg) != "12.50" {
+			t.Errorf("%s: got %q in format %d, want the text 12.50", name, arg, format)
+		}
+	}
+}
+
+func TestParseNumeric(t *testing.T) {
+	tests := []struct {
+		in   string
+		int  int64
+		exp  int32
+		nan  bool
+		text string
+	}{
+		{"123.4500", 1234500, -4, false, "123.4500"},
+		{"-0.001", -1, -3, false, "-0.001"},
+		{"+42", 42, 0, false, "42"},
+		{"-1e-3", -1, -3, false, "-0.001"},
+		{"15E2", 15, 2, false, "1500"},
+		{"0.00", 0, -2, false, "0.00"},
+		{" NaN ", 0, 0, true, "NaN"},
+	}
+	for _, tt := range tests {
+		n, err := ParseNumeric(tt.in)
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if !n.Valid || n.NaN != tt.nan || !tt.nan && (n.Int.Int64() != tt.int || n.Exp != tt.exp) {
+			t.Errorf("%q: got %+v, want %d * 10^%d", tt.in, n, tt.int, tt.exp)
+		}
+		if got := n.String(); got != tt.text {
+			t.Errorf("%q: String() = %q, want %q", tt.in, got, tt.text)
+		}
+	}
+
+	for _, in := range []string{"", "-", "1.2.3", "--1", "1e", "1e99999999999", "12a", "Infinity"} {
+		if n, err := ParseNumeric(in); err == nil {
+			t.Errorf("%q: got %v, want an error", in, n)
+		}
+	}
+}
+
+func TestNumericScan(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{nil, "NULL"},
+		{[]byte("-12.50"), "-12.50"},
+		{"7.0", "7.0"},
+		{int64(-3), "-3"},
+		{1.25, "1.25"},
+	}
+	for _, tt := range tests {
+		var n Numeric
+		if err := n.Scan(tt.in); err != nil {
+			t.Errorf("%#v: %v", tt.in, err)
+		} else if n.String() != tt.want {
+			t.Errorf("%#v: got %s, want %s", tt.in, n, tt.want)
+		}
+	}
+	var n Numeric
+	if err := n.Scan(true); err == nil {
+		t.Error("scanned a bool into a Numeric")
+	}
+	if err := n.Scan("abc"); err == nil {
+		t.Error("scanned an invalid value into a Numeric")
+	}
+}
+
+func TestNumericDecompose(t *testing.T) {
+	for _, in := range []string{"-123.4500", "0", "98765432109876543210.123456789", "NaN"} {
+		n, err := ParseNumeric(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back Numeric
+		if err := back.Compose(n.Decompose(nil)); err != nil {
+			t.Errorf("%s: %v", in, err)
+		} else if back.String() != in {
+			t.Errorf("%s: composed %s", in, back)
+		}
+		text, err := decimalText(n)
+		if err != nil || string(text) != in {
+			t.Errorf("%s: decimalText = %q, %v", in, text, err)
+		}
+	}
+	var n Numeric
+	if err := n.Compose(decimalInfinite, false, nil, 0); err == nil {
+		t.Error("composed an infinite Numeric")
+	}
+	if _, err := decimalText(infiniteDecimal{}); err == nil {
+		t.Error("encoded an infinite decimal")
+	}
+}
+
+type infiniteDecimal struct{}
+
+func (infiniteDecimal) Decompose(buf []byte) (byte, bool, []byte, int32) {
+	return decimalInfinite, false, nil, 0
+}
+
+func TestNumericColumn(t *testing.T) {
+	rec := &argRecorder{paramType: oid.T_numeric}
+	script := pqtest.NewScript().On("select amount", &pqtest.Result{
+		Columns: []pqtest.Column{{Name: "amount", OID: uint32(oid.T_numeric)}},
+		Rows:    [][][]byte{pqtest.Row("-1234.5600"), {nil}},
+	})
+	handler := pqtest.HandlerFunc(func(q *pqtest.Query) *pqtest.Result {
+		if q.SQL == "select $1" {
+			return rec.Handle(q)
+		}
+		return script.Handle(q)
+	})
+	_, db, done := openTestDB(t, handler)
+	defer done()
+
+	rows, err := db.Query("select amount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := types[0].ScanType(); got != reflect.TypeOf(Numeric{}) {
+		t.Errorf("scan type %v, want Numeric", got)
+	}
+	var got []Numeric
+	for rows.Next() {
+		var n Numeric
+		if err := rows.Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, n)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := Numeric{Int: big.NewInt(-12345600), Exp: -4, Valid: true}
+	if len(got) != 2 || got[0].String() != want.String() || got[0].Exp != want.Exp || got[1].Valid {
+		t.Errorf("got %v, want [%v NULL]", got, want)
+	}
+
+	// a null Numeric is sent as NULL
+	var s sql.NullString
+	if err := db.QueryRow("select $1", Numeric{}).Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	if rec.arg != nil {
+		t.Errorf("null Numeric sent as %q", rec.arg)
+	}
+}
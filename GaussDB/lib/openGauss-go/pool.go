@@ -0,0 +1,389 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var errPoolClosed = errors.New("pq: pool has been closed")
+
+// DefaultPoolMaxConns is the number of connections a Pool hands out at once
+// when PoolConfig.MaxConns is not set.
+const DefaultPoolMaxConns = 16
+
+// PoolConfig controls a Pool.
+type PoolConfig struct {
+	// MaxConns is the maximum number of connections acquired at the same
+	// time.  Zero means DefaultPoolMaxConns.
+	MaxConns int
+	// MaxIdlePerNode is the maximum number of idle connections kept per
+	// coordinator node.  Zero means MaxConns.
+	MaxIdlePerNode int
+	// MaxIdleTime closes connections which have been idle for longer.  Zero
+	// keeps idle connections until they are drained.
+	MaxIdleTime time.Duration
+	// DrainInterval is how often idle connections to coordinator nodes that
+	// disappeared from the CN list are closed.  Zero means the CN refresh
+	// interval of the Connector.
+	DrainInterval time.Duration
+}
+
+// PoolNodeStat describes the connections of a Pool to one coordinator node.
+type PoolNodeStat struct {
+	// Node is the address of the coordinator node, as host:port.
+	Node string
+	// Idle is the number of idle connections to the node.
+	Idle int
+	// Busy is the number of acquired connections to the node.
+	Busy int
+	// Draining is set once the node has disappeared from the CN list; its
+	// connections are closed instead of being reused.
+	Draining bool
+}
+
+type poolIdleConn struct {
+	cn        *conn
+	idleSince time.Time
+}
+
+type poolNode struct {
+	idle     []poolIdleConn
+	busy     int
+	draining bool
+}
+
+// Pool is a connection pool which knows which coordinator node every
+// connection is attached to.  Connections are opened through a Connector, so
+// new connections are balanced by its autoBalance policy.  Idle connections
+// are reused from the node with the fewest busy connections, and connections
+// to nodes that disappear from the refreshed CN list are drained.
+//
+// Pool is an alternative to the pooling of database/sql for applications
+// which need to control how connections are spread over coordinator nodes.
+type Pool struct {
+	connector *Connector
+	config    PoolConfig
+
+	// holds a token for every acquired connection
+	sem chan struct{}
+
+	lock     sync.Mutex
+	isClosed bool
+	nodes    map[string]*poolNode
+
+	done chan struct{}
+}
+
+// PoolConn is a connection acquired from a Pool.  It must be given back with
+// Release once it is no longer used.
+type PoolConn struct {
+	pool *Pool
+	cn   *conn
+	node string
+}
+
+// NewPool creates a Pool opening its connections with c.  cfg may be nil to
+// use the defaults.
+func NewPool(c *Connector, cfg *PoolConfig) *Pool {
+	config := PoolConfig{}
+	if cfg != nil {
+		config = *cfg
+	}
+	if config.MaxConns <= 0 {
+		config.MaxConns = DefaultPoolMaxConns
+	}
+	if config.MaxIdlePerNode <= 0 {
+		config.MaxIdlePerNode = config.MaxConns
+	}
+	if config.DrainInterval <= 0 {
+		config.DrainInterval = 10 * time.Second
+		if d, ok := c.dialer.(*distributeDialer); ok && d.refreshCNsIntervalSec > 0 {
+			config.DrainInterval = time.Duration(d.refreshCNsIntervalSec) * time.Second
+		}
+	}
+
+	p := &Pool{
+		connector: c,
+		config:    config,
+		sem:       make(chan struct{}, config.MaxConns),
+		nodes:     make(map[string]*poolNode),
+		done:      make(chan struct{}),
+	}
+
+	go p.maintain()
+
+	return p
+}
+
+// Acquire returns an idle connection, or opens a new one.  When MaxConns
+// connections are already acquired it waits until one is released or ctx is
+// done.
+func (p *Pool) Acquire(ctx context.Context) (*PoolConn, error) {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-p.done:
+		return nil, errPoolClosed
+	}
+
+	for {
+		node, cn, err := p.takeIdle()
+		if err != nil {
+			<-p.sem
+			return nil, err
+		}
+		if cn == nil {
+			break
+		}
+		// as database/sql does before reusing a connection; this also runs
+		// Config.ResetSessionQuery
+		if err := cn.ResetSession(ctx); err == nil {
+			return &PoolConn{pool: p, cn: cn, node: node}, nil
+		}
+		p.discard(node, cn)
+	}
+
+	cn, err := p.connector.open(ctx)
+	if err != nil && IsRetryable(err) && ctx.Err() == nil {
+		// e.g. the node picked was shutting down, the next dial may pick
+		// another one
+		p.connector.config.Log(ctx, LogLevelWarn, "pool retrying failed connection", map[string]interface{}{"error": err})
+		cn, err = p.connector.open(ctx)
+	}
+	if err != nil {
+		<-p.sem
+		return nil, err
+	}
+	node := cn.node()
+
+	p.lock.Lock()
+	if p.isClosed {
+		p.lock.Unlock()
+		_ = cn.Close()
+		<-p.sem
+		return nil, errPoolClosed
+	}
+	p.node(node).busy++
+	p.lock.Unlock()
+
+	p.connector.config.Log(ctx, LogLevelDebug,
+		fmt.Sprintf("pool opened connection to %v", node), map[string]interface{}{})
+	return &PoolConn{pool: p, cn: cn, node: node}, nil
+}
+
+// takeIdle pops an idle connection from the non-draining node with the
+// fewest busy connections and marks it busy.  It returns a nil conn if there
+// is no idle connection.
+func (p *Pool) takeIdle() (string, *conn, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.isClosed {
+		return "", nil, errPoolClosed
+	}
+
+	var (
+		best     string
+		bestNode *poolNode
+	)
+	for key, n := range p.nodes {
+		if n.draining || len(n.idle) == 0 {
+			continue
+		}
+		if bestNode == nil || n.busy < bestNode.busy {
+			best, bestNode = key, n
+		}
+	}
+	if bestNode == nil {
+		return "", nil, nil
+	}
+
+	// most recently used first, so that surplus connections age out
+	last := len(bestNode.idle) - 1
+	cn := bestNode.idle[last].cn
+	bestNode.idle = bestNode.idle[:last]
+	bestNode.busy++
+	return best, cn, nil
+}
+
+// discard closes an acquired connection which can not be reused.
+func (p *Pool) discard(node string, cn *conn) {
+	p.lock.Lock()
+	if n, ok := p.nodes[node]; ok {
+		n.busy--
+		p.forgetIfEmpty(node, n)
+	}
+	p.lock.Unlock()
+	_ = cn.Close()
+}
+
+func (p *Pool) node(key string) *poolNode {
+	n, ok := p.nodes[key]
+	if !ok {
+		n = &poolNode{}
+		p.nodes[key] = n
+	}
+	return n
+}
+
+// caller must be holding p.lock
+func (p *Pool) forgetIfEmpty(key string, n *poolNode) {
+	if n.busy == 0 && len(n.idle) == 0 {
+		delete(p.nodes, key)
+	}
+}
+
+// Conn returns the underlying driver connection.  It must not be used after
+// Release.
+func (pc *PoolConn) Conn() driver.Conn {
+	return pc.cn
+}
+
+// Node returns the address of the coordinator node the connection is
+// attached to, as host:port.
+func (pc *PoolConn) Node() string {
+	return pc.node
+}
+
+// Release gives the connection back to the pool.  Broken connections,
+// connections left in a transaction and connections to draining nodes are
+// closed instead of being kept idle.  The session of an idle connection is
+// reset when it is acquired again, see Config.ResetSessionQuery.
+func (pc *PoolConn) Release() {
+	p := pc.pool
+	if p == nil {
+		return
+	}
+	pc.pool = nil
+	defer func() { <-p.sem }()
+
+	cn := pc.cn
+	reusable := !cn.getBad() && !cn.inCopy && cn.txnStatus == txnStatusIdle
+
+	p.lock.Lock()
+	n := p.node(pc.node)
+	n.busy--
+	if reusable && !p.isClosed && !n.draining && len(n.idle) < p.config.MaxIdlePerNode {
+		n.idle = append(n.idle, poolIdleConn{cn: cn, idleSince: time.Now()})
+		p.lock.Unlock()
+		return
+	}
+	p.forgetIfEmpty(pc.node, n)
+	p.lock.Unlock()
+	_ = cn.Close()
+}
+
+// Stats returns the connection counts per coordinator node.
+func (p *Pool) Stats() []PoolNodeStat {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	stats := make([]PoolNodeStat, 0, len(p.nodes))
+	for key, n := range p.nodes {
+		stats = append(stats, PoolNodeStat{
+			Node:     key,
+			Idle:     len(n.idle),
+			Busy:     n.busy,
+			Draining: n.draining,
+		})
+	}
+	return stats
+}
+
+// Close closes the idle connections and shuts the pool down.  Acquired
+// connections are closed when they are released.
+func (p *Pool) Close() error {
+	p.lock.Lock()
+	if p.isClosed {
+		p.lock.Unlock()
+		return errPoolClosed
+	}
+	p.isClosed = true
+	close(p.done)
+	var idle []*conn
+	for key, n := range p.nodes {
+		for _, ic := range n.idle {
+			idle = append(idle, ic.cn)
+		}
+		n.idle = nil
+		p.forgetIfEmpty(key, n)
+	}
+	p.lock.Unlock()
+
+	for _, cn := range idle {
+		_ = cn.Close()
+	}
+	return nil
+}
+
+func (p *Pool) maintain() {
+	t := time.NewTicker(p.config.DrainInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+			p.drain()
+		}
+	}
+}
+
+// drain marks the nodes that are no longer in the CN list of the Connector as
+// draining, and closes their idle connections as well as the connections
+// idle for longer than MaxIdleTime.
+func (p *Pool) drain() {
+	var active map[string]struct{}
+	if d, ok := p.connector.dialer.(*distributeDialer); ok {
+		if cns := d.withoutEvicted(d.deepCopyCns()); len(cns) > 0 {
+			active = make(map[string]struct{}, len(cns))
+			for _, cNode := range cns {
+				active[net.JoinHostPort(cNode.ip, strconv.Itoa(int(cNode.port)))] = struct{}{}
+			}
+		}
+	}
+
+	var closing []*conn
+	now := time.Now()
+	p.lock.Lock()
+	for key, n := range p.nodes {
+		if active != nil {
+			_, ok := active[key]
+			if !ok && !n.draining {
+				p.connector.config.Log(context.Background(), LogLevelInfo,
+					fmt.Sprintf("pool draining connections to removed CN %v", key), map[string]interface{}{})
+			}
+			n.draining = !ok
+		}
+		kept := n.idle[:0]
+		for _, ic := range n.idle {
+			if n.draining || (p.config.MaxIdleTime > 0 && now.Sub(ic.idleSince) > p.config.MaxIdleTime) {
+				closing = append(closing, ic.cn)
+				continue
+			}
+			kept = append(kept, ic)
+		}
+		n.idle = kept
+		p.forgetIfEmpty(key, n)
+	}
+	p.lock.Unlock()
+
+	for _, cn := range closing {
+		_ = cn.Close()
+	}
+}
+
+// node returns the address of the server cn is connected to, as host:port.
+func (cn *conn) node() string {
+	if cn.fallbackConfig == nil {
+		return ""
+	}
+	return net.JoinHostPort(cn.fallbackConfig.Host, strconv.Itoa(int(cn.fallbackConfig.Port)))
+}
@@ -0,0 +1,167 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+// openTestPool starts a pqtest server answering with h and a Pool connected
+// to it.  options are appended to the DSN.
+func openTestPool(t *testing.T, h pqtest.Handler, options string, cfg *PoolConfig) (*pqtest.Server, *Pool, func()) {
+	t.Helper()
+	srv := pqtest.NewServer(h)
+	c, err := NewConnector(srv.DSN() + " " + options)
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	p := NewPool(c, cfg)
+	return srv, p, func() {
+		p.Close()
+		srv.Close()
+	}
+}
+
+func poolExec(t *testing.T, pc *PoolConn, query string) error {
+	t.Helper()
+	_, err := pc.Conn().(driver.ExecerContext).ExecContext(context.Background(), query, nil)
+	return err
+}
+
+func TestPoolReuse(t *testing.T) {
+	_, p, done := openTestPool(t, pqtest.NewScript(), "", nil)
+	defer done()
+
+	ctx := context.Background()
+	pc, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := pc.Conn().(*conn).processID
+	stats := p.Stats()
+	if len(stats) != 1 || stats[0].Busy != 1 || stats[0].Idle != 0 || stats[0].Node != pc.Node() {
+		t.Fatalf("got stats %+v", stats)
+	}
+	pc.Release()
+	pc.Release() // no-op
+
+	stats = p.Stats()
+	if len(stats) != 1 || stats[0].Busy != 0 || stats[0].Idle != 1 {
+		t.Fatalf("got stats %+v after Release", stats)
+	}
+	pc, err = p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Release()
+	if got := pc.Conn().(*conn).processID; got != pid {
+		t.Fatal("idle connection was not reused")
+	}
+}
+
+func TestPoolMaxConns(t *testing.T) {
+	_, p, done := openTestPool(t, pqtest.NewScript(), "", &PoolConfig{MaxConns: 1})
+	defer done()
+
+	pc, err := p.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	pc.Release()
+
+	if pc, err = p.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	pc.Release()
+	p.Close()
+	if _, err := p.Acquire(context.Background()); err != errPoolClosed {
+		t.Fatalf("got error %v, want %v", err, errPoolClosed)
+	}
+}
+
+func TestPoolReleaseNotReusable(t *testing.T) {
+	script := pqtest.NewScript().On("lost", &pqtest.Result{Drop: true})
+	_, p, done := openTestPool(t, script, "", nil)
+	defer done()
+
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		use  func(pc *PoolConn)
+	}{
+		{"in transaction", func(pc *PoolConn) {
+			if err := poolExec(t, pc, "BEGIN"); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"broken", func(pc *PoolConn) {
+			if err := poolExec(t, pc, "lost"); err == nil {
+				t.Fatal("expected an error")
+			}
+		}},
+	}
+	for _, tt := range tests {
+		pc, err := p.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.use(pc)
+		pc.Release()
+		if stats := p.Stats(); len(stats) != 0 {
+			t.Errorf("%s: connection kept, stats %+v", tt.name, stats)
+		}
+	}
+}
+
+func TestPoolResetSession(t *testing.T) {
+	script := pqtest.NewScript().
+		On("SET search_path TO app", &pqtest.Result{Tag: "SET"}).
+		On("DISCARD ALL", &pqtest.Result{Tag: "DISCARD ALL"}).
+		OnPrefix("SELECT set_config(", &pqtest.Result{Columns: []pqtest.Column{{Name: "set_config", OID: 25}}}).
+		On("select 1", int4Result("?column?", 1))
+	_, p, done := openTestPool(t, script, "reset_session_query='DISCARD ALL'", nil)
+	defer done()
+
+	ctx := context.Background()
+	pc, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := pc.Conn().(*conn).processID
+	if err := poolExec(t, pc, "SET search_path TO app"); err != nil {
+		t.Fatal(err)
+	}
+	pc.Release()
+
+	pc, err = p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pc.Conn().(*conn).processID; got != pid {
+		t.Fatalf("idle connection was not reused, received %q", script.Received())
+	}
+	if countReceived(script, "DISCARD ALL") != 1 {
+		t.Fatalf("session not reset, received %q", script.Received())
+	}
+	// an unchanged session is not reset
+	if err := poolExec(t, pc, "select 1"); err != nil {
+		t.Fatal(err)
+	}
+	pc.Release()
+	if pc, err = p.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	pc.Release()
+	if countReceived(script, "DISCARD ALL") != 1 {
+		t.Fatalf("unchanged session reset, received %q", script.Received())
+	}
+}
@@ -0,0 +1,175 @@
+package pqtest
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// postgresEpoch is the origin of binary date and timestamp values.
+var postgresEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	timestampLayouts = []string{
+		"2006-01-02 15:04:05.999999999-07:00:00",
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02 15:04:05.999999999-07",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999Z07:00",
+		"2006-01-02",
+	}
+	timeLayouts = []string{"15:04:05.999999999"}
+)
+
+func encodeFloat(typ uint32, v []byte) ([]byte, bool) {
+	f, err := strconv.ParseFloat(string(v), 64)
+	if err != nil {
+		return nil, false
+	}
+	if typ == 700 {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, math.Float32bits(float32(f)))
+		return b, true
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, math.Float64bits(f))
+	return b, true
+}
+
+func encodeBool(v []byte) ([]byte, bool) {
+	switch strings.ToLower(string(v)) {
+	case "t", "true":
+		return []byte{1}, true
+	case "f", "false":
+		return []byte{0}, true
+	}
+	return nil, false
+}
+
+// encodeTimestamp encodes date, time, timestamp and timestamptz values.
+// Values without a time zone are taken as UTC.
+func encodeTimestamp(typ uint32, v []byte) ([]byte, bool) {
+	s := string(v)
+	switch s {
+	case "infinity":
+		if typ == 1082 {
+			return int32Bytes(math.MaxInt32), true
+		}
+		return int64Bytes(math.MaxInt64), true
+	case "-infinity":
+		if typ == 1082 {
+			return int32Bytes(math.MinInt32), true
+		}
+		return int64Bytes(math.MinInt64), true
+	}
+
+	layouts := timestampLayouts
+	if typ == 1083 {
+		layouts = timeLayouts
+	}
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			continue
+		}
+		switch typ {
+		case 1082: // date
+			days := t.Sub(postgresEpoch).Hours() / 24
+			return int32Bytes(int32(math.Floor(days))), true
+		case 1083: // time
+			d := t.Sub(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC))
+			return int64Bytes(int64(d / time.Microsecond)), true
+		}
+		micros := (t.Unix()-postgresEpoch.Unix())*1000000 + int64(t.Nanosecond()/1000)
+		return int64Bytes(micros), true
+	}
+	return nil, false
+}
+
+// encodeNumeric encodes a numeric value given in plain decimal notation.
+func encodeNumeric(v []byte) ([]byte, bool) {
+	s := string(v)
+	var sign uint16
+	switch s {
+	case "NaN":
+		return numericHeader(0, 0, 0xC000, 0), true
+	case "Infinity":
+		return numericHeader(0, 0, 0xD000, 0), true
+	case "-Infinity":
+		return numericHeader(0, 0, 0xF000, 0), true
+	}
+	if strings.HasPrefix(s, "-") {
+		sign = 0x4000
+		s = s[1:]
+	} else if strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	if intPart == "" && fracPart == "" {
+		return nil, false
+	}
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return nil, false
+		}
+	}
+	dscale := len(fracPart)
+
+	// group the digits by four around the decimal point
+	if n := len(intPart) % 4; n != 0 {
+		intPart = strings.Repeat("0", 4-n) + intPart
+	}
+	if n := len(fracPart) % 4; n != 0 {
+		fracPart += strings.Repeat("0", 4-n)
+	}
+	all := intPart + fracPart
+	digits := make([]uint16, 0, len(all)/4)
+	for i := 0; i < len(all); i += 4 {
+		d, _ := strconv.Atoi(all[i : i+4])
+		digits = append(digits, uint16(d))
+	}
+	weight := len(intPart)/4 - 1
+	for len(digits) > 0 && digits[0] == 0 {
+		digits = digits[1:]
+		weight--
+	}
+	for len(digits) > 0 && digits[len(digits)-1] == 0 {
+		digits = digits[:len(digits)-1]
+	}
+	if len(digits) == 0 {
+		weight = 0
+		sign = 0
+	}
+
+	b := numericHeader(len(digits), weight, sign, dscale)
+	for _, d := range digits {
+		b = append(b, byte(d>>8), byte(d))
+	}
+	return b, true
+}
+
+func numericHeader(ndigits, weight int, sign uint16, dscale int) []byte {
+	b := make([]byte, 8, 8+2*ndigits)
+	binary.BigEndian.PutUint16(b, uint16(ndigits))
+	binary.BigEndian.PutUint16(b[2:], uint16(int16(weight)))
+	binary.BigEndian.PutUint16(b[4:], sign)
+	binary.BigEndian.PutUint16(b[6:], uint16(dscale))
+	return b
+}
+
+func int32Bytes(n int32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(n))
+	return b
+}
+
+func int64Bytes(n int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(n))
+	return b
+}
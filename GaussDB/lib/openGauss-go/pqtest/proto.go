@@ -0,0 +1,289 @@
+package pqtest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	sslRequestCode    = 80877103
+	gssEncRequestCode = 80877104
+	cancelRequestCode = 80877102
+
+	maxMessageLen = 1 << 30
+)
+
+var errMessageTooShort = errors.New("pqtest: message too short")
+
+// message is a frontend message: its type and its payload without the length.
+type message struct {
+	typ  byte
+	data []byte
+}
+
+func readMessage(r *bufio.Reader) (message, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return message{}, err
+	}
+	data, err := readPayload(r)
+	if err != nil {
+		return message{}, err
+	}
+	return message{typ: typ, data: data}, nil
+}
+
+// readPayload reads a length-prefixed payload, as sent by the startup packet
+// and after the type byte of every other message.
+func readPayload(r *bufio.Reader) ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := int(binary.BigEndian.Uint32(hdr[:])) - 4
+	if n < 0 || n > maxMessageLen {
+		return nil, fmt.Errorf("pqtest: invalid message length %d", n+4)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// reader decodes the fields of a frontend message.
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = errMessageTooShort
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) int16() int16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (r *reader) int32() int32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (r *reader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	for i, c := range r.data {
+		if c == 0 {
+			s := string(r.data[:i])
+			r.data = r.data[i+1:]
+			return s
+		}
+	}
+	r.err = errMessageTooShort
+	return ""
+}
+
+// writer encodes backend messages into one buffer, which is written to the
+// socket at once.
+type writer struct {
+	buf   []byte
+	start int
+}
+
+func (w *writer) begin(typ byte) {
+	w.buf = append(w.buf, typ, 0, 0, 0, 0)
+	w.start = len(w.buf) - 4
+}
+
+func (w *writer) end() {
+	binary.BigEndian.PutUint32(w.buf[w.start:], uint32(len(w.buf)-w.start))
+}
+
+func (w *writer) byte(b byte) {
+	w.buf = append(w.buf, b)
+}
+
+func (w *writer) int16(n int16) {
+	w.buf = append(w.buf, byte(n>>8), byte(n))
+}
+
+func (w *writer) int32(n int32) {
+	w.buf = append(w.buf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func (w *writer) string(s string) {
+	w.buf = append(w.buf, s...)
+	w.buf = append(w.buf, 0)
+}
+
+func (w *writer) bytes(b []byte) {
+	w.buf = append(w.buf, b...)
+}
+
+func (w *writer) authentication(code int32, data ...[]byte) {
+	w.begin('R')
+	w.int32(code)
+	for _, d := range data {
+		w.bytes(d)
+	}
+	w.end()
+}
+
+func (w *writer) parameterStatus(name, value string) {
+	w.begin('S')
+	w.string(name)
+	w.string(value)
+	w.end()
+}
+
+func (w *writer) backendKeyData(pid, secret int32) {
+	w.begin('K')
+	w.int32(pid)
+	w.int32(secret)
+	w.end()
+}
+
+func (w *writer) readyForQuery(status byte) {
+	w.begin('Z')
+	w.byte(status)
+	w.end()
+}
+
+func (w *writer) errorResponse(typ byte, e *Error) {
+	w.begin(typ)
+	severity := e.Severity
+	if severity == "" {
+		severity = "ERROR"
+	}
+	fields := []struct {
+		code  byte
+		value string
+	}{
+		{'S', severity},
+		{'C', e.Code},
+		{'M', e.Message},
+		{'D', e.Detail},
+		{'H', e.Hint},
+		{'c', e.InternalCode},
+	}
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		w.byte(f.code)
+		w.string(f.value)
+	}
+	w.byte(0)
+	w.end()
+}
+
+func (w *writer) rowDescription(cols []Column) {
+	w.begin('T')
+	w.int16(int16(len(cols)))
+	for _, c := range cols {
+		w.string(c.Name)
+		w.int32(0) // table OID
+		w.int16(0) // column number
+		w.int32(int32(c.OID))
+		size := c.Size
+		if size == 0 {
+			size = -1
+		}
+		w.int16(size)
+		w.int32(c.Modifier)
+		w.int16(0) // format, not known yet
+	}
+	w.end()
+}
+
+func (w *writer) parameterDescription(types []uint32) {
+	w.begin('t')
+	w.int16(int16(len(types)))
+	for _, t := range types {
+		w.int32(int32(t))
+	}
+	w.end()
+}
+
+func (w *writer) dataRow(values [][]byte) {
+	w.begin('D')
+	w.int16(int16(len(values)))
+	for _, v := range values {
+		if v == nil {
+			w.int32(-1)
+			continue
+		}
+		w.int32(int32(len(v)))
+		w.bytes(v)
+	}
+	w.end()
+}
+
+func (w *writer) commandComplete(tag string) {
+	w.begin('C')
+	w.string(tag)
+	w.end()
+}
+
+func (w *writer) copyResponse(typ byte, ncols int, binary bool) {
+	var format byte
+	if binary {
+		format = 1
+	}
+	w.begin(typ)
+	w.byte(format)
+	w.int16(int16(ncols))
+	for i := 0; i < ncols; i++ {
+		w.int16(int16(format))
+	}
+	w.end()
+}
+
+func (w *writer) copyData(data []byte) {
+	w.begin('d')
+	w.bytes(data)
+	w.end()
+}
+
+func (w *writer) notification(pid int32, n Notification) {
+	w.begin('A')
+	w.int32(pid)
+	w.string(n.Channel)
+	w.string(n.Payload)
+	w.end()
+}
+
+// empty writes a message without payload, such as ParseComplete.
+func (w *writer) empty(typ byte) {
+	w.begin(typ)
+	w.end()
+}
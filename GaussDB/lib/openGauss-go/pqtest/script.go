@@ -0,0 +1,256 @@
+package pqtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Column describes a result column.
+type Column struct {
+	Name string
+	// OID is the type OID of the column, e.g. 25 for text or 23 for int4.
+	OID      uint32
+	Size     int16
+	Modifier int32
+}
+
+// Error is sent to the client as an ErrorResponse, or as a NoticeResponse in
+// Result.Notices.
+type Error struct {
+	// Severity defaults to ERROR.  FATAL errors also close the connection.
+	Severity string
+	Code     string
+	Message  string
+	Detail   string
+	Hint     string
+	// InternalCode is sent as the 'c' field, which openGauss uses for its
+	// internal error code.
+	InternalCode string
+}
+
+// NewError returns an ERROR with the given SQLSTATE and message.
+func NewError(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// CNShutdownError returns the error a coordinator node reports while it is
+// shutting down, which makes the driver mark the connection bad.
+func CNShutdownError() *Error {
+	return &Error{
+		Code:         "57P01",
+		Message:      "terminating connection due to administrator command",
+		InternalCode: "26913",
+	}
+}
+
+// Notification is an asynchronous NOTIFY message.
+type Notification struct {
+	Channel string
+	Payload string
+}
+
+// Query is a statement received from the client.
+type Query struct {
+	// SQL is the statement text, with placeholders such as $1 for statements
+	// of the extended query protocol.
+	SQL string
+	// Args holds the bound parameter values, nil for NULL.  It is empty for
+	// the simple query protocol and for Describe.
+	Args [][]byte
+	// ArgFormats holds the format code of every argument, 0 for text and 1
+	// for binary.
+	ArgFormats []int16
+	// Describe is set when the client only asks for the parameter and row
+	// description of a statement being prepared.  Only the ParamTypes,
+	// Columns and Err fields of the Result are used then.
+	Describe bool
+	// Conn is the connection the statement was received on.
+	Conn *Conn
+}
+
+// Result is the response to a statement.
+type Result struct {
+	// Columns is sent as a RowDescription; nil for statements which do not
+	// return rows.
+	Columns []Column
+	// Rows holds the values of every row in text format, nil for NULL.
+	// Columns the client asks to receive in binary format are converted for
+	// bytea, int2, int4, int8, uuid, float4, float8, bool, numeric, date,
+	// time, timestamp and timestamptz; values of other types, such as
+	// intervals and arrays, must be given in binary format then and are sent
+	// unchanged.
+	Rows [][][]byte
+	// Tag is the command tag of CommandComplete, e.g. "INSERT 0 1".  It
+	// defaults to "SELECT n" for statements returning rows.
+	Tag string
+	// ParamTypes are the parameter type OIDs reported when the statement is
+	// prepared.  By default one unspecified type is reported per $n
+	// placeholder.
+	ParamTypes []uint32
+
+	// Err is sent instead of the result.
+	Err *Error
+	// Notices are sent before the result.
+	Notices []*Error
+	// ParameterStatus is sent before the result, like after SET.
+	ParameterStatus map[string]string
+	// Notifications are sent after the result.
+	Notifications []Notification
+
+	// CopyIn makes the statement a COPY FROM STDIN.  It is called with the
+	// data sent by the client once it has finished, and returns the result
+	// of the COPY, typically with a "COPY n" tag.
+	CopyIn func(data []byte) *Result
+	// CopyOut makes the statement a COPY TO STDOUT sending these CopyData
+	// messages.
+	CopyOut [][]byte
+	// CopyBinary reports the binary format in the CopyInResponse or
+	// CopyOutResponse, as the server does for COPY ... (FORMAT binary).
+	CopyBinary bool
+
+	// Delay postpones the response, to simulate a slow server.  A cancel
+	// request from the client ends the wait with a query_canceled error.
+	Delay time.Duration
+	// Drop closes the connection instead of responding.
+	Drop bool
+}
+
+// Row converts values to a row of Result.Rows.  Strings and byte slices are
+// used as they are, nil is NULL, booleans become t and f and anything else
+// is formatted with fmt.
+func Row(values ...interface{}) [][]byte {
+	row := make([][]byte, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+		case []byte:
+			row[i] = v
+		case string:
+			row[i] = []byte(v)
+		case bool:
+			if v {
+				row[i] = []byte("t")
+			} else {
+				row[i] = []byte("f")
+			}
+		default:
+			row[i] = []byte(fmt.Sprint(v))
+		}
+	}
+	return row
+}
+
+// Handler answers the statements received by a Server.
+type Handler interface {
+	Handle(q *Query) *Result
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(q *Query) *Result
+
+func (f HandlerFunc) Handle(q *Query) *Result {
+	return f(q)
+}
+
+type scriptRule struct {
+	sql    string
+	prefix bool
+	once   bool
+	result *Result
+}
+
+func (r *scriptRule) matches(sql string) bool {
+	if r.prefix {
+		return strings.HasPrefix(sql, r.sql)
+	}
+	return sql == r.sql
+}
+
+// Script is a Handler answering statements from a list of rules, matched
+// against the statement text with surrounding white space trimmed.  Rules
+// added with Once are used a single time and are tried first, in the order
+// they were added.  Transaction control statements matching no rule succeed;
+// other statements matching no rule get Default, or a syntax error if
+// Default is nil.
+//
+// Script can safely be used from concurrently running goroutines.
+type Script struct {
+	Default *Result
+
+	lock     sync.Mutex
+	rules    []*scriptRule
+	received []string
+}
+
+// NewScript returns an empty Script.
+func NewScript() *Script {
+	return &Script{}
+}
+
+// On answers every statement equal to sql with r.
+func (s *Script) On(sql string, r *Result) *Script {
+	return s.add(&scriptRule{sql: sql, result: r})
+}
+
+// OnPrefix answers every statement starting with prefix with r.
+func (s *Script) OnPrefix(prefix string, r *Result) *Script {
+	return s.add(&scriptRule{sql: prefix, prefix: true, result: r})
+}
+
+// Once answers the next statement equal to sql with r.
+func (s *Script) Once(sql string, r *Result) *Script {
+	return s.add(&scriptRule{sql: sql, once: true, result: r})
+}
+
+func (s *Script) add(rule *scriptRule) *Script {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.rules = append(s.rules, rule)
+	return s
+}
+
+// Received returns the statements executed so far, in order.  Statements
+// which were only described are not included.
+func (s *Script) Received() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string(nil), s.received...)
+}
+
+func (s *Script) Handle(q *Query) *Result {
+	sql := strings.TrimSpace(q.SQL)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !q.Describe {
+		s.received = append(s.received, sql)
+	}
+	var found *scriptRule
+	for i, rule := range s.rules {
+		if rule.once && rule.matches(sql) {
+			if !q.Describe {
+				s.rules = append(s.rules[:i:i], s.rules[i+1:]...)
+			}
+			return rule.result
+		}
+		if found == nil && !rule.once && rule.matches(sql) {
+			found = rule
+		}
+	}
+	if found != nil {
+		return found.result
+	}
+	switch strings.ToUpper(firstWord(sql)) {
+	case "BEGIN", "START", "COMMIT", "END", "ROLLBACK", "ABORT", "SAVEPOINT", "RELEASE":
+		return &Result{}
+	}
+	if s.Default != nil {
+		return s.Default
+	}
+	return &Result{Err: NewError("42601", fmt.Sprintf("pqtest: unexpected statement %q", sql))}
+}
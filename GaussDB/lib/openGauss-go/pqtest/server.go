@@ -0,0 +1,1073 @@
+// Package pqtest provides an in-process server speaking the openGauss
+// frontend/backend protocol, to test the driver without a running database.
+//
+// A Server accepts connections on a local port, authenticates them with the
+// configured method and answers every statement through a Handler.  Script is
+// a Handler answering statements from a list of rules:
+//
+//	script := pqtest.NewScript().
+//		On("select 1", &pqtest.Result{
+//			Columns: []pqtest.Column{{Name: "?column?", OID: 23}},
+//			Rows:    [][][]byte{pqtest.Row(1)},
+//		})
+//	srv := pqtest.NewServer(script)
+//	defer srv.Close()
+//	db, err := sql.Open("opengauss", srv.DSN())
+//
+// Failures are injected with the Drop and Delay fields of a Result, with
+// CNShutdownError, with Server.OnConnect and with
+// Server.CloseClientConnections.
+package pqtest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// AuthMethod is the password authentication a Server asks for.
+type AuthMethod int
+
+const (
+	// AuthTrust accepts every client without a password.
+	AuthTrust AuthMethod = iota
+	// AuthCleartext asks for the password in clear text.
+	AuthCleartext
+	// AuthMD5 asks for the MD5 digest of the password.
+	AuthMD5
+	// AuthSHA256 runs the openGauss sha256 exchange, a SCRAM (RFC 5802)
+	// proof of the password.
+	AuthSHA256
+	// AuthMD5SHA256 runs the openGauss md5 exchange for sha256 stored
+	// passwords.
+	AuthMD5SHA256
+)
+
+// sha256Iteration is the PBKDF2 iteration count of the sha256 exchange.
+const sha256Iteration = 10000
+
+var errDropped = errors.New("pqtest: connection dropped")
+
+// Server is an in-process openGauss server.
+type Server struct {
+	// Handler answers the statements of every connection.
+	Handler Handler
+
+	// Auth is the authentication asked for.  User and Password are the
+	// credentials accepted; an empty User accepts any user name.
+	Auth     AuthMethod
+	User     string
+	Password string
+
+	// ParameterStatus is reported to every connection at startup, in
+	// addition to server_version, server_encoding, client_encoding,
+	// standard_conforming_strings and TimeZone, which can be overridden.
+	ParameterStatus map[string]string
+
+	// OnConnect, if set, is called once a client has authenticated.  A
+	// returned error is sent as a FATAL error and the connection is closed,
+	// e.g. to reject connections to a coordinator node being shut down.
+	OnConnect func(c *Conn) *Error
+
+	// Listener is the listener accepting connections.
+	Listener net.Listener
+
+	lock    sync.Mutex
+	closed  bool
+	conns   map[*Conn]struct{}
+	nextPID int32
+	wg      sync.WaitGroup
+}
+
+// NewServer starts and returns a Server answering statements with h.
+func NewServer(h Handler) *Server {
+	s := NewUnstartedServer(h)
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a Server listening on a local port which does
+// not accept connections yet, so that its fields can be changed before Start
+// is called.
+func NewUnstartedServer(h Handler) *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("pqtest: failed to listen on a port: %v", err))
+	}
+	return &Server{
+		Handler:  h,
+		Listener: ln,
+		conns:    make(map[*Conn]struct{}),
+		nextPID:  1000,
+	}
+}
+
+// Start starts accepting connections.
+func (s *Server) Start() {
+	s.wg.Add(1)
+	go s.accept()
+}
+
+// Host returns the address the server listens on.
+func (s *Server) Host() string {
+	return s.Listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port returns the port the server listens on.
+func (s *Server) Port() uint16 {
+	return uint16(s.Listener.Addr().(*net.TCPAddr).Port)
+}
+
+// DSN returns a connection string for the server.
+func (s *Server) DSN() string {
+	user := s.User
+	if user == "" {
+		user = "pqtest"
+	}
+	dsn := fmt.Sprintf("host=%s port=%d user=%s dbname=postgres sslmode=disable", s.Host(), s.Port(), user)
+	if s.Password != "" {
+		dsn += " password='" + strings.Replace(s.Password, "'", `\'`, -1) + "'"
+	}
+	return dsn
+}
+
+// Conns returns the open connections.
+func (s *Server) Conns() []*Conn {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	conns := make([]*Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// Notify sends a notification to every open connection.
+func (s *Server) Notify(channel, payload string) {
+	for _, c := range s.Conns() {
+		_ = c.Notify(channel, payload)
+	}
+}
+
+// CloseClientConnections drops the socket of every open connection, as if
+// the server had crashed.
+func (s *Server) CloseClientConnections() {
+	for _, c := range s.Conns() {
+		_ = c.Close()
+	}
+}
+
+// Close stops accepting connections, drops the open ones and waits for
+// their goroutines to finish.
+func (s *Server) Close() {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return
+	}
+	s.closed = true
+	s.lock.Unlock()
+
+	_ = s.Listener.Close()
+	s.CloseClientConnections()
+	s.wg.Wait()
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.Listener.Accept()
+		if err != nil {
+			return
+		}
+		s.lock.Lock()
+		if s.closed {
+			s.lock.Unlock()
+			_ = nc.Close()
+			return
+		}
+		s.nextPID++
+		c := &Conn{
+			server:    s,
+			c:         nc,
+			r:         bufio.NewReader(nc),
+			pid:       s.nextPID,
+			secretKey: s.nextPID * 7919,
+			cancel:    make(chan struct{}, 1),
+			txStatus:  'I',
+			stmts:     make(map[string]*preparedStmt),
+			portals:   make(map[string]*portal),
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.lock.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+			_ = c.Close()
+			s.lock.Lock()
+			delete(s.conns, c)
+			s.lock.Unlock()
+		}()
+	}
+}
+
+// cancelRequest delivers a CancelRequest to the connection it is meant for.
+func (s *Server) cancelRequest(pid, secretKey int32) {
+	for _, c := range s.Conns() {
+		if c.pid == pid && c.secretKey == secretKey {
+			select {
+			case c.cancel <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+type preparedStmt struct {
+	sql        string
+	paramTypes []uint32
+	columns    []Column
+}
+
+type portal struct {
+	stmt          *preparedStmt
+	args          [][]byte
+	argFormats    []int16
+	resultFormats []int16
+
+	// the result being sent, kept between Executes with a row limit
+	result *Result
+	sent   int
+}
+
+// Conn is a client connection to a Server.
+type Conn struct {
+	server    *Server
+	c         net.Conn
+	r         *bufio.Reader
+	pid       int32
+	secretKey int32
+	params    map[string]string
+	cancel    chan struct{}
+
+	writeLock sync.Mutex
+	w         writer
+
+	// only used by the serving goroutine
+	txStatus byte
+	stmts    map[string]*preparedStmt
+	portals  map[string]*portal
+}
+
+// PID returns the backend process ID reported to the client.
+func (c *Conn) PID() int32 {
+	return c.pid
+}
+
+// Params returns the parameters of the startup message, such as user and
+// database.
+func (c *Conn) Params() map[string]string {
+	params := make(map[string]string, len(c.params))
+	for k, v := range c.params {
+		params[k] = v
+	}
+	return params
+}
+
+// Notify sends an asynchronous notification to the client.
+func (c *Conn) Notify(channel, payload string) error {
+	return c.sendAsync(func(w *writer) {
+		w.notification(c.pid, Notification{Channel: channel, Payload: payload})
+	})
+}
+
+// SetParameterStatus sends an asynchronous ParameterStatus to the client, as
+// the server does when e.g. in_hot_standby changes.
+func (c *Conn) SetParameterStatus(name, value string) error {
+	return c.sendAsync(func(w *writer) {
+		w.parameterStatus(name, value)
+	})
+}
+
+// Close drops the socket of the connection.
+func (c *Conn) Close() error {
+	return c.c.Close()
+}
+
+func (c *Conn) sendAsync(write func(w *writer)) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	var w writer
+	write(&w)
+	_, err := c.c.Write(w.buf)
+	return err
+}
+
+// flush writes the buffered messages.
+func (c *Conn) flush() error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if len(c.w.buf) == 0 {
+		return nil
+	}
+	_, err := c.c.Write(c.w.buf)
+	c.w.buf = c.w.buf[:0]
+	return err
+}
+
+// buffer gives access to the buffer of messages waiting for flush.
+func (c *Conn) buffer(write func(w *writer)) {
+	c.writeLock.Lock()
+	write(&c.w)
+	c.writeLock.Unlock()
+}
+
+func (c *Conn) serve() {
+	ok, err := c.startup()
+	if err != nil || !ok {
+		return
+	}
+	for {
+		m, err := readMessage(c.r)
+		if err != nil {
+			return
+		}
+		if err = c.dispatch(m); err != nil {
+			return
+		}
+	}
+}
+
+func (c *Conn) startup() (bool, error) {
+	for {
+		data, err := readPayload(c.r)
+		if err != nil {
+			return false, err
+		}
+		r := &reader{data: data}
+		switch code := r.int32(); code {
+		case sslRequestCode, gssEncRequestCode:
+			if _, err := c.c.Write([]byte{'N'}); err != nil {
+				return false, err
+			}
+			continue
+		case cancelRequestCode:
+			pid := r.int32()
+			secretKey := r.int32()
+			if r.err == nil {
+				c.server.cancelRequest(pid, secretKey)
+			}
+			return false, nil
+		}
+
+		c.params = make(map[string]string)
+		for {
+			k := r.string()
+			if k == "" || r.err != nil {
+				break
+			}
+			c.params[k] = r.string()
+		}
+		if r.err != nil {
+			return false, r.err
+		}
+		break
+	}
+
+	s := c.server
+	if s.User != "" && c.params["user"] != s.User {
+		return false, c.fatal(&Error{Code: "28000", Message: fmt.Sprintf("role %q does not exist", c.params["user"])})
+	}
+	if err := c.authenticate(); err != nil {
+		return false, err
+	}
+	if s.OnConnect != nil {
+		if e := s.OnConnect(c); e != nil {
+			return false, c.fatal(e)
+		}
+	}
+
+	status := map[string]string{
+		"server_version":              "9.2.4",
+		"server_encoding":             "UTF8",
+		"client_encoding":             "UTF8",
+		"standard_conforming_strings": "on",
+		"TimeZone":                    "UTC",
+	}
+	for k, v := range s.ParameterStatus {
+		status[k] = v
+	}
+	c.buffer(func(w *writer) {
+		w.authentication(0)
+		for k, v := range status {
+			w.parameterStatus(k, v)
+		}
+		w.backendKeyData(c.pid, c.secretKey)
+		w.readyForQuery(c.txStatus)
+	})
+	return true, c.flush()
+}
+
+func (c *Conn) fatal(e *Error) error {
+	fatal := *e
+	fatal.Severity = "FATAL"
+	c.buffer(func(w *writer) { w.errorResponse('E', &fatal) })
+	if err := c.flush(); err != nil {
+		return err
+	}
+	return errDropped
+}
+
+func (c *Conn) authenticate() error {
+	s := c.server
+	user := c.params["user"]
+
+	var verify func(data []byte) bool
+	switch s.Auth {
+	case AuthTrust:
+		return nil
+	case AuthCleartext:
+		c.buffer(func(w *writer) { w.authentication(3) })
+		verify = func(data []byte) bool {
+			return string(bytes.TrimRight(data, "\x00")) == s.Password
+		}
+	case AuthMD5:
+		salt := randomBytes(4)
+		c.buffer(func(w *writer) { w.authentication(5, salt) })
+		verify = func(data []byte) bool {
+			return string(bytes.TrimRight(data, "\x00")) == "md5"+md5s(md5s(s.Password+user)+string(salt))
+		}
+	case AuthSHA256:
+		random64 := hex.EncodeToString(randomBytes(32))
+		token := hex.EncodeToString(randomBytes(4))
+		var method, iter [4]byte
+		binary.BigEndian.PutUint32(method[:], 2)
+		binary.BigEndian.PutUint32(iter[:], sha256Iteration)
+		c.buffer(func(w *writer) { w.authentication(10, method[:], []byte(random64), []byte(token), iter[:]) })
+		verify = func(data []byte) bool {
+			return verifySHA256(s.Password, random64, token, bytes.TrimRight(data, "\x00"))
+		}
+	case AuthMD5SHA256:
+		random64 := hex.EncodeToString(randomBytes(32))
+		salt := randomBytes(4)
+		c.buffer(func(w *writer) { w.authentication(11, []byte(random64), salt) })
+		verify = func(data []byte) bool {
+			// the driver repeats the message length before the digest
+			if i := bytes.Index(data, []byte("md5")); i > 0 {
+				data = data[i:]
+			}
+			return string(bytes.TrimRight(data, "\x00")) == "md5"+md5SHA256(s.Password, random64, salt)
+		}
+	default:
+		return c.fatal(&Error{Code: "28000", Message: fmt.Sprintf("pqtest: unknown auth method %d", s.Auth)})
+	}
+	if err := c.flush(); err != nil {
+		return err
+	}
+
+	m, err := readMessage(c.r)
+	if err != nil {
+		return err
+	}
+	if m.typ != 'p' || !verify(m.data) {
+		return c.fatal(&Error{Code: "28P01", Message: "Invalid username/password,login denied."})
+	}
+	return nil
+}
+
+func (c *Conn) dispatch(m message) error {
+	r := &reader{data: m.data}
+	switch m.typ {
+	case 'Q':
+		return c.simpleQuery(r.string())
+	case 'P', 'B', 'D', 'E', 'C', 'S', 'H':
+		return c.extendedQuery(m.typ, r)
+	case 'X':
+		return errDropped
+	case 'd', 'c', 'f':
+		// left over from a failed COPY
+		return nil
+	default:
+		c.buffer(func(w *writer) {
+			w.errorResponse('E', NewError("08P01", fmt.Sprintf("pqtest: unexpected message %q", m.typ)))
+		})
+		return c.flush()
+	}
+}
+
+// respond runs q through the handler and applies the delay and drop
+// injection.  It returns errDropped when the connection has been dropped.
+func (c *Conn) respond(q *Query) (*Result, error) {
+	// forget cancel requests which came in while idle
+	select {
+	case <-c.cancel:
+	default:
+	}
+
+	res := c.server.Handler.Handle(q)
+	if res == nil {
+		res = &Result{Err: NewError("42601", fmt.Sprintf("pqtest: no result for statement %q", q.SQL))}
+	}
+	if res.Delay > 0 {
+		if err := c.flush(); err != nil {
+			return nil, err
+		}
+		t := time.NewTimer(res.Delay)
+		select {
+		case <-t.C:
+		case <-c.cancel:
+			t.Stop()
+			return &Result{Err: NewError("57014", "canceling statement due to user request")}, nil
+		}
+	}
+	if res.Drop {
+		_ = c.Close()
+		return nil, errDropped
+	}
+	return res, nil
+}
+
+func (c *Conn) simpleQuery(sql string) error {
+	if isEmptyQuery(sql) {
+		c.buffer(func(w *writer) {
+			w.empty('I')
+			w.readyForQuery(c.txStatus)
+		})
+		return c.flush()
+	}
+
+	res, err := c.respond(&Query{SQL: sql, Conn: c})
+	if err != nil {
+		return err
+	}
+	c.sendPrelude(res)
+
+	switch {
+	case res.Err != nil:
+	case res.CopyIn != nil:
+		if res, err = c.copyIn(res); err != nil {
+			return err
+		}
+	case res.CopyOut != nil:
+		c.buffer(func(w *writer) {
+			w.copyResponse('H', len(res.Columns), res.CopyBinary)
+			for _, data := range res.CopyOut {
+				w.copyData(data)
+			}
+			w.empty('c')
+		})
+	case res.Columns != nil:
+		c.buffer(func(w *writer) { w.rowDescription(res.Columns) })
+	}
+	if res.Err == nil && res.CopyOut == nil {
+		c.sendRows(res, nil, 0, len(res.Rows))
+	}
+	c.finish(sql, res)
+	c.buffer(func(w *writer) { w.readyForQuery(c.txStatus) })
+	return c.flush()
+}
+
+// copyIn receives the data of a COPY FROM STDIN and returns the result of
+// the COPY.
+func (c *Conn) copyIn(res *Result) (*Result, error) {
+	c.buffer(func(w *writer) { w.copyResponse('G', len(res.Columns), res.CopyBinary) })
+	if err := c.flush(); err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	for {
+		m, err := readMessage(c.r)
+		if err != nil {
+			return nil, err
+		}
+		switch m.typ {
+		case 'd':
+			data = append(data, m.data...)
+		case 'c':
+			done := res.CopyIn(data)
+			if done == nil {
+				done = &Result{Tag: "COPY 0"}
+			}
+			return done, nil
+		case 'f':
+			r := &reader{data: m.data}
+			return &Result{Err: NewError("57014", "COPY from stdin failed: "+r.string())}, nil
+		case 'H', 'S':
+		default:
+			return &Result{Err: NewError("08P01", fmt.Sprintf("unexpected message type 0x%02x during COPY from stdin", m.typ))}, nil
+		}
+	}
+}
+
+// sendPrelude buffers the notices and parameter status of res.
+func (c *Conn) sendPrelude(res *Result) {
+	c.buffer(func(w *writer) {
+		for _, n := range res.Notices {
+			notice := *n
+			if notice.Severity == "" {
+				notice.Severity = "NOTICE"
+			}
+			w.errorResponse('N', &notice)
+		}
+		for k, v := range res.ParameterStatus {
+			w.parameterStatus(k, v)
+		}
+	})
+}
+
+// sendRows buffers the rows [from, to) of res.
+func (c *Conn) sendRows(res *Result, formats []int16, from, to int) {
+	c.buffer(func(w *writer) {
+		for _, row := range res.Rows[from:to] {
+			w.dataRow(encodeRow(res.Columns, formats, row))
+		}
+	})
+}
+
+// finish buffers the end of a statement: its error or command tag, and the
+// notifications.  It keeps track of the transaction status.
+func (c *Conn) finish(sql string, res *Result) {
+	c.buffer(func(w *writer) {
+		if res.Err != nil {
+			w.errorResponse('E', res.Err)
+		} else {
+			w.commandComplete(commandTag(sql, res))
+		}
+		for _, n := range res.Notifications {
+			w.notification(c.pid, n)
+		}
+	})
+	c.txStatus = nextTxStatus(c.txStatus, sql, res.Err != nil)
+}
+
+func (c *Conn) extendedQuery(typ byte, r *reader) error {
+	switch typ {
+	case 'S':
+		c.buffer(func(w *writer) { w.readyForQuery(c.txStatus) })
+		return c.flush()
+	case 'H':
+		return c.flush()
+	}
+
+	ok, err := c.extendedMessage(typ, r)
+	if err != nil || ok {
+		return err
+	}
+	// skip everything up to the next Sync
+	for {
+		m, err := readMessage(c.r)
+		if err != nil {
+			return err
+		}
+		switch m.typ {
+		case 'S':
+			return c.extendedQuery('S', nil)
+		case 'X':
+			return errDropped
+		}
+	}
+}
+
+// extendedMessage handles a message of the extended query protocol.  It
+// returns false after an error was sent.
+func (c *Conn) extendedMessage(typ byte, r *reader) (bool, error) {
+	fail := func(e *Error) (bool, error) {
+		c.buffer(func(w *writer) { w.errorResponse('E', e) })
+		if c.txStatus != 'I' {
+			c.txStatus = 'E'
+		}
+		return false, nil
+	}
+
+	switch typ {
+	case 'P':
+		name := r.string()
+		sql := r.string()
+		n := int(r.int16())
+		types := make([]uint32, 0, n)
+		for i := 0; i < n; i++ {
+			types = append(types, uint32(r.int32()))
+		}
+		if r.err != nil {
+			return fail(NewError("08P01", r.err.Error()))
+		}
+		res, err := c.respond(&Query{SQL: sql, Describe: true, Conn: c})
+		if err != nil {
+			return false, err
+		}
+		if res.Err != nil {
+			return fail(res.Err)
+		}
+		st := &preparedStmt{sql: sql, paramTypes: res.ParamTypes, columns: res.Columns}
+		if st.paramTypes == nil {
+			st.paramTypes = make([]uint32, countPlaceholders(sql))
+		}
+		for i, t := range types {
+			if i < len(st.paramTypes) && t != 0 {
+				st.paramTypes[i] = t
+			}
+		}
+		c.stmts[name] = st
+		c.buffer(func(w *writer) { w.empty('1') })
+
+	case 'B':
+		name := r.string()
+		st, ok := c.stmts[r.string()]
+		p := &portal{stmt: st}
+		p.argFormats = readInt16s(r)
+		nargs := int(r.int16())
+		for i := 0; i < nargs; i++ {
+			n := r.int32()
+			if n < 0 {
+				p.args = append(p.args, nil)
+				continue
+			}
+			p.args = append(p.args, append([]byte(nil), r.next(int(n))...))
+		}
+		p.resultFormats = readInt16s(r)
+		if r.err != nil {
+			return fail(NewError("08P01", r.err.Error()))
+		}
+		if !ok {
+			return fail(NewError("26000", "prepared statement does not exist"))
+		}
+		if len(p.args) != len(st.paramTypes) {
+			return fail(NewError("08P01", fmt.Sprintf("bind message supplies %d parameters, but prepared statement requires %d", len(p.args), len(st.paramTypes))))
+		}
+		c.portals[name] = p
+		c.buffer(func(w *writer) { w.empty('2') })
+
+	case 'D':
+		kind := r.byte()
+		name := r.string()
+		if kind == 'S' {
+			st, ok := c.stmts[name]
+			if !ok {
+				return fail(NewError("26000", fmt.Sprintf("prepared statement %q does not exist", name)))
+			}
+			c.buffer(func(w *writer) {
+				w.parameterDescription(st.paramTypes)
+				describeRows(w, st.columns)
+			})
+		} else {
+			p, ok := c.portals[name]
+			if !ok {
+				return fail(NewError("34000", fmt.Sprintf("portal %q does not exist", name)))
+			}
+			c.buffer(func(w *writer) { describeRows(w, p.stmt.columns) })
+		}
+
+	case 'E':
+		name := r.string()
+		maxRows := int(r.int32())
+		p, ok := c.portals[name]
+		if !ok {
+			return fail(NewError("34000", fmt.Sprintf("portal %q does not exist", name)))
+		}
+		return c.execute(p, maxRows)
+
+	case 'C':
+		kind := r.byte()
+		name := r.string()
+		if kind == 'S' {
+			delete(c.stmts, name)
+		} else {
+			delete(c.portals, name)
+		}
+		c.buffer(func(w *writer) { w.empty('3') })
+	}
+	return true, nil
+}
+
+// execute runs a portal, sending at most maxRows rows if it is positive.
+func (c *Conn) execute(p *portal, maxRows int) (bool, error) {
+	sql := p.stmt.sql
+	if isEmptyQuery(sql) {
+		c.buffer(func(w *writer) { w.empty('I') })
+		return true, nil
+	}
+
+	res := p.result
+	if res == nil {
+		var err error
+		res, err = c.respond(&Query{SQL: sql, Args: p.args, ArgFormats: p.argFormats, Conn: c})
+		if err != nil {
+			return false, err
+		}
+		if res.Err == nil && (res.CopyIn != nil || res.CopyOut != nil) {
+			res = &Result{Err: NewError("0A000", "pqtest: COPY is only supported with the simple query protocol")}
+		}
+		p.result = res
+		c.sendPrelude(res)
+	}
+
+	if res.Err == nil {
+		to := len(res.Rows)
+		if maxRows > 0 && p.sent+maxRows < to {
+			to = p.sent + maxRows
+		}
+		c.sendRows(res, p.resultFormats, p.sent, to)
+		p.sent = to
+		if to < len(res.Rows) {
+			c.buffer(func(w *writer) { w.empty('s') })
+			return true, nil
+		}
+	}
+	c.finish(sql, res)
+	return res.Err == nil, nil
+}
+
+func describeRows(w *writer, cols []Column) {
+	if cols == nil {
+		w.empty('n')
+		return
+	}
+	w.rowDescription(cols)
+}
+
+func readInt16s(r *reader) []int16 {
+	n := int(r.int16())
+	vals := make([]int16, 0, n)
+	for i := 0; i < n; i++ {
+		vals = append(vals, r.int16())
+	}
+	return vals
+}
+
+var placeholderRegexp = regexp.MustCompile(`\$([0-9]+)`)
+
+// countPlaceholders returns the highest $n placeholder of sql.
+func countPlaceholders(sql string) int {
+	n := 0
+	for _, m := range placeholderRegexp.FindAllStringSubmatch(sql, -1) {
+		if i, err := strconv.Atoi(m[1]); err == nil && i > n {
+			n = i
+		}
+	}
+	return n
+}
+
+// commandTag returns the tag of res, or a default tag derived from sql.
+func commandTag(sql string, res *Result) string {
+	if res.Tag != "" {
+		return res.Tag
+	}
+	if res.Columns != nil {
+		return fmt.Sprintf("SELECT %d", len(res.Rows))
+	}
+	word := strings.ToUpper(firstWord(sql))
+	switch word {
+	case "INSERT":
+		return "INSERT 0 0"
+	case "UPDATE", "DELETE", "MERGE", "SELECT", "MOVE", "FETCH", "COPY":
+		return word + " 0"
+	}
+	return word
+}
+
+// isEmptyQuery reports whether sql holds no statement, like ";" sent by the
+// driver to ping the server.
+func isEmptyQuery(sql string) bool {
+	return strings.Trim(sql, " \t\r\n;") == ""
+}
+
+func firstWord(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.TrimRight(fields[0], ";")
+}
+
+// nextTxStatus returns the transaction status after sql has been run.
+func nextTxStatus(status byte, sql string, failed bool) byte {
+	if failed {
+		if status == 'I' {
+			return 'I'
+		}
+		return 'E'
+	}
+	fields := strings.Fields(strings.ToUpper(sql))
+	if len(fields) == 0 {
+		return status
+	}
+	switch strings.TrimRight(fields[0], ";") {
+	case "BEGIN", "START":
+		return 'T'
+	case "COMMIT", "END", "ABORT":
+		return 'I'
+	case "ROLLBACK":
+		if len(fields) > 1 && (fields[1] == "TO" || strings.HasPrefix(fields[1], "PREPARED")) {
+			if fields[1] == "TO" {
+				return 'T'
+			}
+			return status
+		}
+		return 'I'
+	}
+	return status
+}
+
+// encodeRow converts the text values of row to the formats asked for by the
+// client.
+func encodeRow(cols []Column, formats []int16, row [][]byte) [][]byte {
+	if len(formats) == 0 {
+		return row
+	}
+	out := make([][]byte, len(row))
+	for i, v := range row {
+		f := formats[0]
+		if len(formats) > 1 && i < len(formats) {
+			f = formats[i]
+		}
+		if f == 0 || v == nil || i >= len(cols) {
+			out[i] = v
+			continue
+		}
+		out[i] = encodeBinary(cols[i].OID, v)
+	}
+	return out
+}
+
+// encodeBinary converts a text value to binary format, for the types the
+// driver receives in binary.
+func encodeBinary(typ uint32, v []byte) []byte {
+	switch typ {
+	case 17: // bytea
+		if bytes.HasPrefix(v, []byte(`\x`)) {
+			if b, err := hex.DecodeString(string(v[2:])); err == nil {
+				return b
+			}
+		}
+	case 21, 23, 20: // int2, int4, int8
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			break
+		}
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(n))
+		switch typ {
+		case 21:
+			return b[6:]
+		case 23:
+			return b[4:]
+		}
+		return b
+	case 2950: // uuid
+		if b, err := hex.DecodeString(strings.Replace(string(v), "-", "", -1)); err == nil && len(b) == 16 {
+			return b
+		}
+	case 700, 701: // float4, float8
+		if b, ok := encodeFloat(typ, v); ok {
+			return b
+		}
+	case 16: // bool
+		if b, ok := encodeBool(v); ok {
+			return b
+		}
+	case 1082, 1083, 1114, 1184: // date, time, timestamp, timestamptz
+		if b, ok := encodeTimestamp(typ, v); ok {
+			return b
+		}
+	case 1700: // numeric
+		if b, ok := encodeNumeric(v); ok {
+			return b
+		}
+	}
+	return v
+}
+
+// keyToHex encodes a key the way the driver does for the md5 exchange for
+// sha256 stored passwords, which puts the zero after the digit of bytes below
+// 0x10.
+func keyToHex(key []byte) string {
+	var sb strings.Builder
+	for _, b := range key {
+		hv := strconv.FormatInt(int64(b), 16)
+		sb.WriteString(hv)
+		if len(hv) < 2 {
+			sb.WriteByte('0')
+		}
+	}
+	return sb.String()
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("pqtest: cannot read random bytes: %v", err))
+	}
+	return b
+}
+
+func md5s(s string) string {
+	h := md5.New()
+	h.Write([]byte(s))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// sha256Keys derives the keys of the openGauss sha256 exchange.
+func sha256Keys(password, random64 string, iteration int) (serverKey, clientKey, storedKey []byte) {
+	salt, _ := hex.DecodeString(random64)
+	k := pbkdf2.Key([]byte(password), salt, iteration, 32, sha1.New)
+	serverKey = hmacSHA256(k, []byte("Sever Key"))
+	clientKey = hmacSHA256(k, []byte("Client Key"))
+	sum := sha256.Sum256(clientKey)
+	return serverKey, clientKey, sum[:]
+}
+
+// verifySHA256 checks the client proof of the sha256 exchange the way the
+// server does: the proof XORed with HMAC(StoredKey, token) must be a client
+// key hashing to StoredKey.
+func verifySHA256(password, random64, token string, proof []byte) bool {
+	_, _, storedKey := sha256Keys(password, random64, sha256Iteration)
+	p, err := hex.DecodeString(string(proof))
+	if err != nil || len(p) != len(storedKey) {
+		return false
+	}
+	tokenBytes, _ := hex.DecodeString(token)
+	h := hmacSHA256(storedKey, tokenBytes)
+	clientKey := make([]byte, len(p))
+	for i := range p {
+		clientKey[i] = p[i] ^ h[i]
+	}
+	sum := sha256.Sum256(clientKey)
+	return hmac.Equal(sum[:], storedKey)
+}
+
+// md5SHA256 returns the digest expected by the md5 exchange for sha256
+// stored passwords, without the md5 prefix.
+func md5SHA256(password, random64 string, salt []byte) string {
+	serverKey, _, storedKey := sha256Keys(password, random64, 2048)
+	encrypted := random64 + keyToHex(serverKey) + keyToHex(storedKey)
+	digest := md5s(encrypted + string(salt))
+	return hex.EncodeToString([]byte(digest)[:16])
+}
@@ -0,0 +1,263 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+// testDBOptions are the options of openTestDB.
+type testDBOptions struct {
+	dsn          string
+	maxOpenConns int
+	connector    func(c *Connector)
+}
+
+// testDBOption sets an option of openTestDB.
+type testDBOption func(o *testDBOptions)
+
+// withDSN appends options to the DSN of the test server.
+func withDSN(options string) testDBOption {
+	return func(o *testDBOptions) { o.dsn += " " + options }
+}
+
+// withMaxOpenConns limits the open connections of the database.
+func withMaxOpenConns(n int) testDBOption {
+	return func(o *testDBOptions) { o.maxOpenConns = n }
+}
+
+// withConnector calls f on the connector before the database is opened.
+func withConnector(f func(c *Connector)) testDBOption {
+	return func(o *testDBOptions) { o.connector = f }
+}
+
+// openTestDB starts a pqtest server answering statements with h and opens a
+// database on it.  The returned func closes both.
+func openTestDB(t *testing.T, h pqtest.Handler, opts ...testDBOption) (*pqtest.Server, *sql.DB, func()) {
+	t.Helper()
+	var o testDBOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	srv := pqtest.NewServer(h)
+	c, err := NewConnector(srv.DSN() + o.dsn)
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	if o.connector != nil {
+		o.connector(c)
+	}
+	db := sql.OpenDB(c)
+	if o.maxOpenConns > 0 {
+		db.SetMaxOpenConns(o.maxOpenConns)
+	}
+	return srv, db, func() {
+		db.Close()
+		srv.Close()
+	}
+}
+
+// int4Result returns a result of a single int4 column with the given values.
+func int4Result(name string, values ...int) *pqtest.Result {
+	res := &pqtest.Result{Columns: []pqtest.Column{{Name: name, OID: 23}}}
+	for _, v := range values {
+		res.Rows = append(res.Rows, pqtest.Row(v))
+	}
+	return res
+}
+
+func TestPqtestSimpleQuery(t *testing.T) {
+	script := pqtest.NewScript().On("select 1", int4Result("?column?", 1))
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	var n int
+	if err := db.QueryRow("select 1").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("got %d, want 1", n)
+	}
+}
+
+func TestPqtestExtendedQuery(t *testing.T) {
+	var (
+		lock sync.Mutex
+		args []string
+	)
+	script := pqtest.HandlerFunc(func(q *pqtest.Query) *pqtest.Result {
+		lock.Lock()
+		defer lock.Unlock()
+		if q.SQL != "select $1::int + $2::int" {
+			return &pqtest.Result{Err: pqtest.NewError("42601", "unexpected statement")}
+		}
+		res := &pqtest.Result{
+			Columns:    []pqtest.Column{{Name: "sum", OID: 23}},
+			ParamTypes: []uint32{23, 23},
+		}
+		if !q.Describe {
+			args = nil
+			for _, a := range q.Args {
+				args = append(args, string(a))
+			}
+			res.Rows = [][][]byte{pqtest.Row(42)}
+		}
+		return res
+	})
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	var n int
+	if err := db.QueryRow("select $1::int + $2::int", 40, 2).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 42 {
+		t.Fatalf("got %d, want 42", n)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(args) != 2 || args[0] != "40" || args[1] != "2" {
+		t.Fatalf("server received arguments %q, want [40 2]", args)
+	}
+}
+
+func TestPqtestServerError(t *testing.T) {
+	script := pqtest.NewScript().
+		On("select missing", &pqtest.Result{Err: pqtest.NewError("42703", `column "missing" does not exist`)}).
+		On("select 1", int4Result("?column?", 1))
+	_, db, done := openTestDB(t, script)
+	defer done()
+	db.SetMaxOpenConns(1)
+
+	_, err := db.Exec("select missing")
+	var pgErr *Error
+	if !errors.As(err, &pgErr) || pgErr.Code != "42703" {
+		t.Fatalf("got error %v, want SQLSTATE 42703", err)
+	}
+	// the connection is still usable after an error
+	var n int
+	if err := db.QueryRow("select 1").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPqtestAuthentication(t *testing.T) {
+	methods := []struct {
+		name string
+		auth pqtest.AuthMethod
+	}{
+		{"cleartext", pqtest.AuthCleartext},
+		{"md5", pqtest.AuthMD5},
+		{"sha256", pqtest.AuthSHA256},
+		{"md5_sha256", pqtest.AuthMD5SHA256},
+	}
+	for _, m := range methods {
+		t.Run(m.name, func(t *testing.T) {
+			srv := pqtest.NewUnstartedServer(pqtest.NewScript())
+			srv.Auth = m.auth
+			srv.User = "gauss"
+			srv.Password = "Test@123"
+			srv.Start()
+			defer srv.Close()
+
+			db, err := sql.Open("opengauss", srv.DSN())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if err := db.Ping(); err != nil {
+				t.Fatal(err)
+			}
+
+			wrong, err := sql.Open("opengauss", srv.DSN()+" password=wrong")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer wrong.Close()
+			if err := wrong.Ping(); err == nil {
+				t.Fatal("expected a wrong password to be rejected")
+			}
+		})
+	}
+}
+
+func TestPqtestCancel(t *testing.T) {
+	script := pqtest.NewScript().
+		On("select pg_sleep(10)", &pqtest.Result{Delay: 10 * time.Second}).
+		On("select 1", int4Result("?column?", 1))
+	_, db, done := openTestDB(t, script)
+	defer done()
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := db.ExecContext(ctx, "select pg_sleep(10)")
+	if err == nil {
+		t.Fatal("expected the statement to be canceled")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("statement was canceled after %v", elapsed)
+	}
+
+	var n int
+	if err := db.QueryRow("select 1").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPqtestConnectionFailures(t *testing.T) {
+	script := pqtest.NewScript().
+		Once("select 1", &pqtest.Result{Err: pqtest.CNShutdownError()}).
+		Once("select 1", &pqtest.Result{Drop: true}).
+		On("select 1", int4Result("?column?", 1))
+	var (
+		lock sync.Mutex
+		pids []int32
+	)
+	handler := pqtest.HandlerFunc(func(q *pqtest.Query) *pqtest.Result {
+		lock.Lock()
+		pids = append(pids, q.Conn.PID())
+		lock.Unlock()
+		return script.Handle(q)
+	})
+	_, db, done := openTestDB(t, handler)
+	defer done()
+	db.SetMaxOpenConns(1)
+
+	// both failures mark the connection bad, which makes database/sql retry
+	// on a new connection
+	var n int
+	if err := db.QueryRow("select 1").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(pids) != 3 || pids[0] == pids[1] || pids[1] == pids[2] {
+		t.Fatalf("statements ran on connections %v, want 3 different ones", pids)
+	}
+}
+
+func TestPqtestOnConnectRejects(t *testing.T) {
+	srv := pqtest.NewUnstartedServer(pqtest.NewScript())
+	srv.OnConnect = func(c *pqtest.Conn) *pqtest.Error {
+		return pqtest.NewError("57P03", "the database system is starting up")
+	}
+	srv.Start()
+	defer srv.Close()
+
+	db, err := sql.Open("opengauss", srv.DSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err == nil {
+		t.Fatal("expected the connection to be rejected")
+	}
+}
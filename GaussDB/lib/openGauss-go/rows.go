@@ -47,6 +47,8 @@ func (fd fieldDesc) Type() reflect.Type {
 		return reflect.TypeOf(float32(0))
 	case oid.T_float8:
 		return reflect.TypeOf(float64(0))
+	case oid.T_numeric:
+		return reflect.TypeOf(Numeric{})
 	default:
 		return reflect.TypeOf(new(interface{})).Elem()
 	}
@@ -104,14 +106,33 @@ type rows struct {
 	result                  driver.Result
 	tag                     string
 	disable_text_conversion bool
+	// set when the rows are fetched in batches, see WithFetchSize
+	cursor *rowsCursor
 
 	next *rowsHeader
+
+	// the span of the query, ended by Close once the rows have been read
+	span    *traceSpan
+	spanErr error
 }
 
-func (rs *rows) Close() error {
+func (rs *rows) Close() (err error) {
 	if finish := rs.finish; finish != nil {
 		defer finish()
 	}
+	if span := rs.span; span != nil {
+		rs.span = nil
+		defer func() {
+			if rs.spanErr != nil {
+				span.end(nil, rs.spanErr)
+			} else {
+				span.end(rs.result, err)
+			}
+		}()
+	}
+	if rs.cursor != nil {
+		rs.cursor.closing = true
+	}
 	// no need to look at cn.bad as Next() will
 	for {
 		err := rs.Next(nil)
@@ -153,6 +174,13 @@ func (rs *rows) Next(dest []driver.Value) (err error) {
 	if rs.done {
 		return io.EOF
 	}
+	if rs.span != nil {
+		defer func() {
+			if err != nil && err != io.EOF && rs.spanErr == nil {
+				rs.spanErr = err
+			}
+		}()
+	}
 
 	cn := rs.cn
 	if cn.getBad() {
@@ -160,14 +188,19 @@ func (rs *rows) Next(dest []driver.Value) (err error) {
 	}
 
 	for {
-		t, err := cn.recv1Buf(&rs.rb)
-		if err != nil {
+		t, recvErr := cn.recv1Buf(&rs.rb)
+		if recvErr != nil {
 			cn.setBad()
-			return fmt.Errorf("unexpected DataRow after error %s", err)
+			return fmt.Errorf("unexpected DataRow after error %s", recvErr)
 		}
 		switch t {
 		case 'E':
 			err = parseError(&rs.rb, cn)
+			if rs.cursor != nil {
+				if serr := rs.endCursor(); serr != nil {
+					return serr
+				}
+			}
 		case 'C', 'I':
 			if t == 'C' {
 				s, err := rs.rb.string()
@@ -179,6 +212,18 @@ func (rs *rows) Next(dest []driver.Value) (err error) {
 					return fmt.Errorf("cannot parse complete: %w", err)
 				}
 			}
+			if rs.cursor != nil {
+				if err := rs.endCursor(); err != nil {
+					return err
+				}
+			}
+			continue
+		case 's': // PortalSuspended
+			if err := rs.fetchMore(); err != nil {
+				return err
+			}
+			continue
+		case '3': // CloseComplete of the portal of a cursor
 			continue
 		case 'Z':
 			cn.processReadyForQuery(&rs.rb)
@@ -186,6 +231,9 @@ func (rs *rows) Next(dest []driver.Value) (err error) {
 			if err != nil {
 				return err
 			}
+			if rs.cursor != nil && rs.cursor.err != nil {
+				return rs.cursor.err
+			}
 			return io.EOF
 		case 'D':
 			n := rs.rb.int16()
@@ -0,0 +1,188 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	// runInTxMaxAttempts is how many times RunInTx runs a transaction which
+	// keeps failing with retryable errors.
+	runInTxMaxAttempts = 5
+	// backoff before the first retry, doubled for every further retry
+	runInTxInitialBackoff = 10 * time.Millisecond
+	runInTxMaxBackoff     = time.Second
+)
+
+type txContextKey struct{}
+
+// txContext is the connection of the transaction RunInTx passes to its
+// function through the context, so that nested calls use savepoints.
+type txContext struct {
+	conn *sql.Conn
+}
+
+// retryCanceledError is returned when the context is done while RunInTx
+// waits to retry a transaction.  errors.Is and errors.As match both the
+// error of the last attempt and the error of the context.
+type retryCanceledError struct {
+	err    error
+	ctxErr error
+}
+
+func (e *retryCanceledError) Error() string {
+	return "transaction not retried: " + e.err.Error() + ": " + e.ctxErr.Error()
+}
+
+func (e *retryCanceledError) Unwrap() error {
+	return e.ctxErr
+}
+
+func (e *retryCanceledError) Is(target error) bool {
+	return errors.Is(e.err, target)
+}
+
+func (e *retryCanceledError) As(target interface{}) bool {
+	return errors.As(e.err, target)
+}
+
+// RunInTx runs fn in a transaction started on db with opts, and commits it
+// if fn returns nil.  The transaction is rolled back if fn returns an error
+// or panics.
+//
+// When fn, or the commit, fails with an error for which IsRetryable is true,
+// such as a serialization failure, a deadlock or the loss of the coordinator
+// node, the whole transaction is run again on a new connection, with an
+// exponential backoff, up to 5 times.  fn must therefore be safe to run more
+// than once.  A commit which fails because the connection is lost is not
+// retried, since the transaction may have been committed.
+//
+// Calls of RunInTx with the context passed to fn do not start a new
+// transaction: fn runs in a nested transaction, see Savepoints in the package
+// documentation, which is rolled back if fn returns an error, and the error
+// is returned to the enclosing fn without a retry.  The tx passed to the
+// nested fn is the nested transaction.
+//
+// If the context is done while RunInTx waits to retry, the error returned
+// matches both the context error and the error of the last attempt.
+//
+// Retries and the number of attempts are logged through the Logger of the
+// connections, at the warn and info levels.
+func RunInTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	if parent, ok := ctx.Value(txContextKey{}).(*txContext); ok {
+		return runInSavepoint(ctx, parent, fn)
+	}
+
+	var (
+		start   = time.Now()
+		backoff = runInTxInitialBackoff
+		config  *Config
+		err     error
+		attempt int
+	)
+	for attempt = 1; ; attempt++ {
+		var retryable bool
+		retryable, err = runTxAttempt(ctx, db, opts, fn, &config)
+		if err == nil || !retryable || attempt >= runInTxMaxAttempts {
+			break
+		}
+
+		// random wait in the upper half of the backoff
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		if config != nil {
+			config.Log(ctx, LogLevelWarn, "retrying transaction", map[string]interface{}{
+				"attempt": attempt, "backoff": wait, "error": err})
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &retryCanceledError{err: err, ctxErr: ctx.Err()}
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > runInTxMaxBackoff {
+			backoff = runInTxMaxBackoff
+		}
+	}
+
+	if config != nil {
+		data := map[string]interface{}{
+			"attempts": attempt, "retries": attempt - 1, "time": time.Since(start)}
+		if err != nil {
+			data["error"] = err
+		}
+		config.Log(ctx, LogLevelInfo, "transaction finished", data)
+	}
+	if err != nil && attempt > 1 {
+		return fmt.Errorf("transaction failed after %d attempts: %w", attempt, err)
+	}
+	return err
+}
+
+// runTxAttempt runs fn in a new transaction once.  It reports whether the
+// error returned may go away when the transaction is run again, and sets
+// *config to the config of the connection if it is a pq connection.
+func runTxAttempt(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(context.Context, *sql.Tx) error, config **Config) (retryable bool, err error) {
+	c, err := db.Conn(ctx)
+	if err != nil {
+		return IsRetryable(err), err
+	}
+	defer c.Close()
+	if *config == nil {
+		_ = c.Raw(func(driverConn interface{}) error {
+			if cn, ok := driverConn.(*conn); ok {
+				*config = cn.config
+			}
+			return nil
+		})
+	}
+
+	tx, err := c.BeginTx(ctx, opts)
+	if err != nil {
+		return IsRetryable(err), err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txContextKey{}, &txContext{conn: c}), tx); err != nil {
+		return IsRetryable(err), err
+	}
+
+	committed = true
+	if err := tx.Commit(); err != nil {
+		// only retried when the server reported that it rolled back
+		return IsSerializationFailure(err) || IsDeadlock(err), err
+	}
+	return false, nil
+}
+
+// runInSavepoint runs fn in a transaction nested in the transaction of
+// parent, which is a savepoint of it.
+func runInSavepoint(ctx context.Context, parent *txContext, fn func(context.Context, *sql.Tx) error) error {
+	tx, err := parent.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+	committed = true
+	return tx.Commit()
+}
@@ -0,0 +1,162 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+func serializationFailure() *pqtest.Result {
+	return &pqtest.Result{Err: pqtest.NewError("40001", "could not serialize access due to concurrent update")}
+}
+
+func insertItem(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "insert item")
+	return err
+}
+
+func TestRunInTxRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     *pqtest.Script
+		attempts   int
+		err        error
+		statements string
+	}{
+		{
+			name:       "serialization failure",
+			script:     pqtest.NewScript().Once("insert item", serializationFailure()),
+			attempts:   2,
+			statements: "BEGIN READ WRITE;insert item;ROLLBACK;BEGIN READ WRITE;insert item;COMMIT",
+		},
+		{
+			name:       "commit serialization failure",
+			script:     pqtest.NewScript().Once("COMMIT", serializationFailure()),
+			attempts:   2,
+			statements: "BEGIN READ WRITE;insert item;COMMIT;BEGIN READ WRITE;insert item;COMMIT",
+		},
+		{
+			name:       "unique violation",
+			script:     pqtest.NewScript().On("insert item", &pqtest.Result{Err: pqtest.NewError("23505", "duplicate key")}),
+			attempts:   1,
+			err:        ErrUniqueViolation,
+			statements: "BEGIN READ WRITE;insert item;ROLLBACK",
+		},
+		{
+			// no switchover is detected with target_session_attrs=any
+			name:       "read-only transaction",
+			script:     pqtest.NewScript().On("insert item", &pqtest.Result{Err: pqtest.NewError("25006", "read-only transaction")}),
+			attempts:   1,
+			err:        ErrReadOnlyTransaction,
+			statements: "BEGIN READ WRITE;insert item;ROLLBACK",
+		},
+		{
+			name:     "too many attempts",
+			script:   pqtest.NewScript().On("insert item", serializationFailure()),
+			attempts: runInTxMaxAttempts,
+			err:      ErrSerializationFailure,
+		},
+	}
+	for _, tt := range tests {
+		tt.script.On("insert item", &pqtest.Result{Tag: "INSERT 0 1"})
+		_, db, done := openTestDB(t, tt.script)
+
+		attempts := 0
+		err := RunInTx(context.Background(), db, nil, func(ctx context.Context, tx *sql.Tx) error {
+			attempts++
+			return insertItem(ctx, tx)
+		})
+		done()
+		if tt.err == nil && err != nil || tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+		}
+		if attempts != tt.attempts {
+			t.Errorf("%s: ran %d attempts, want %d", tt.name, attempts, tt.attempts)
+		}
+		if tt.attempts > 1 && err != nil && !strings.Contains(err.Error(), "after 5 attempts") {
+			t.Errorf("%s: error %q does not report the attempts", tt.name, err)
+		}
+		if got := strings.Join(tt.script.Received(), ";"); tt.statements != "" && got != tt.statements {
+			t.Errorf("%s: statements %q, want %q", tt.name, got, tt.statements)
+		}
+	}
+}
+
+func TestRunInTxCanceledBeforeRetry(t *testing.T) {
+	script := pqtest.NewScript().On("insert item", serializationFailure())
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	attempts := 0
+	err := RunInTx(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error {
+		attempts++
+		err := insertItem(ctx, tx)
+		cancel()
+		return err
+	})
+	if attempts != 1 {
+		t.Errorf("ran %d attempts, want 1", attempts)
+	}
+	// both the context error and the error of the attempt are matched
+	var pqErr *Error
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, ErrSerializationFailure) ||
+		!errors.As(err, &pqErr) || pqErr.Code != CodeSerializationFailure {
+		t.Fatalf("got error %v, want one matching the context error and the serialization failure", err)
+	}
+}
+
+func TestRunInTxNested(t *testing.T) {
+	script := pqtest.NewScript().
+		On("insert outer", &pqtest.Result{Tag: "INSERT 0 1"}).
+		On("insert inner", &pqtest.Result{Tag: "INSERT 0 1"}).
+		On("insert failed", &pqtest.Result{Err: pqtest.NewError("23505", "duplicate key")})
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	exec := func(query string) func(context.Context, *sql.Tx) error {
+		return func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, query)
+			return err
+		}
+	}
+	attempts := 0
+	err := RunInTx(context.Background(), db, nil, func(ctx context.Context, tx *sql.Tx) error {
+		attempts++
+		if err := exec("insert outer")(ctx, tx); err != nil {
+			return err
+		}
+		// the failed savepoint is rolled back without retrying
+		if err := RunInTx(ctx, db, nil, exec("insert failed")); !IsUniqueViolation(err) {
+			t.Errorf("nested RunInTx returned %v, want the unique violation", err)
+		}
+		return RunInTx(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error {
+			if err := exec("insert inner")(ctx, tx); err != nil {
+				return err
+			}
+			return RunInTx(ctx, db, nil, exec("insert inner"))
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 1 {
+		t.Errorf("ran %d attempts, want 1", attempts)
+	}
+	want := []string{
+		"BEGIN READ WRITE", "insert outer",
+		`SAVEPOINT "pq_nested_1"`, "insert failed", `ROLLBACK TO SAVEPOINT "pq_nested_1"`, `RELEASE SAVEPOINT "pq_nested_1"`,
+		`SAVEPOINT "pq_nested_1"`, "insert inner",
+		`SAVEPOINT "pq_nested_2"`, "insert inner", `RELEASE SAVEPOINT "pq_nested_2"`,
+		`RELEASE SAVEPOINT "pq_nested_1"`,
+		"COMMIT",
+	}
+	if got := script.Received(); strings.Join(got, ";") != strings.Join(want, ";") {
+		t.Errorf("statements\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package pq
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+var (
+	errNotInTransaction = errors.New("pq: savepoints can only be used in a transaction")
+	errTxDone           = errors.New("pq: nested transaction has already been committed or rolled back")
+	errOuterTxDone      = errors.New("pq: enclosing transaction has already ended")
+)
+
+// SavepointTx is implemented by the driver.Tx values of this driver.  It is
+// reached through the driver connection, e.g. with sql.Conn.Raw while a
+// transaction is open on the sql.Conn.
+type SavepointTx interface {
+	driver.Tx
+	// Savepoint establishes a new savepoint in the transaction.
+	Savepoint(name string) error
+	// RollbackTo rolls back everything done after the savepoint was
+	// established, and leaves a failed transaction usable again.  The
+	// savepoint is kept.
+	RollbackTo(name string) error
+	// Release destroys the savepoint, keeping what was done after it.
+	Release(name string) error
+}
+
+var (
+	_ SavepointTx = (*conn)(nil)
+	_ SavepointTx = (*nestedTx)(nil)
+)
+
+// nestedTx is the transaction returned by Begin while a transaction is open.
+// It is a savepoint: committing releases it and rolling back rolls back to it.
+type nestedTx struct {
+	cn    *conn
+	name  string
+	depth int
+	done  bool
+}
+
+// beginNested starts a nested transaction as a savepoint of the current
+// transaction.
+func (cn *conn) beginNested() (driver.Tx, error) {
+	if cn.getBad() {
+		return nil, driver.ErrBadConn
+	}
+	tx := &nestedTx{cn: cn, depth: cn.txnDepth + 1}
+	tx.name = fmt.Sprintf("pq_nested_%d", tx.depth)
+	if err := cn.savepoint("SAVEPOINT ", tx.name, "SAVEPOINT"); err != nil {
+		return nil, err
+	}
+	cn.txnDepth = tx.depth
+	return tx, nil
+}
+
+// beginNestedTx checks that opts can be used for a nested transaction, which
+// shares the isolation level and access mode of the enclosing transaction.
+func (cn *conn) beginNestedTx(opts driver.TxOptions) (driver.Tx, error) {
+	if sql.IsolationLevel(opts.Isolation) != sql.LevelDefault || opts.ReadOnly {
+		return nil, errors.New("pq: isolation level and read-only mode can not be set for a nested transaction")
+	}
+	return cn.beginNested()
+}
+
+func (tx *nestedTx) Commit() error {
+	if err := tx.finish(); err != nil {
+		return err
+	}
+	return tx.cn.Release(tx.name)
+}
+
+func (tx *nestedTx) Rollback() error {
+	if err := tx.finish(); err != nil {
+		return err
+	}
+	if err := tx.cn.RollbackTo(tx.name); err != nil {
+		return err
+	}
+	return tx.cn.Release(tx.name)
+}
+
+// finish marks tx and the transactions nested in it as done.
+func (tx *nestedTx) finish() error {
+	if tx.done {
+		return errTxDone
+	}
+	tx.done = true
+	if tx.cn.txnDepth < tx.depth {
+		return errOuterTxDone
+	}
+	tx.cn.txnDepth = tx.depth - 1
+	return nil
+}
+
+func (tx *nestedTx) Savepoint(name string) error {
+	return tx.cn.Savepoint(name)
+}
+
+func (tx *nestedTx) RollbackTo(name string) error {
+	return tx.cn.RollbackTo(name)
+}
+
+func (tx *nestedTx) Release(name string) error {
+	return tx.cn.Release(name)
+}
+
+// Savepoint implements SavepointTx.
+func (cn *conn) Savepoint(name string) error {
+	return cn.savepointExec("SAVEPOINT ", name, "SAVEPOINT")
+}
+
+// RollbackTo implements SavepointTx.
+func (cn *conn) RollbackTo(name string) error {
+	return cn.savepointExec("ROLLBACK TO SAVEPOINT ", name, "ROLLBACK")
+}
+
+// Release implements SavepointTx.
+func (cn *conn) Release(name string) error {
+	return cn.savepointExec("RELEASE SAVEPOINT ", name, "RELEASE")
+}
+
+func (cn *conn) savepointExec(command, name, tag string) error {
+	cn.LockReaderMutex()
+	defer cn.UnlockReaderMutex()
+	return cn.savepoint(command, name, tag)
+}
+
+func (cn *conn) savepoint(command, name, tag string) (err error) {
+	span := cn.startTrace(cn.txnCtx, TraceExec, command+name, 0)
+	defer func() { span.end(nil, err) }()
+	if cn.getBad() {
+		return driver.ErrBadConn
+	}
+	if !cn.isInTransaction() {
+		return errNotInTransaction
+	}
+
+	_, commandTag, err := cn.simpleExec(command + QuoteIdentifier(name))
+	if err != nil {
+		return fmt.Errorf("fail to simple exec: %w", err)
+	}
+	if commandTag != tag {
+		cn.setBad()
+		return fmt.Errorf("unexpected command tag %s", commandTag)
+	}
+	return nil
+}
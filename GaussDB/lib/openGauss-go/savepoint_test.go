@@ -0,0 +1,152 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+func TestNestedTx(t *testing.T) {
+	script := pqtest.NewScript().
+		On("insert ok", &pqtest.Result{Tag: "INSERT 0 1"}).
+		On("insert failed", &pqtest.Result{Err: pqtest.NewError("23505", "duplicate key")})
+	_, db, done := openTestDB(t, script)
+	defer done()
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	tx, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a failed row is rolled back without failing the transaction
+	nested, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nested.Exec("insert failed"); !IsUniqueViolation(err) {
+		t.Fatalf("got error %v, want the unique violation", err)
+	}
+	if err := nested.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	nested, err = c.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nested.Exec("insert ok"); err != nil {
+		t.Fatal(err)
+	}
+	if err := nested.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.BeginTx(ctx, &sql.TxOptions{ReadOnly: true}); err == nil {
+		t.Error("a read-only nested transaction was started")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"BEGIN READ WRITE", `SAVEPOINT "pq_nested_1"`, "insert failed", `ROLLBACK TO SAVEPOINT "pq_nested_1"`, `RELEASE SAVEPOINT "pq_nested_1"`,
+		`SAVEPOINT "pq_nested_1"`, "insert ok", `RELEASE SAVEPOINT "pq_nested_1"`, "COMMIT",
+	}
+	if got := script.Received(); strings.Join(got, ";") != strings.Join(want, ";") {
+		t.Errorf("statements\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestNestedTxOuterDone(t *testing.T) {
+	_, db, done := openTestDB(t, pqtest.NewScript())
+	defer done()
+	err := withDriverConn(t, db, func(c driver.Conn) error {
+		tx, err := c.Begin()
+		if err != nil {
+			return err
+		}
+		outer, err := c.Begin()
+		if err != nil {
+			return err
+		}
+		inner, err := c.Begin()
+		if err != nil {
+			return err
+		}
+		if err := outer.Commit(); err != nil {
+			return err
+		}
+		if err := inner.Commit(); err != errOuterTxDone {
+			t.Errorf("got error %v committing a transaction nested in a released one, want %v", err, errOuterTxDone)
+		}
+		if err := outer.Rollback(); err != errTxDone {
+			t.Errorf("got error %v rolling back a released transaction, want %v", err, errTxDone)
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSavepointTx(t *testing.T) {
+	script := pqtest.NewScript().
+		On(`SAVEPOINT "refused"`, &pqtest.Result{Err: pqtest.NewError("25P01", "SAVEPOINT can only be used in transaction blocks")}).
+		On(`RELEASE SAVEPOINT "odd"`, &pqtest.Result{Tag: "SELECT 0"})
+	_, db, done := openTestDB(t, script)
+	defer done()
+
+	err := withDriverConn(t, db, func(c driver.Conn) error {
+		sp := c.(SavepointTx)
+		if err := sp.Savepoint("a"); err != errNotInTransaction {
+			t.Errorf("got error %v outside of a transaction, want %v", err, errNotInTransaction)
+		}
+		tx, err := c.Begin()
+		if err != nil {
+			return err
+		}
+		if err := tx.(SavepointTx).Savepoint(`a"b`); err != nil {
+			return err
+		}
+		if err := sp.RollbackTo(`a"b`); err != nil {
+			return err
+		}
+		if err := sp.Release(`a"b`); err != nil {
+			return err
+		}
+		var pqErr *Error
+		if err := sp.Savepoint("refused"); !errors.As(err, &pqErr) || pqErr.Code != "25P01" {
+			t.Errorf("got error %v, want the error of the server", err)
+		}
+		if err := sp.RollbackTo("refused"); err != nil {
+			return err
+		}
+		// an unexpected command tag breaks the connection
+		if err := sp.Release("odd"); err == nil {
+			t.Error("an unexpected command tag was accepted")
+		}
+		if err := tx.Commit(); err != driver.ErrBadConn {
+			t.Errorf("got error %v committing on a broken connection, want %v", err, driver.ErrBadConn)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"BEGIN", `SAVEPOINT "a""b"`, `ROLLBACK TO SAVEPOINT "a""b"`, `RELEASE SAVEPOINT "a""b"`,
+		`SAVEPOINT "refused"`, `ROLLBACK TO SAVEPOINT "refused"`, `RELEASE SAVEPOINT "odd"`,
+	}
+	if got := script.Received(); strings.Join(got, ";") != strings.Join(want, ";") {
+		t.Errorf("statements\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var errResetInTransaction = errors.New("pq: connection returned to the pool in a transaction")
+
+// command tags of statements changing the state of the session beyond the
+// current transaction
+var sessionCommandTags = map[string]struct{}{
+	"SET":             {},
+	"RESET":           {},
+	"LISTEN":          {},
+	"PREPARE":         {},
+	"DECLARE CURSOR":  {},
+	"CREATE TABLE":    {},
+	"CREATE VIEW":     {},
+	"CREATE SEQUENCE": {},
+	"LOAD":            {},
+}
+
+// noteCommandTag records the effect on the session of the statement which
+// completed with cmdTag.
+func (cn *conn) noteCommandTag(cmdTag string) {
+	switch {
+	case cmdTag == "DISCARD ALL" || cmdTag == "DEALLOCATE ALL":
+		// the prepared statements are gone on the server
+		cn.stmtResets++
+		if cn.stmtCache != nil {
+			cn.stmtCache.clear()
+		}
+		cn.sessionChanged = true
+	case strings.HasPrefix(cmdTag, "DISCARD"):
+		cn.sessionChanged = true
+	default:
+		if _, ok := sessionCommandTags[cmdTag]; ok {
+			cn.sessionChanged = true
+		}
+	}
+}
+
+// resetSessionState runs Config.ResetSessionQuery and restores
+// Config.RuntimeParams if the session state was changed since the connection
+// was taken from the pool.  The connection is reported as bad if the reset
+// fails, so that it is not reused.
+func (cn *conn) resetSessionState(ctx context.Context) error {
+	query := cn.config.ResetSessionQuery
+	if query == "" {
+		return nil
+	}
+	if cn.isInTransaction() {
+		cn.log(ctx, LogLevelWarn, "cannot reset session", map[string]interface{}{"error": errResetInTransaction.Error()})
+		cn.setBad()
+		return driver.ErrBadConn
+	}
+	if !cn.sessionChanged {
+		return nil
+	}
+
+	if finish := cn.watchCancel(ctx); finish != nil {
+		defer finish()
+	}
+	span := cn.startTrace(ctx, TraceExec, query, 0)
+	err := cn.resetSession(query)
+	span.end(nil, err)
+	if err != nil {
+		cn.log(ctx, LogLevelWarn, "cannot reset session", map[string]interface{}{"error": err.Error()})
+		cn.setBad()
+		return driver.ErrBadConn
+	}
+	cn.log(ctx, LogLevelDebug, "session reset", map[string]interface{}{"query": query})
+	return nil
+}
+
+func (cn *conn) resetSession(query string) error {
+	cn.LockReaderMutex()
+	defer cn.UnlockReaderMutex()
+	if cn.getBad() {
+		return driver.ErrBadConn
+	}
+	if _, _, err := cn.simpleExec(query); err != nil {
+		return fmt.Errorf("fail to simple exec: %w", err)
+	}
+	if q := runtimeParamsQuery(cn.config.RuntimeParams); q != "" {
+		if _, _, err := cn.simpleExec(q); err != nil {
+			return fmt.Errorf("cannot restore run-time parameters: %w", err)
+		}
+	}
+	cn.sessionChanged = false
+	return nil
+}
+
+// runtimeParamsQuery returns a query setting params as the session values, or
+// "" if there are none.  set_config parses the values like the startup
+// packet does, e.g. a search_path list.
+func runtimeParamsQuery(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		switch k {
+		case "options", "replication":
+			// not run-time parameters
+		default:
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("set_config(" + quoteLiteral(k) + ", " + quoteLiteral(params[k]) + ", false)")
+	}
+	return b.String()
+}
+
+// quoteLiteral quotes s as a string literal, whatever the value of
+// standard_conforming_strings.
+func quoteLiteral(s string) string {
+	s = strings.Replace(s, `'`, `''`, -1)
+	if strings.Contains(s, `\`) {
+		return `E'` + strings.Replace(s, `\`, `\\`, -1) + `'`
+	}
+	return `'` + s + `'`
+}
+
+// reprepare prepares st again under its name if the server side statement
+// was deallocated by DISCARD ALL or DEALLOCATE ALL since it was prepared.
+func (st *stmt) reprepare() error {
+	cn := st.cn
+	if st.name == "" || st.resets == cn.stmtResets {
+		return nil
+	}
+	fresh, err := cn.prepareTo(st.sql, st.name)
+	if err != nil {
+		return fmt.Errorf("cannot prepare statement again: %w", err)
+	}
+	*st = *fresh
+	return nil
+}
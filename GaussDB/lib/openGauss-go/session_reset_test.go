@@ -0,0 +1,143 @@
+package pq
+
+import (
+	"context"
+	"testing"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+const discardAll = "DISCARD ALL"
+
+// resetScript answers the reset of reset_session_query='DISCARD ALL' and the
+// statements of the session reset tests.
+func resetScript() *pqtest.Script {
+	return pqtest.NewScript().
+		On("SET search_path TO app", &pqtest.Result{Tag: "SET"}).
+		On("CREATE TABLE t (n int)", &pqtest.Result{Tag: "CREATE TABLE"}).
+		On("select report", &pqtest.Result{Tag: "SELECT 0", Columns: []pqtest.Column{{Name: "n", OID: 23}},
+			ParameterStatus: map[string]string{"search_path": "app"}}).
+		On("select n from t where n = $1", int4Result("n", 1)).
+		On(discardAll, &pqtest.Result{Tag: discardAll}).
+		OnPrefix("SELECT set_config(", &pqtest.Result{Columns: []pqtest.Column{{Name: "set_config", OID: 25}}}).
+		On("select 1", int4Result("?column?", 1))
+}
+
+// resetOptions open a single connection reset with DISCARD ALL.
+var resetOptions = []testDBOption{withDSN("reset_session_query='DISCARD ALL'"), withMaxOpenConns(1)}
+
+func TestSessionReset(t *testing.T) {
+	tests := []struct {
+		statement string
+		reset     bool
+	}{
+		{"SET search_path TO app", true},
+		{"CREATE TABLE t (n int)", true},
+		// a parameter reported by the server changed
+		{"select report", true},
+		{"select 1", false},
+	}
+	for _, tt := range tests {
+		script := resetScript()
+		_, db, done := openTestDB(t, script, resetOptions...)
+		pid := connPID(t, db)
+		if _, err := db.Exec(tt.statement); err != nil {
+			t.Fatalf("%s: %v", tt.statement, err)
+		}
+		if _, err := db.Exec("select 1"); err != nil {
+			t.Fatalf("%s: %v", tt.statement, err)
+		}
+		if connPID(t, db) != pid {
+			t.Errorf("%s: connection was replaced", tt.statement)
+		}
+		done()
+
+		resets := 0
+		if tt.reset {
+			resets = 1
+		}
+		if got := countReceived(script, discardAll); got != resets {
+			t.Errorf("%s: session reset %d times, want %d, received %q", tt.statement, got, resets, script.Received())
+		}
+		restored := 0
+		for _, q := range script.Received() {
+			if q == runtimeParamsQuery(map[string]string{"application_name": "go-driver"}) {
+				restored++
+			}
+		}
+		if restored != resets {
+			t.Errorf("%s: run-time parameters restored %d times, want %d, received %q", tt.statement, restored, resets, script.Received())
+		}
+	}
+}
+
+func TestSessionResetFails(t *testing.T) {
+	script := resetScript().
+		Once(discardAll, &pqtest.Result{Err: pqtest.NewError("XX000", "cannot discard")})
+	_, db, done := openTestDB(t, script, resetOptions...)
+	defer done()
+
+	pid := connPID(t, db)
+	if _, err := db.Exec("SET search_path TO app"); err != nil {
+		t.Fatal(err)
+	}
+	// the connection which failed to reset is closed instead of reused
+	if got := checkConnUsable(t, db, "reset failed"); got == pid {
+		t.Error("connection was reused after its reset failed")
+	}
+}
+
+func TestSessionResetInTransaction(t *testing.T) {
+	script := resetScript()
+	_, db, done := openTestDB(t, script, resetOptions...)
+	defer done()
+
+	ctx := context.Background()
+	pid := connPID(t, db)
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ExecContext(ctx, "BEGIN"); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if got := checkConnUsable(t, db, "in transaction"); got == pid {
+		t.Error("connection returned in a transaction was reused")
+	}
+	if n := countReceived(script, discardAll); n != 0 {
+		t.Errorf("reset run %d times in a transaction", n)
+	}
+}
+
+func TestSessionResetReprepares(t *testing.T) {
+	p := newParseCounter(resetScript())
+	_, db, done := openTestDB(t, p, resetOptions...)
+	defer done()
+
+	const query = "select n from t where n = $1"
+	st, err := db.Prepare(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	var n int
+	if err := st.QueryRow(1).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("SET search_path TO app"); err != nil {
+		t.Fatal(err)
+	}
+	// DISCARD ALL deallocated the statement, which is prepared again
+	if err := st.QueryRow(1).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if got := countReceived(p.Script, discardAll); got != 1 {
+		t.Fatalf("session reset %d times, want 1", got)
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.parsed[query] != 2 {
+		t.Errorf("statement prepared %d times, want 2", p.parsed[query])
+	}
+}
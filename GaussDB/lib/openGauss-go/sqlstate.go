@@ -0,0 +1,147 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+)
+
+// SQLSTATE codes checked by the predicates below and by the driver.
+const (
+	CodeFeatureNotSupported     ErrorCode = "0A000"
+	CodeUniqueViolation         ErrorCode = "23505"
+	CodeReadOnlySQLTransaction  ErrorCode = "25006"
+	CodeInvalidSQLStatementName ErrorCode = "26000"
+	CodeSerializationFailure    ErrorCode = "40001"
+	CodeDeadlockDetected        ErrorCode = "40P01"
+	CodeTooManyConnections      ErrorCode = "53300"
+	CodeQueryCanceled           ErrorCode = "57014"
+	CodeAdminShutdown           ErrorCode = "57P01"
+	CodeCrashShutdown           ErrorCode = "57P02"
+	CodeCannotConnectNow        ErrorCode = "57P03"
+
+	// ClassConnectionException is the class of connection errors, e.g.
+	// 08006 connection_failure.
+	ClassConnectionException ErrorClass = "08"
+)
+
+// internal error code the server sends in the 'c' field when the coordinator
+// node is shutting down
+const internalCodeCNShutdown = "26913"
+
+// Sentinel errors matched by errors.Is against an *Error with the
+// corresponding SQLSTATE, e.g. errors.Is(err, pq.ErrUniqueViolation).
+// ErrConnectionFailure only matches errors reported by the server; use
+// IsConnectionFailure to also match broken sockets.
+var (
+	ErrUniqueViolation      = errors.New("pq: unique violation")
+	ErrSerializationFailure = errors.New("pq: serialization failure")
+	ErrDeadlockDetected     = errors.New("pq: deadlock detected")
+	ErrConnectionFailure    = errors.New("pq: connection failure")
+	ErrReadOnlyTransaction  = errors.New("pq: read-only transaction")
+)
+
+// Is reports whether target is the sentinel error of the SQLSTATE of e.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrUniqueViolation:
+		return e.Code == CodeUniqueViolation
+	case ErrSerializationFailure:
+		return e.Code == CodeSerializationFailure
+	case ErrDeadlockDetected:
+		return e.Code == CodeDeadlockDetected
+	case ErrConnectionFailure:
+		return e.isConnectionFailure()
+	case ErrReadOnlyTransaction:
+		return e.Code == CodeReadOnlySQLTransaction
+	default:
+		return false
+	}
+}
+
+func (e *Error) isConnectionFailure() bool {
+	switch {
+	case len(e.Code) == 5 && e.Code.Class() == ClassConnectionException:
+		return true
+	case e.Code == CodeAdminShutdown, e.Code == CodeCrashShutdown, e.Code == CodeCannotConnectNow:
+		return true
+	default:
+		return e.Column == internalCodeCNShutdown
+	}
+}
+
+// IsUniqueViolation reports whether err is a unique_violation reported by the
+// server.
+func IsUniqueViolation(err error) bool {
+	return errors.Is(err, ErrUniqueViolation)
+}
+
+// IsSerializationFailure reports whether err is a serialization_failure
+// reported by the server.
+func IsSerializationFailure(err error) bool {
+	return errors.Is(err, ErrSerializationFailure)
+}
+
+// IsDeadlock reports whether err is a deadlock_detected reported by the
+// server.
+func IsDeadlock(err error) bool {
+	return errors.Is(err, ErrDeadlockDetected)
+}
+
+// IsReadOnlyTransaction reports whether err is a read_only_sql_transaction
+// reported by the server, e.g. because the primary has been demoted.
+func IsReadOnlyTransaction(err error) bool {
+	return errors.Is(err, ErrReadOnlyTransaction)
+}
+
+// IsConnectionFailure reports whether err means the connection to the server
+// is lost or could not be established: a connection exception or shutdown
+// reported by the server, driver.ErrBadConn, an unexpected EOF or a network
+// error.  A bare io.EOF is not a connection failure: it is how sql.Rows and
+// readers report their end, and the driver returns driver.ErrBadConn when
+// the server closes the connection.
+func IsConnectionFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrConnectionFailure) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// IsRetryable reports whether the operation which failed with err may succeed
+// when it is run again: serialization failures, deadlocks, writes refused by
+// a demoted primary, too many connections and connection failures.  Context
+// errors are never retryable.
+//
+// A read_only_sql_transaction is only retryable when the driver detected a
+// switchover from it, i.e. the connection requires a primary with
+// target_session_attrs=read-write or master and has been marked bad so the
+// retry dials the new primary.  Otherwise the write would fail again, e.g.
+// in a transaction started READ ONLY or on a connection to a standby.
+//
+// Only whole transactions, or statements which are safe to run twice, should
+// be retried: after a connection failure the server may have executed the
+// statement.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pqErr *Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case CodeSerializationFailure, CodeDeadlockDetected, CodeTooManyConnections:
+			return true
+		case CodeReadOnlySQLTransaction:
+			return pqErr.switchover
+		case "08007", "08P01": // transaction_resolution_unknown, protocol_violation
+			return false
+		}
+	}
+	return IsConnectionFailure(err)
+}
@@ -0,0 +1,46 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err               error
+		connectionFailure bool
+		retryable         bool
+	}{
+		{nil, false, false},
+		{&Error{Code: CodeSerializationFailure}, false, true},
+		{fmt.Errorf("commit: %w", &Error{Code: CodeDeadlockDetected}), false, true},
+		{&Error{Code: CodeTooManyConnections}, false, true},
+		{&Error{Code: CodeUniqueViolation}, false, false},
+		// a read-only transaction, not a demoted primary
+		{&Error{Code: CodeReadOnlySQLTransaction}, false, false},
+		{&Error{Code: CodeReadOnlySQLTransaction, switchover: true}, false, true},
+		{&Error{Code: CodeAdminShutdown}, true, true},
+		{&Error{Code: "08006"}, true, true},
+		{&Error{Code: "08007"}, true, false},
+		{&Error{Code: "XX000", Column: internalCodeCNShutdown}, true, true},
+		{driver.ErrBadConn, true, true},
+		{io.ErrUnexpectedEOF, true, true},
+		{io.EOF, false, false},
+		{fmt.Errorf("read row: %w", io.EOF), false, false},
+		{context.Canceled, false, false},
+		{fmt.Errorf("query: %w", context.Canceled), false, false},
+		{errors.New("other"), false, false},
+	}
+	for _, tt := range tests {
+		if got := IsConnectionFailure(tt.err); got != tt.connectionFailure {
+			t.Errorf("IsConnectionFailure(%#v) = %v, want %v", tt.err, got, tt.connectionFailure)
+		}
+		if got := IsRetryable(tt.err); got != tt.retryable {
+			t.Errorf("IsRetryable(%#v) = %v, want %v", tt.err, got, tt.retryable)
+		}
+	}
+}
@@ -18,6 +18,10 @@ type stmt struct {
 	colFmtData []byte
 	paramTypes []oid.Oid
 	closed     bool
+	// statement text, for tracing
+	sql string
+	// conn.stmtResets when the statement was prepared
+	resets int
 }
 
 func (st *stmt) Close() (err error) {
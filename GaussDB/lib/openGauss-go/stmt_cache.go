@@ -0,0 +1,133 @@
+package pq
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strings"
+)
+
+// message of the CodeFeatureNotSupported error raised when the columns
+// returned by a prepared statement changed with the schema
+const errMsgCachedPlanResultType = "cached plan must not change result type"
+
+// stmtCache is a per-connection LRU cache of named prepared statements keyed
+// by their SQL text.  It is used by conn.query and conn.exec when
+// Config.StatementCacheCapacity is set, so the server does not parse the same
+// statement on every call.
+type stmtCache struct {
+	capacity int
+	lru      *list.List // of *stmt, most recently used first
+	entries  map[string]*list.Element
+}
+
+func newStmtCache(capacity int) *stmtCache {
+	return &stmtCache{
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element, capacity),
+	}
+}
+
+func (c *stmtCache) get(sql string) *stmt {
+	e, ok := c.entries[sql]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*stmt)
+}
+
+// put adds st to the cache and returns the statement evicted to make room for
+// it, if any.
+func (c *stmtCache) put(st *stmt) *stmt {
+	c.entries[st.sql] = c.lru.PushFront(st)
+	if c.lru.Len() <= c.capacity {
+		return nil
+	}
+	e := c.lru.Back()
+	c.lru.Remove(e)
+	evicted := e.Value.(*stmt)
+	delete(c.entries, evicted.sql)
+	return evicted
+}
+
+// remove drops the statement cached for sql and returns it, or nil if there
+// is none.
+func (c *stmtCache) remove(sql string) *stmt {
+	e, ok := c.entries[sql]
+	if !ok {
+		return nil
+	}
+	c.lru.Remove(e)
+	delete(c.entries, sql)
+	return e.Value.(*stmt)
+}
+
+// clear drops every cached statement without closing them on the server, for
+// when the server side statements are already gone.
+func (c *stmtCache) clear() {
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element, c.capacity)
+}
+
+// prepareCached returns the prepared statement to run query with.  With the
+// statement cache disabled this is a fresh unnamed statement, otherwise a
+// named statement is prepared once and reused.
+func (cn *conn) prepareCached(query string) (st *stmt, cached bool, err error) {
+	if cn.config == nil || cn.config.StatementCacheCapacity <= 0 {
+		st, err = cn.prepareTo(query, "")
+		return st, false, err
+	}
+	if cn.stmtCache == nil {
+		cn.stmtCache = newStmtCache(cn.config.StatementCacheCapacity)
+	}
+	if st = cn.stmtCache.get(query); st != nil {
+		return st, true, nil
+	}
+
+	st, err = cn.prepareTo(query, cn.gname())
+	if err != nil {
+		return nil, false, err
+	}
+	st.sql = query
+	if evicted := cn.stmtCache.put(st); evicted != nil {
+		if err := evicted.Close(); err != nil {
+			cn.log(context.Background(), LogLevelWarn, "cannot close evicted statement", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	return st, false, nil
+}
+
+// invalidateCached drops the cached statement for query, if any.  The server
+// side statement is closed unless closeOnServer is false.
+func (cn *conn) invalidateCached(query string, closeOnServer bool) {
+	if cn.stmtCache == nil {
+		return
+	}
+	st := cn.stmtCache.remove(query)
+	if st == nil || !closeOnServer || cn.getBad() {
+		return
+	}
+	if err := st.Close(); err != nil {
+		cn.log(context.Background(), LogLevelWarn, "cannot close invalidated statement", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// isStaleStatementError reports whether err means that a cached prepared
+// statement must be prepared again: its result type changed with the schema,
+// or it no longer exists on the server (gone).  Other feature-not-supported
+// errors are reported as they are.
+func isStaleStatementError(err error) (stale bool, gone bool) {
+	var pqErr *Error
+	if !errors.As(err, &pqErr) {
+		return false, false
+	}
+	switch {
+	case pqErr.Code == CodeFeatureNotSupported && strings.Contains(pqErr.Message, errMsgCachedPlanResultType):
+		return true, false
+	case pqErr.Code == CodeInvalidSQLStatementName:
+		return true, true
+	}
+	return false, false
+}
@@ -0,0 +1,94 @@
+package pq
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+// parseCounter counts the statements parsed by the server, which describes
+// every statement it parses.
+type parseCounter struct {
+	*pqtest.Script
+
+	lock   sync.Mutex
+	parsed map[string]int
+}
+
+func (p *parseCounter) Handle(q *pqtest.Query) *pqtest.Result {
+	if q.Describe {
+		p.lock.Lock()
+		p.parsed[q.SQL]++
+		p.lock.Unlock()
+	}
+	return p.Script.Handle(q)
+}
+
+func (p *parseCounter) count(sql string) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.parsed[sql]
+}
+
+func newParseCounter(script *pqtest.Script) *parseCounter {
+	return &parseCounter{Script: script, parsed: map[string]int{}}
+}
+
+// stmtCacheOptions open a single connection caching two statements.
+var stmtCacheOptions = []testDBOption{withDSN("statement_cache_capacity=2"), withMaxOpenConns(1)}
+
+const cachedQuery = "select n from items where id = $1"
+
+func TestStmtCacheReuse(t *testing.T) {
+	p := newParseCounter(pqtest.NewScript().On(cachedQuery, int4Result("n", 7)))
+	_, db, done := openTestDB(t, p, stmtCacheOptions...)
+	defer done()
+
+	for i := 0; i < 3; i++ {
+		var n int
+		if err := db.QueryRow(cachedQuery, 1).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := p.count(cachedQuery); n != 1 {
+		t.Fatalf("statement parsed %d times, want 1", n)
+	}
+}
+
+func TestStmtCacheStaleStatement(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    *pqtest.Error
+		retry  bool
+		parsed int
+	}{
+		{"result type changed", pqtest.NewError("0A000", "cached plan must not change result type"), true, 2},
+		{"statement gone", pqtest.NewError("26000", `prepared statement "1" does not exist`), true, 2},
+		{"other feature not supported", pqtest.NewError("0A000", "FOR UPDATE is not supported"), false, 1},
+	}
+	for _, tt := range tests {
+		script := pqtest.NewScript().On(cachedQuery, int4Result("n", 7))
+		p := newParseCounter(script)
+		_, db, done := openTestDB(t, p, stmtCacheOptions...)
+
+		var n int
+		if err := db.QueryRow(cachedQuery, 1).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		script.Once(cachedQuery, &pqtest.Result{Err: tt.err})
+		err := db.QueryRow(cachedQuery, 1).Scan(&n)
+		if tt.retry && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		var pqErr *Error
+		if !tt.retry && (!errors.As(err, &pqErr) || pqErr.Code != CodeFeatureNotSupported) {
+			t.Errorf("%s: got error %v, want the error of the server", tt.name, err)
+		}
+		if got := p.count(cachedQuery); got != tt.parsed {
+			t.Errorf("%s: statement parsed %d times, want %d", tt.name, got, tt.parsed)
+		}
+		done()
+	}
+}
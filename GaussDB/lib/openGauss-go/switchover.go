@@ -0,0 +1,89 @@
+package pq
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// wantsPrimary reports whether target_session_attrs requires a server which
+// accepts writes.
+func (cn *conn) wantsPrimary() bool {
+	return cn.config.targetSessionAttrs == targetSessionAttrsMaster ||
+		cn.config.targetSessionAttrs == targetSessionAttrsReadWrite
+}
+
+// wantsStandby reports whether target_session_attrs requires a read-only
+// server.
+func (cn *conn) wantsStandby() bool {
+	return cn.config.targetSessionAttrs == targetSessionAttrsSlave ||
+		cn.config.targetSessionAttrs == targetSessionAttrsReadOnly
+}
+
+// checkSwitchoverError marks the connection bad when the server refused a
+// write because it is read-only, which means the primary has been demoted
+// since the connection was validated.  The next use of the connection then
+// returns driver.ErrBadConn and the pool dials the new primary, and
+// IsRetryable reports err as retryable.
+//
+// openGauss does not report in_hot_standby, so with openGauss this error is
+// the only way a demotion is detected in the middle of a session, and only
+// once a write fails.  processHotStandby applies to servers which report it.
+// err must come from an ErrorResponse, notices never mean the write failed.
+func (cn *conn) checkSwitchoverError(err *Error) {
+	if cn.config == nil || err.Code != CodeReadOnlySQLTransaction || !cn.wantsPrimary() {
+		return
+	}
+	cn.log(context.Background(), LogLevelWarn, "server is read-only, primary has been switched over", map[string]interface{}{
+		"node": cn.node(), "target_session_attrs": convertTargetSessionAttrToString(cn.config.targetSessionAttrs)})
+	err.switchover = true
+	cn.setBad()
+}
+
+// processHotStandby handles a change of the in_hot_standby parameter reported
+// by the server, which openGauss does not send.  The first report only records the state, which the
+// connection was validated against; later changes mean a switchover.
+func (cn *conn) processHotStandby(val string) {
+	readOnly := strings.EqualFold(val, "on")
+	reported := cn.parameterStatus.hotStandbyReported
+	changed := reported && cn.parameterStatus.inHotStandby != readOnly
+	cn.parameterStatus.inHotStandby = readOnly
+	cn.parameterStatus.hotStandbyReported = true
+	if !changed || cn.config == nil {
+		return
+	}
+
+	switch {
+	case readOnly && cn.wantsPrimary(), !readOnly && cn.wantsStandby():
+		cn.log(context.Background(), LogLevelWarn, "server role changed, connection no longer matches target_session_attrs", map[string]interface{}{
+			"node": cn.node(), "in_hot_standby": val,
+			"target_session_attrs": convertTargetSessionAttrToString(cn.config.targetSessionAttrs)})
+		cn.setBad()
+	case !readOnly && cn.config.targetSessionAttrs == targetSessionAttrsPreferSlave && !cn.isMasterForPreferSlave:
+		// the standby has been promoted, treat it like a fallback to the
+		// master so it is recycled once a standby is available
+		cn.isMasterForPreferSlave = true
+		cn.masterSince = time.Now()
+	}
+}
+
+// needsRedial reports whether the connection must not be reused: either it
+// has been marked bad, or it is a preferSlave connection which fell back to
+// the master longer than the recheck interval ago, in which case it is marked
+// bad so that the next dial looks for a standby again.
+func (cn *conn) needsRedial() bool {
+	if cn.getBad() {
+		return true
+	}
+	if !cn.isMasterForPreferSlave || cn.isInTransaction() || cn.config == nil {
+		return false
+	}
+	interval := cn.config.PreferSlaveRecheckInterval
+	if interval <= 0 || time.Since(cn.masterSince) < interval {
+		return false
+	}
+	cn.log(context.Background(), LogLevelInfo, "recycling preferSlave connection to master", map[string]interface{}{
+		"node": cn.node(), "since": cn.masterSince})
+	cn.setBad()
+	return true
+}
@@ -0,0 +1,71 @@
+package pq
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+func TestSwitchoverReadOnlyError(t *testing.T) {
+	readOnly := pqtest.NewError("25006", "cannot execute INSERT in a read-only transaction")
+	script := pqtest.NewScript().
+		On("show transaction_read_only", &pqtest.Result{
+			Columns: []pqtest.Column{{Name: "transaction_read_only", OID: 25}},
+			Rows:    [][][]byte{pqtest.Row("off")},
+		}).
+		On("insert notice", &pqtest.Result{Tag: "INSERT 0 1", Notices: []*pqtest.Error{{Severity: "WARNING", Code: "25006", Message: "read-only"}}}).
+		On("insert demoted", &pqtest.Result{Err: readOnly})
+	srv := pqtest.NewServer(script)
+	defer srv.Close()
+
+	tests := []struct {
+		targetSessionAttrs string
+		statement          string
+		redial             bool
+	}{
+		{"read-write", "insert notice", false},
+		{"read-write", "insert demoted", true},
+		{"any", "insert demoted", false},
+	}
+	for _, tt := range tests {
+		db, err := sql.Open("opengauss", srv.DSN()+" target_session_attrs="+tt.targetSessionAttrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.SetMaxOpenConns(1)
+		pid := connPID(t, db)
+		_, err = db.Exec(tt.statement)
+		if (err != nil) != (tt.statement == "insert demoted") {
+			t.Errorf("%s %s: unexpected error %v", tt.targetSessionAttrs, tt.statement, err)
+		}
+		// the write is only worth retrying on the new primary
+		if retryable := IsRetryable(err); retryable != tt.redial {
+			t.Errorf("%s %s: IsRetryable(%v) = %v, want %v", tt.targetSessionAttrs, tt.statement, err, retryable, tt.redial)
+		}
+		if redialed := connPID(t, db) != pid; redialed != tt.redial {
+			t.Errorf("%s %s: connection redialed %v, want %v", tt.targetSessionAttrs, tt.statement, redialed, tt.redial)
+		}
+		db.Close()
+	}
+}
+
+func TestPreferSlaveRecheckIntervalDefault(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want time.Duration
+	}{
+		{"host=localhost", 0},
+		{"host=localhost preferSlaveRecheckTime=30", 30 * time.Second},
+	}
+	for _, tt := range tests {
+		config, _, err := ParseConfig(tt.dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.PreferSlaveRecheckInterval != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.dsn, config.PreferSlaveRecheckInterval, tt.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TraceEventType identifies the operation a trace event describes.
+type TraceEventType int
+
+const (
+	TraceConnect TraceEventType = iota + 1
+	TracePrepare
+	TraceQuery
+	TraceExec
+	TraceCopy
+	TraceBegin
+	TraceCommit
+	TraceRollback
+)
+
+func (t TraceEventType) String() string {
+	switch t {
+	case TraceConnect:
+		return "connect"
+	case TracePrepare:
+		return "prepare"
+	case TraceQuery:
+		return "query"
+	case TraceExec:
+		return "exec"
+	case TraceCopy:
+		return "copy"
+	case TraceBegin:
+		return "begin"
+	case TraceCommit:
+		return "commit"
+	case TraceRollback:
+		return "rollback"
+	default:
+		return fmt.Sprintf("invalid trace event %d", t)
+	}
+}
+
+// TraceStartData describes an operation which is about to start.
+type TraceStartData struct {
+	Type TraceEventType
+	// SQL is the statement text, empty for connect and transaction events.
+	SQL string
+	// NumArgs is the number of arguments bound to the statement.
+	NumArgs int
+	// Node is the address of the server, as host:port.  It is empty at the
+	// start of a connect event.
+	Node string
+}
+
+// TraceEndData describes an operation which has finished.
+type TraceEndData struct {
+	TraceStartData
+	Duration time.Duration
+	// RowsAffected is the number of rows affected by an exec or copy, or
+	// returned by a query, or -1 when it is not known.
+	RowsAffected int64
+	// SQLState is the SQLSTATE of Err if it was returned by the server.
+	SQLState string
+	Err      error
+}
+
+// Tracer is the interface used to get structured events for the operations
+// of a connection, e.g. to feed OpenTelemetry spans.  It is set with
+// Config.Tracer.
+type Tracer interface {
+	// TraceStart is called before the operation starts.  The returned
+	// context is passed to TraceEnd, so it can carry a span.
+	TraceStart(ctx context.Context, data TraceStartData) context.Context
+	// TraceEnd is called once the operation has finished: for a query when
+	// its rows are closed, for a copy when its statement is closed.
+	TraceEnd(ctx context.Context, data TraceEndData)
+}
+
+type traceSpan struct {
+	tracer Tracer
+	ctx    context.Context
+	data   TraceStartData
+	start  time.Time
+}
+
+// startTrace starts a trace event if cfg has a Tracer.  The returned span
+// may be nil; its end method is then a no-op.
+func startTrace(ctx context.Context, cfg *Config, data TraceStartData) *traceSpan {
+	if cfg == nil || cfg.Tracer == nil {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &traceSpan{
+		tracer: cfg.Tracer,
+		ctx:    cfg.Tracer.TraceStart(ctx, data),
+		data:   data,
+		start:  time.Now(),
+	}
+}
+
+func (cn *conn) startTrace(ctx context.Context, typ TraceEventType, sql string, numArgs int) *traceSpan {
+	return startTrace(ctx, cn.config, TraceStartData{
+		Type:    typ,
+		SQL:     sql,
+		NumArgs: numArgs,
+		Node:    cn.node(),
+	})
+}
+
+func (s *traceSpan) end(res driver.Result, err error) {
+	if s == nil {
+		return
+	}
+	rowsAffected := int64(-1)
+	if res != nil && err == nil {
+		if n, rerr := res.RowsAffected(); rerr == nil {
+			rowsAffected = n
+		}
+	}
+	s.endRows(rowsAffected, err)
+}
+
+func (s *traceSpan) endRows(rowsAffected int64, err error) {
+	if s == nil {
+		return
+	}
+	data := TraceEndData{
+		TraceStartData: s.data,
+		Duration:       time.Since(s.start),
+		RowsAffected:   rowsAffected,
+		Err:            err,
+	}
+	var pqErr *Error
+	if errors.As(err, &pqErr) {
+		data.SQLState = string(pqErr.Code)
+	}
+	s.tracer.TraceEnd(s.ctx, data)
+}
@@ -0,0 +1,138 @@
+package pq
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"gitee.com/opengauss/openGauss-connector-go-pq/pqtest"
+)
+
+type traceKey struct{}
+
+// recordingTracer records the events it gets, with the value of traceKey in
+// the context of their start.
+type recordingTracer struct {
+	lock   sync.Mutex
+	starts []TraceStartData
+	ends   []TraceEndData
+	values []interface{}
+}
+
+func (tr *recordingTracer) TraceStart(ctx context.Context, data TraceStartData) context.Context {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	tr.starts = append(tr.starts, data)
+	tr.values = append(tr.values, ctx.Value(traceKey{}))
+	return ctx
+}
+
+func (tr *recordingTracer) TraceEnd(ctx context.Context, data TraceEndData) {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	tr.ends = append(tr.ends, data)
+}
+
+// ended returns the events of typ which ended.
+func (tr *recordingTracer) ended(typ TraceEventType) []TraceEndData {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	var ends []TraceEndData
+	for _, e := range tr.ends {
+		if e.Type == typ {
+			ends = append(ends, e)
+		}
+	}
+	return ends
+}
+
+// startValue returns the traceKey value of the first event of typ.
+func (tr *recordingTracer) startValue(typ TraceEventType) interface{} {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	for i, s := range tr.starts {
+		if s.Type == typ {
+			return tr.values[i]
+		}
+	}
+	return nil
+}
+
+// withTracer sets tr as the tracer of the connections.
+func withTracer(tr *recordingTracer) testDBOption {
+	return withConnector(func(c *Connector) { c.config.Tracer = tr })
+}
+
+func TestTraceQueryEndsOnRowsClose(t *testing.T) {
+	script := pqtest.NewScript().
+		On("select n from items", int4Result("n", 1, 2)).
+		On("select missing", &pqtest.Result{Err: pqtest.NewError("42703", `column "missing" does not exist`)})
+	tr := &recordingTracer{}
+	_, db, done := openTestDB(t, script, withTracer(tr))
+	defer done()
+
+	rows, err := db.Query("select n from items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(tr.ended(TraceQuery)); n != 0 {
+		t.Fatalf("query span ended before the rows were read")
+	}
+	for rows.Next() {
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ends := tr.ended(TraceQuery)
+	if len(ends) != 1 || ends[0].Err != nil || ends[0].RowsAffected != 2 || ends[0].SQL != "select n from items" {
+		t.Fatalf("got query events %+v", ends)
+	}
+
+	if _, err := db.Query("select missing"); err == nil {
+		t.Fatal("expected an error")
+	}
+	ends = tr.ended(TraceQuery)
+	if len(ends) != 2 || ends[1].SQLState != "42703" {
+		t.Fatalf("got query events %+v", ends)
+	}
+}
+
+func TestTraceCopyInContext(t *testing.T) {
+	script := pqtest.NewScript().On(CopyIn("items", "id"), &pqtest.Result{
+		CopyIn: func([]byte) *pqtest.Result { return &pqtest.Result{Tag: "COPY 1"} },
+	})
+	tr := &recordingTracer{}
+	_, db, done := openTestDB(t, script, withTracer(tr))
+	defer done()
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "load")
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, CopyIn("items", "id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stmt.Exec(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := stmt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := tr.startValue(TraceCopy); v != "load" {
+		t.Fatalf("copy traced with context value %v, want the caller's", v)
+	}
+	ends := tr.ended(TraceCopy)
+	if len(ends) != 1 || ends[0].RowsAffected != 1 {
+		t.Fatalf("got copy events %+v", ends)
+	}
+	if n := len(tr.ended(TraceCommit)); n != 1 {
+		t.Fatalf("got %d commit events", n)
+	}
+}